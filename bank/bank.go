@@ -0,0 +1,83 @@
+// bank/bank.go
+package bank
+
+import (
+	"errors"
+	"fmt"
+	"go-payroll/money"
+	"io"
+	"sort"
+	"time"
+)
+
+// Payment is a single credit transfer to an employee
+type Payment struct {
+	EndToEndID    string // unique reference of the payment, e.g. "RUN12-USER34"
+	Name          string // account holder name
+	AccountNumber string
+	BankName      string
+	Amount        money.Money
+	Reference     string // remittance information shown to the employee
+}
+
+// ErrNoDebtorAccount is returned by formatters that name the account the batch is paid from when it is missing
+var ErrNoDebtorAccount = errors.New("the account the salaries are paid from is not set")
+
+// Batch is the set of payments of one payroll run
+type Batch struct {
+	MessageID     string
+	CreatedAt     time.Time
+	ExecutionDate time.Time
+	Currency      string
+	DebtorName    string // company paying the salaries
+	DebtorAccount string
+	DebtorBIC     string
+	Payments      []Payment
+}
+
+// Total sums the amounts of all payments
+func (b Batch) Total() money.Money {
+	total := money.New(0, b.Currency)
+	for _, p := range b.Payments {
+		total = total.Add(p.Amount)
+	}
+	return total
+}
+
+// Formatter writes a batch in a format accepted by a bank
+type Formatter interface {
+	ContentType() string
+	Extension() string
+	Format(w io.Writer, batch Batch) error
+}
+
+var formatters = map[string]Formatter{}
+
+// Register makes a formatter available under a name
+func Register(name string, f Formatter) {
+	formatters[name] = f
+}
+
+// Get returns the formatter registered under a name
+func Get(name string) (Formatter, error) {
+	f, ok := formatters[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown bank file format %q, available: %v", name, Names())
+	}
+	return f, nil
+}
+
+// Names lists the registered formatters
+func Names() []string {
+	names := make([]string, 0, len(formatters))
+	for name := range formatters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func init() {
+	Register("csv", CSVFormatter{})
+	Register("pain001", Pain001Formatter{})
+}
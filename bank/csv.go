@@ -0,0 +1,32 @@
+// bank/csv.go
+package bank
+
+import (
+	"encoding/csv"
+	"io"
+)
+
+// CSVFormatter writes a generic bulk transfer CSV with one row per payment
+type CSVFormatter struct{}
+
+func (CSVFormatter) ContentType() string { return "text/csv" }
+func (CSVFormatter) Extension() string   { return "csv" }
+
+func (CSVFormatter) Format(w io.Writer, batch Batch) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"Reference", "Beneficiary Name", "Account Number", "Bank Name", "Amount", "Currency", "Execution Date", "Description"})
+	for _, p := range batch.Payments {
+		cw.Write([]string{
+			p.EndToEndID,
+			p.Name,
+			p.AccountNumber,
+			p.BankName,
+			p.Amount.String(),
+			batch.Currency,
+			batch.ExecutionDate.Format("2006-01-02"),
+			p.Reference,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
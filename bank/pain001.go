@@ -0,0 +1,141 @@
+// bank/pain001.go
+package bank
+
+import (
+	"encoding/xml"
+	"io"
+)
+
+// Pain001Formatter writes an ISO 20022 customer credit transfer initiation (pain.001.001.03)
+type Pain001Formatter struct{}
+
+func (Pain001Formatter) ContentType() string { return "application/xml" }
+func (Pain001Formatter) Extension() string   { return "xml" }
+
+type painDocument struct {
+	XMLName xml.Name `xml:"urn:iso:std:iso:20022:tech:xsd:pain.001.001.03 Document"`
+	Init    painInit `xml:"CstmrCdtTrfInitn"`
+}
+
+type painInit struct {
+	GrpHdr painGroupHeader `xml:"GrpHdr"`
+	PmtInf painPaymentInfo `xml:"PmtInf"`
+}
+
+type painGroupHeader struct {
+	MsgId    string    `xml:"MsgId"`
+	CreDtTm  string    `xml:"CreDtTm"`
+	NbOfTxs  int       `xml:"NbOfTxs"`
+	CtrlSum  string    `xml:"CtrlSum"`
+	InitgPty painParty `xml:"InitgPty"`
+}
+
+type painParty struct {
+	Nm string `xml:"Nm"`
+}
+
+type painPaymentInfo struct {
+	PmtInfId    string            `xml:"PmtInfId"`
+	PmtMtd      string            `xml:"PmtMtd"`
+	NbOfTxs     int               `xml:"NbOfTxs"`
+	CtrlSum     string            `xml:"CtrlSum"`
+	PmtTpInf    painPaymentType   `xml:"PmtTpInf"`
+	ReqdExctnDt string            `xml:"ReqdExctnDt"`
+	Dbtr        painParty         `xml:"Dbtr"`
+	DbtrAcct    painAccount       `xml:"DbtrAcct"`
+	DbtrAgt     painAgent         `xml:"DbtrAgt"`
+	ChrgBr      string            `xml:"ChrgBr"`
+	Txs         []painTransaction `xml:"CdtTrfTxInf"`
+}
+
+type painPaymentType struct {
+	CtgyPurp painCode `xml:"CtgyPurp"`
+}
+
+type painCode struct {
+	Cd string `xml:"Cd"`
+}
+
+type painAccount struct {
+	Othr painOther `xml:"Id>Othr"`
+}
+
+type painOther struct {
+	Id string `xml:"Id"`
+}
+
+type painAgent struct {
+	BIC  string     `xml:"FinInstnId>BIC,omitempty"`
+	Nm   string     `xml:"FinInstnId>Nm,omitempty"`
+	Othr *painOther `xml:"FinInstnId>Othr,omitempty"`
+}
+
+// agent identifies a bank by BIC when known, falling back to its name
+func agent(bic, name string) painAgent {
+	if bic != "" {
+		return painAgent{BIC: bic}
+	}
+	if name != "" {
+		return painAgent{Nm: name}
+	}
+	return painAgent{Othr: &painOther{Id: "NOTPROVIDED"}}
+}
+
+type painAmount struct {
+	Ccy   string `xml:"Ccy,attr"`
+	Value string `xml:",chardata"`
+}
+
+type painTransaction struct {
+	EndToEndId string      `xml:"PmtId>EndToEndId"`
+	Amt        painAmount  `xml:"Amt>InstdAmt"`
+	CdtrAgt    painAgent   `xml:"CdtrAgt"`
+	Cdtr       painParty   `xml:"Cdtr"`
+	CdtrAcct   painAccount `xml:"CdtrAcct"`
+	Ustrd      string      `xml:"RmtInf>Ustrd,omitempty"`
+}
+
+func (Pain001Formatter) Format(w io.Writer, batch Batch) error {
+	if batch.DebtorAccount == "" {
+		return ErrNoDebtorAccount
+	}
+	total := batch.Total().String()
+	doc := painDocument{Init: painInit{
+		GrpHdr: painGroupHeader{
+			MsgId:    batch.MessageID,
+			CreDtTm:  batch.CreatedAt.Format("2006-01-02T15:04:05"),
+			NbOfTxs:  len(batch.Payments),
+			CtrlSum:  total,
+			InitgPty: painParty{Nm: batch.DebtorName},
+		},
+		PmtInf: painPaymentInfo{
+			PmtInfId:    batch.MessageID,
+			PmtMtd:      "TRF",
+			NbOfTxs:     len(batch.Payments),
+			CtrlSum:     total,
+			PmtTpInf:    painPaymentType{CtgyPurp: painCode{Cd: "SALA"}},
+			ReqdExctnDt: batch.ExecutionDate.Format("2006-01-02"),
+			Dbtr:        painParty{Nm: batch.DebtorName},
+			DbtrAcct:    painAccount{Othr: painOther{Id: batch.DebtorAccount}},
+			DbtrAgt:     agent(batch.DebtorBIC, ""),
+			ChrgBr:      "SLEV",
+		},
+	}}
+	for _, p := range batch.Payments {
+		doc.Init.PmtInf.Txs = append(doc.Init.PmtInf.Txs, painTransaction{
+			EndToEndId: p.EndToEndID,
+			Amt:        painAmount{Ccy: batch.Currency, Value: p.Amount.String()},
+			CdtrAgt:    agent("", p.BankName),
+			Cdtr:       painParty{Nm: p.Name},
+			CdtrAcct:   painAccount{Othr: painOther{Id: p.AccountNumber}},
+			Ustrd:      p.Reference,
+		})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	return enc.Encode(doc)
+}
@@ -0,0 +1,38 @@
+package bank
+
+import (
+	"bytes"
+	"errors"
+	"go-payroll/money"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPain001(t *testing.T) {
+	batch := Batch{
+		MessageID:     "PAYROLL-RUN1",
+		CreatedAt:     time.Date(2025, 1, 31, 9, 0, 0, 0, time.UTC),
+		ExecutionDate: time.Date(2025, 1, 31, 0, 0, 0, 0, time.UTC),
+		Currency:      "IDR",
+		DebtorName:    "Acme",
+		DebtorAccount: "1234567890",
+		Payments: []Payment{
+			{EndToEndID: "RUN1-USER2", Name: "Ann", AccountNumber: "555", BankName: "BCA", Amount: money.New(500000, "IDR")},
+		},
+	}
+	var buf bytes.Buffer
+	if err := (Pain001Formatter{}).Format(&buf, batch); err != nil {
+		t.Fatalf("Format: %v", err)
+	}
+	if !strings.Contains(buf.String(), "<DbtrAcct>") || !strings.Contains(buf.String(), "<Id>1234567890</Id>") {
+		t.Errorf("debtor account missing from\n%s", buf.String())
+	}
+
+	// A bank refuses a transfer without the account it is paid from, so no file is written
+	batch.DebtorAccount = ""
+	buf.Reset()
+	if err := (Pain001Formatter{}).Format(&buf, batch); !errors.Is(err, ErrNoDebtorAccount) || buf.Len() > 0 {
+		t.Errorf("Format without a debtor account = %v with %d bytes, want ErrNoDebtorAccount", err, buf.Len())
+	}
+}
@@ -0,0 +1,34 @@
+package config
+
+import (
+	"os"
+	"time"
+)
+
+// AccessTokenTTL and RefreshTokenTTL are how long access and refresh tokens stay valid
+var (
+	AccessTokenTTL  = 15 * time.Minute
+	RefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+// LoadAuthSettings reads the token lifetimes from the environment as Go durations:
+// ACCESS_TOKEN_TTL (default 15m) and REFRESH_TOKEN_TTL (default 720h)
+func LoadAuthSettings() {
+	for name, ttl := range map[string]*time.Duration{
+		"ACCESS_TOKEN_TTL":  &AccessTokenTTL,
+		"REFRESH_TOKEN_TTL": &RefreshTokenTTL,
+	} {
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			panic("invalid " + name + ": " + value)
+		}
+		*ttl = d
+	}
+	if os.Getenv("JWT_SECRET") == "" {
+		panic("JWT_SECRET is not set")
+	}
+}
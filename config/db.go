@@ -3,7 +3,9 @@ package config
 import (
 	"fmt"
 	"go-payroll/models"
+	"go-payroll/money"
 	"go-payroll/seed"
+	"go-payroll/utils"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
@@ -11,7 +13,7 @@ import (
 var DB *gorm.DB
 
 func ConnectDB(dsn string) {
-    db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+    db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{TranslateError: true})
     if err != nil {
         panic("failed to connect to database")
     }
@@ -27,11 +29,32 @@ func ConnectDB(dsn string) {
 		// }
 
     // Auto-migrate your models here
+    MigrateMoneyColumns()
+		MigrateAttendanceDuplicates()
     AutoMigrate()
+		MigrateReimbursementDates()
+		MigrateBankAccountNumbers()
+		CheckPayrollCurrency()
 		err = seed.SeedUsers(db)
 		if err != nil {
 			panic("failed to seed users: " + err.Error())
 		}
+		err = seed.SeedLeaveTypes(db)
+		if err != nil {
+			panic("failed to seed leave types: " + err.Error())
+		}
+		err = seed.SeedWorkSchedules(db)
+		if err != nil {
+			panic("failed to seed work schedules: " + err.Error())
+		}
+		err = seed.SeedReimbursementCategories(db)
+		if err != nil {
+			panic("failed to seed reimbursement categories: " + err.Error())
+		}
+		err = seed.SeedAccessControl(db)
+		if err != nil {
+			panic("failed to seed access control: " + err.Error())
+		}
 }
 
 func AutoMigrate() {
@@ -42,6 +65,24 @@ func AutoMigrate() {
 				&models.AuditLog{},
 				&models.Overtime{},
 				&models.Reimbursement{},
+				&models.DailyPayroll{},
+				&models.AttendancePeriod{},
+				&models.SalaryHistory{},
+				&models.PayComponent{},
+				&models.EmployeePayComponent{},
+				&models.PayrollComponentLine{},
+				&models.LeaveType{},
+				&models.LeaveRequest{},
+				&models.LeaveDay{},
+				&models.Holiday{},
+				&models.WorkSchedule{},
+				&models.ReimbursementCategory{},
+				&models.AttendanceCorrection{},
+				&models.Permission{},
+				&models.Role{},
+				&models.RouteGuard{},
+				&models.Session{},
+				&models.RefreshToken{},
         // Add other models here
     )
     if err != nil {
@@ -49,3 +90,130 @@ func AutoMigrate() {
     }
 		fmt.Println("Database migration completed successfully")
 }
+
+// MigrateAttendanceDuplicates removes second attendances of a user on the same date so the unique index
+// on user and date can be created. The paid one is kept, otherwise the first recorded.
+func MigrateAttendanceDuplicates() {
+	if !DB.Migrator().HasTable(&models.Attendance{}) {
+		return
+	}
+	result := DB.Exec(`DELETE FROM attendances a USING attendances b
+		WHERE a.user_id = b.user_id AND a.date = b.date AND a.id <> b.id
+		AND ((b.payroll_processed_id <> 0) > (a.payroll_processed_id <> 0)
+			OR ((b.payroll_processed_id <> 0) = (a.payroll_processed_id <> 0) AND b.id < a.id))`)
+	if result.Error != nil {
+		panic("failed to remove duplicate attendances: " + result.Error.Error())
+	}
+	if result.RowsAffected > 0 {
+		fmt.Println("Removed", result.RowsAffected, "duplicate attendances")
+	}
+}
+
+// MigrateReimbursementDates dates the claims from before reimbursements had an expense date on the day they
+// were filed, otherwise they fall in no attendance period and are never paid
+func MigrateReimbursementDates() {
+	result := DB.Exec(`UPDATE reimbursements
+		SET date = date_trunc('day', created_at AT TIME ZONE 'UTC') AT TIME ZONE 'UTC'
+		WHERE (date IS NULL OR date < '0002-01-01') AND created_at IS NOT NULL`)
+	if result.Error != nil {
+		panic("failed to backfill reimbursement dates: " + result.Error.Error())
+	}
+	if result.RowsAffected == 0 {
+		return
+	}
+	fmt.Println("Dated", result.RowsAffected, "reimbursements without a date on the day they were filed")
+	// Approved claims filed in a period that is already paid stay unpaid until someone moves them
+	var stranded int64
+	DB.Model(&models.Reimbursement{}).
+		Joins("JOIN attendance_periods p ON reimbursements.date BETWEEN p.start_date AND p.end_date").
+		Where("p.status = ? AND reimbursements.payroll_processed_id = 0 AND reimbursements.status = ?", models.PeriodStatusPaid, models.ReimbursementStatusApproved).
+		Count(&stranded)
+	if stranded > 0 {
+		fmt.Println("Warning:", stranded, "unpaid reimbursements are now dated in paid attendance periods")
+	}
+}
+
+// MigrateBankAccountNumbers encrypts the bank account numbers stored in plain text or with the older key
+// derivation. It also refuses to start when DATA_ENCRYPTION_KEY cannot read the numbers already encrypted.
+func MigrateBankAccountNumbers() {
+	type row struct {
+		ID                uint
+		BankAccountNumber string
+	}
+	var rows []row
+	if err := DB.Raw(`SELECT id, bank_account_number FROM users WHERE bank_account_number <> ''`).Scan(&rows).Error; err != nil {
+		panic("failed to read bank account numbers: " + err.Error())
+	}
+	migrated := 0
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		for _, r := range rows {
+			plain, err := utils.DecryptString(r.BankAccountNumber)
+			if err != nil {
+				return fmt.Errorf("DATA_ENCRYPTION_KEY cannot decrypt the bank account number of user %d: %w", r.ID, err)
+			}
+			if utils.IsEncrypted(r.BankAccountNumber) {
+				continue
+			}
+			encrypted, err := utils.EncryptString(plain)
+			if err != nil {
+				return err
+			}
+			if err := tx.Exec(`UPDATE users SET bank_account_number = ? WHERE id = ? AND bank_account_number = ?`,
+				encrypted, r.ID, r.BankAccountNumber).Error; err != nil {
+				return err
+			}
+			migrated++
+		}
+		return nil
+	})
+	if err != nil {
+		panic("failed to encrypt bank account numbers: " + err.Error())
+	}
+	if migrated > 0 {
+		fmt.Println("Encrypted", migrated, "bank account numbers")
+	}
+}
+
+// moneyColumns are the amount columns that used to be double precision
+var moneyColumns = map[string][]string{
+	"users":            {"salary"},
+	"reimbursements":   {"amount"},
+	"daily_payrolls":   {"salary_rate", "daily_rate", "base_salary", "overtime_pay", "reimbursement_total", "take_home_pay"},
+	"salary_histories": {"salary"},
+}
+
+// MigrateMoneyColumns converts float amount columns to numeric(20,2), rounding half-even to cents
+// so the stored values match what money.Money reads back.
+func MigrateMoneyColumns() {
+	for table, columns := range moneyColumns {
+		for _, column := range columns {
+			var dataType string
+			DB.Raw(`SELECT data_type FROM information_schema.columns WHERE table_name = ? AND column_name = ?`, table, column).Scan(&dataType)
+			if dataType != "double precision" && dataType != "real" {
+				continue
+			}
+			// Postgres rounds numeric half away from zero, so round the float half-even by hand
+			sql := fmt.Sprintf(`ALTER TABLE %[1]s ALTER COLUMN %[2]s TYPE numeric(20,2) USING (
+				CASE WHEN abs(%[2]s::numeric * 100 - trunc(%[2]s::numeric * 100)) = 0.5
+					THEN (2 * round(%[2]s::numeric * 50, 0)) / 100
+					ELSE round(%[2]s::numeric, 2) END)`, table, column)
+			if err := DB.Exec(sql).Error; err != nil {
+				panic("failed to migrate " + table + "." + column + " to numeric: " + err.Error())
+			}
+			fmt.Println("Migrated", table+"."+column, "to numeric")
+		}
+	}
+}
+
+// CheckPayrollCurrency refuses to start when earlier payroll runs were in another currency than
+// PAYROLL_CURRENCY, as amounts are read back in the payroll currency
+func CheckPayrollCurrency() {
+	var currencies []string
+	if err := DB.Model(&models.DailyPayroll{}).Distinct("currency").
+		Where("currency <> '' AND currency <> ?", money.DefaultCurrency).Pluck("currency", &currencies).Error; err != nil {
+		panic("failed to check the payroll currency: " + err.Error())
+	}
+	if len(currencies) > 0 {
+		panic(fmt.Sprintf("PAYROLL_CURRENCY is %s but earlier payroll runs are in %v", money.DefaultCurrency, currencies))
+	}
+}
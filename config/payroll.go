@@ -0,0 +1,67 @@
+package config
+
+import (
+	"fmt"
+	"go-payroll/contributions"
+	"go-payroll/money"
+	"go-payroll/payroll"
+	"go-payroll/tax"
+	"os"
+	"strconv"
+)
+
+// LoadPayrollSettings applies the currency, rounding policy, tax jurisdiction and contribution scheme from the environment:
+// PAYROLL_CURRENCY (default IDR, a currency with 2 decimals), ROUNDING_MODE (half_even, half_up or down), ROUNDING_SCOPE (line or total),
+// HOLIDAY_OVERTIME_MULTIPLIER (default 3),
+// TAX_JURISDICTION (default id-pph21, "none" to withhold no tax) and CONTRIBUTIONS (default id-bpjs, "none" for none)
+func LoadPayrollSettings() {
+	if currency := os.Getenv("PAYROLL_CURRENCY"); currency != "" {
+		money.DefaultCurrency = currency
+	}
+	if scale := money.Scale(money.DefaultCurrency); scale != money.StoredScale {
+		panic(fmt.Sprintf("invalid PAYROLL_CURRENCY: %s has %d decimals, amounts are stored with %d", money.DefaultCurrency, scale, money.StoredScale))
+	}
+
+	mode, err := money.ParseRoundingMode(os.Getenv("ROUNDING_MODE"))
+	if err != nil {
+		panic("invalid ROUNDING_MODE: " + err.Error())
+	}
+	scope, err := money.ParseRoundingScope(os.Getenv("ROUNDING_SCOPE"))
+	if err != nil {
+		panic("invalid ROUNDING_SCOPE: " + err.Error())
+	}
+	payroll.DefaultRules.Rounding = money.Rounding{Mode: mode, Scope: scope}
+
+	if value := os.Getenv("HOLIDAY_OVERTIME_MULTIPLIER"); value != "" {
+		multiplier, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || multiplier <= 0 {
+			panic("invalid HOLIDAY_OVERTIME_MULTIPLIER: " + value)
+		}
+		payroll.DefaultRules.HolidayOvertimeMultiplier = multiplier
+	}
+
+	code := os.Getenv("TAX_JURISDICTION")
+	if code == "" {
+		code = "id-pph21"
+	}
+	if code != "none" {
+		jurisdiction, err := tax.Load(code)
+		if err != nil {
+			panic("failed to load tax rules: " + err.Error())
+		}
+		payroll.DefaultRules.Tax = jurisdiction
+	}
+
+	scheme := os.Getenv("CONTRIBUTIONS")
+	if scheme == "" {
+		scheme = "id-bpjs"
+	}
+	if scheme != "none" {
+		loaded, err := contributions.Load(scheme)
+		if err != nil {
+			panic("failed to load contribution schedules: " + err.Error())
+		}
+		payroll.DefaultRules.Contributions = loaded
+	}
+	fmt.Println("Payroll currency:", money.DefaultCurrency, "tax jurisdiction:", code, "contributions:", scheme)
+}
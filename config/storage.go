@@ -0,0 +1,27 @@
+package config
+
+import (
+	"go-payroll/storage"
+	"go-payroll/utils"
+	"os"
+)
+
+// Receipts stores the receipts of reimbursement claims
+var Receipts storage.Storage
+
+// LoadStorage sets up file storage from the environment: RECEIPTS_DIR (default ./uploads/receipts), and checks
+// DATA_ENCRYPTION_KEY, which encrypts bank account numbers at rest
+func LoadStorage() {
+	if err := utils.CheckEncryptionKey(); err != nil {
+		panic(err.Error())
+	}
+	dir := os.Getenv("RECEIPTS_DIR")
+	if dir == "" {
+		dir = "./uploads/receipts"
+	}
+	local, err := storage.NewLocal(dir)
+	if err != nil {
+		panic("failed to prepare receipt storage: " + err.Error())
+	}
+	Receipts = local
+}
@@ -0,0 +1,136 @@
+// contributions/contributions.go
+package contributions
+
+import (
+	"embed"
+	"fmt"
+	"go-payroll/money"
+	"go-payroll/rulefiles"
+	"math/big"
+	"time"
+)
+
+// Schedule files are JSON named <scheme>-<version>.json listing the statutory programs in effect
+// from a date, so a new wage cap or rate is a new file rather than a code change.
+//
+//go:embed rules/*.json
+var embeddedRules embed.FS
+
+// Program is one statutory program with an employee and an employer share
+type Program struct {
+	Code                    string `json:"code"`
+	Name                    string `json:"name"`
+	Basis                   string `json:"basis"`         // "base_salary" or "gross_pay"
+	EmployeeRate            string `json:"employee_rate"` // decimal fraction, e.g. "0.01"
+	EmployerRate            string `json:"employer_rate"`
+	WageCap                 *int64 `json:"wage_cap"`                  // monthly wage is capped at this, whole currency units
+	EmployerShareTaxable    bool   `json:"employer_share_taxable"`    // employer premium counts as taxable income of the employee
+	EmployeeShareDeductible bool   `json:"employee_share_deductible"` // employee share reduces taxable income
+}
+
+// Schedule is one version of the programs of a scheme
+type Schedule struct {
+	Scheme        string    `json:"scheme"`
+	Version       string    `json:"version"`
+	EffectiveFrom string    `json:"effective_from"` // YYYY-MM-DD
+	Source        string    `json:"source"`
+	Programs      []Program `json:"programs"`
+}
+
+// Line is the contribution to one program for a pay period
+type Line struct {
+	Code                    string      `json:"code"`
+	Name                    string      `json:"name"`
+	Basis                   money.Money `json:"basis"`
+	EmployeeAmount          money.Money `json:"employee_amount"`
+	EmployerAmount          money.Money `json:"employer_amount"`
+	EmployerShareTaxable    bool        `json:"employer_share_taxable,omitempty"`
+	EmployeeShareDeductible bool        `json:"employee_share_deductible,omitempty"`
+}
+
+// Scheme computes the statutory contributions of a country
+type Scheme struct {
+	Code      string
+	schedules []rulefiles.File[Schedule]
+}
+
+// Wages are the pay of one period contributions are computed on
+type Wages struct {
+	BaseSalary    money.Money // salary paid for the days of the period
+	GrossPay      money.Money // base salary + overtime + component earnings
+	MonthlySalary money.Money // full salary of a month, zero to cap the period's wages directly
+}
+
+// Load reads every schedule of a scheme, from CONTRIBUTIONS_RULES_DIR when set, otherwise the built in ones
+func Load(code string) (*Scheme, error) {
+	schedules, err := rulefiles.Load[Schedule](embeddedRules, "CONTRIBUTIONS_RULES_DIR", code)
+	if err != nil {
+		return nil, err
+	}
+	if len(schedules) == 0 {
+		return nil, fmt.Errorf("no contribution schedules found for %s", code)
+	}
+	return &Scheme{Code: code, schedules: schedules}, nil
+}
+
+// Compute returns a line per program of the schedule in effect on the pay date.
+// Shares are a rate of the program's basis, rounded to minor units. Wage caps are monthly: when the
+// monthly wage is over the cap, the basis of the period is reduced in the same proportion.
+func (s *Scheme) Compute(w Wages, payDate time.Time, mode money.RoundingMode) ([]Line, error) {
+	found, ok := rulefiles.On(s.schedules, payDate)
+	if !ok {
+		return nil, fmt.Errorf("no %s contribution schedule in effect on %s", s.Code, payDate.Format("2006-01-02"))
+	}
+	schedule := found.Rules
+
+	currency := w.GrossPay.CurrencyCode()
+	var lines []Line
+	for _, p := range schedule.Programs {
+		basis, monthly := w.BaseSalary, w.MonthlySalary
+		if p.Basis == "gross_pay" {
+			// A month's gross is the monthly salary with the period's overtime and component earnings
+			basis, monthly = w.GrossPay, w.MonthlySalary.Add(w.GrossPay.Sub(w.BaseSalary))
+		}
+		if basis.IsNegative() {
+			basis = money.New(0, currency)
+		}
+		if p.WageCap != nil {
+			limit := new(big.Rat).SetInt64(*p.WageCap)
+			if w.MonthlySalary.IsZero() {
+				basis = money.Min(basis, money.FromRat(limit, currency, mode))
+			} else if monthly.Rat().Cmp(limit) > 0 {
+				basis = money.FromRat(limit.Mul(limit, basis.Rat()).Quo(limit, monthly.Rat()), currency, mode)
+			}
+		}
+
+		share := func(rate string) (money.Money, error) {
+			if rate == "" {
+				return money.New(0, currency), nil
+			}
+			r, ok := new(big.Rat).SetString(rate)
+			if !ok {
+				return money.Money{}, fmt.Errorf("%s %s: invalid rate %q", s.Code, p.Code, rate)
+			}
+			return money.FromRat(r.Mul(r, basis.Rat()), currency, mode), nil
+		}
+		employee, err := share(p.EmployeeRate)
+		if err != nil {
+			return nil, err
+		}
+		employer, err := share(p.EmployerRate)
+		if err != nil {
+			return nil, err
+		}
+
+		lines = append(lines, Line{
+			Code:                    p.Code,
+			Name:                    p.Name,
+			Basis:                   basis,
+			EmployeeAmount:          employee,
+			EmployerAmount:          employer,
+			EmployerShareTaxable:    p.EmployerShareTaxable,
+			EmployeeShareDeductible: p.EmployeeShareDeductible,
+		})
+	}
+	return lines, nil
+}
@@ -0,0 +1,126 @@
+package contributions
+
+import (
+	"go-payroll/money"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func date(s string) time.Time {
+	d, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func amount(s string) money.Money {
+	m, err := money.Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// employeeShares maps program codes to the employee share of their line
+func employeeShares(lines []Line) map[string]string {
+	shares := map[string]string{}
+	for _, l := range lines {
+		shares[l.Code] = l.EmployeeAmount.String()
+	}
+	return shares
+}
+
+func TestComputeBPJS(t *testing.T) {
+	scheme, err := Load("id-bpjs")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		wages   Wages
+		payDate string
+		want    map[string]string
+	}{
+		{
+			name:    "a full month over the caps pays on the caps",
+			wages:   Wages{BaseSalary: amount("20000000"), GrossPay: amount("20000000"), MonthlySalary: amount("20000000")},
+			payDate: "2025-03-31",
+			want:    map[string]string{"bpjs_kesehatan": "120000.00", "jht": "400000.00", "jp": "105474.00"},
+		},
+		{
+			// half the month worked: the 12,000,000 cap is on the monthly wage, so half of it applies
+			name:    "a part month pays on the same share of the caps",
+			wages:   Wages{BaseSalary: amount("10000000"), GrossPay: amount("10000000"), MonthlySalary: amount("20000000")},
+			payDate: "2025-03-31",
+			want:    map[string]string{"bpjs_kesehatan": "60000.00", "jht": "200000.00", "jp": "52737.00"},
+		},
+		{
+			name:    "a monthly wage under the caps pays on what was paid",
+			wages:   Wages{BaseSalary: amount("4000000"), GrossPay: amount("4500000"), MonthlySalary: amount("8000000")},
+			payDate: "2025-03-31",
+			want:    map[string]string{"bpjs_kesehatan": "40000.00", "jht": "80000.00", "jp": "40000.00"},
+		},
+		{
+			name:    "without a monthly salary the period's wages are capped",
+			wages:   Wages{BaseSalary: amount("20000000"), GrossPay: amount("20000000")},
+			payDate: "2025-03-31",
+			want:    map[string]string{"bpjs_kesehatan": "120000.00", "jp": "105474.00"},
+		},
+		{
+			name:    "the schedule in effect on the pay date applies",
+			wages:   Wages{BaseSalary: amount("20000000"), GrossPay: amount("20000000"), MonthlySalary: amount("20000000")},
+			payDate: "2025-02-28",
+			want:    map[string]string{"jp": "100423.00"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines, err := scheme.Compute(tt.wages, date(tt.payDate), money.HalfEven)
+			if err != nil {
+				t.Fatalf("Compute: %v", err)
+			}
+			got := employeeShares(lines)
+			for code, want := range tt.want {
+				if got[code] != want {
+					t.Errorf("%s = %s, want %s", code, got[code], want)
+				}
+			}
+		})
+	}
+
+	if _, err := scheme.Compute(Wages{}, date("2020-01-31"), money.HalfEven); err == nil {
+		t.Error("no error before the first schedule")
+	}
+}
+
+func TestComputeGrossPayBasis(t *testing.T) {
+	dir := t.TempDir()
+	schedule := `{"scheme": "test", "version": "1", "effective_from": "2025-01-01", "programs": [
+		{"code": "pension", "name": "Pension", "basis": "gross_pay", "employee_rate": "0.1", "wage_cap": 3000}
+	]}`
+	if err := os.WriteFile(filepath.Join(dir, "test-1.json"), []byte(schedule), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CONTRIBUTIONS_RULES_DIR", dir)
+	scheme, err := Load("test")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	// a month's gross is the 2,000 salary with the period's 2,000 of overtime and components, the cap
+	// takes 3/4 of the period's 3,000 gross
+	lines, err := scheme.Compute(Wages{BaseSalary: amount("1000"), GrossPay: amount("3000"), MonthlySalary: amount("2000")}, date("2025-01-31"), money.HalfEven)
+	if err != nil {
+		t.Fatalf("Compute: %v", err)
+	}
+	if got := lines[0].Basis.String(); got != "2250.00" {
+		t.Errorf("basis = %s, want 2250.00", got)
+	}
+	if got := lines[0].EmployeeAmount.String(); got != "225.00" {
+		t.Errorf("employee share = %s, want 225.00", got)
+	}
+}
@@ -0,0 +1,338 @@
+// controllers/access.go
+package controllers
+
+import (
+	"go-payroll/config"
+	"go-payroll/middleware"
+	"go-payroll/models"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// accessRoutes are the routes that edit roles and route guards. Someone active must always be able to call them.
+var accessRoutes = []models.RouteGuard{
+	{Method: "PUT", Path: "/api/admin/roles/:id"},
+	{Method: "PUT", Path: "/api/admin/route-guards/:id"},
+}
+
+// checkAccessManageable refuses a change that would leave no active user holding the permissions the
+// access routes require, which nobody could undo through the API
+func checkAccessManageable(tx *gorm.DB) error {
+	for _, route := range accessRoutes {
+		var guard models.RouteGuard
+		if err := tx.Where("method = ? AND path = ?", route.Method, route.Path).First(&guard).Error; err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Could not load route guards")
+		}
+		holders, err := permissionHolders(tx, guard.Permission)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Could not check permissions")
+		}
+		if holders == 0 {
+			return fiber.NewError(fiber.StatusBadRequest, "This would leave no active user with "+guard.Permission+" to manage access")
+		}
+	}
+	return nil
+}
+
+// permissionHolders counts the active users holding the permission through any of their roles
+func permissionHolders(db *gorm.DB, permission string) (int64, error) {
+	var count int64
+	err := db.Table("users").
+		Where("users.status = ?", models.UserStatusActive).
+		Where(`EXISTS (SELECT 1 FROM user_roles
+			JOIN role_permissions ON role_permissions.role_id = user_roles.role_id
+			JOIN permissions ON permissions.id = role_permissions.permission_id
+			WHERE user_roles.user_id = users.id AND permissions.code = ?)`, permission).
+		Count(&count).Error
+	return count, err
+}
+
+// roleCodes lists the codes of the roles loaded on a user
+func roleCodes(user models.User) []string {
+	codes := []string{}
+	for _, role := range user.Roles {
+		codes = append(codes, role.Code)
+	}
+	return codes
+}
+
+// checkCanAssignRoles refuses to change the roles of a user for a caller without rbac:manage, otherwise
+// employee:write would be enough to make anyone an admin, the caller included
+func checkCanAssignRoles(callerID uint, before, after []models.Role) error {
+	codes := func(roles []models.Role) []string {
+		out := roleCodes(models.User{Roles: roles})
+		slices.Sort(out)
+		return out
+	}
+	if slices.Equal(codes(before), codes(after)) {
+		return nil
+	}
+	allowed, err := middleware.HasPermission(config.DB, callerID, models.PermRBACManage)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Could not check permissions")
+	}
+	if !allowed {
+		return fiber.NewError(fiber.StatusForbidden, "Changing roles requires "+models.PermRBACManage)
+	}
+	return nil
+}
+
+// checkCanSetPassword refuses to set the password of a user holding a permission the caller lacks, unless the
+// caller has rbac:manage. Otherwise employee:write would be enough to take over an admin account.
+func checkCanSetPassword(caller, target []string) error {
+	if slices.Contains(caller, models.PermRBACManage) {
+		return nil
+	}
+	for _, permission := range target {
+		if !slices.Contains(caller, permission) {
+			return fiber.NewError(fiber.StatusForbidden, "Setting the password of a user with "+permission+" requires it or "+models.PermRBACManage)
+		}
+	}
+	return nil
+}
+
+// permissionCodes lists the permissions a user holds through their roles, whatever their status
+func permissionCodes(db *gorm.DB, userID uint) ([]string, error) {
+	permissions := []string{}
+	err := db.Model(&models.Permission{}).Distinct("permissions.code").
+		Joins("JOIN role_permissions ON role_permissions.permission_id = permissions.id").
+		Joins("JOIN user_roles ON user_roles.role_id = role_permissions.role_id").
+		Where("user_roles.user_id = ?", userID).Order("permissions.code").Pluck("permissions.code", &permissions).Error
+	return permissions, err
+}
+
+// loadRoles finds the roles with the given codes, all of which must exist
+func loadRoles(db *gorm.DB, codes []string) ([]models.Role, error) {
+	if len(codes) == 0 {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "At least one role is required")
+	}
+	var roles []models.Role
+	if err := db.Where("code IN ?", codes).Find(&roles).Error; err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Could not load roles")
+	}
+	for _, code := range codes {
+		if !slices.ContainsFunc(roles, func(r models.Role) bool { return r.Code == code }) {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "Unknown role "+code)
+		}
+	}
+	// Keep the order they were given in, the first is the primary role
+	slices.SortFunc(roles, func(a, b models.Role) int {
+		return slices.Index(codes, a.Code) - slices.Index(codes, b.Code)
+	})
+	return roles, nil
+}
+
+// loadPermissions finds the permissions with the given codes, all of which must exist
+func loadPermissions(db *gorm.DB, codes []string) ([]models.Permission, error) {
+	permissions := []models.Permission{}
+	if len(codes) == 0 {
+		return permissions, nil
+	}
+	if err := db.Where("code IN ?", codes).Find(&permissions).Error; err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Could not load permissions")
+	}
+	for _, code := range codes {
+		if !slices.ContainsFunc(permissions, func(p models.Permission) bool { return p.Code == code }) {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "Unknown permission "+code)
+		}
+	}
+	return permissions, nil
+}
+
+// ListPermissions lists the permissions roles can grant
+func ListPermissions(c *fiber.Ctx) error {
+	var permissions []models.Permission
+	if err := config.DB.Order("code").Find(&permissions).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch permissions")
+	}
+	return c.JSON(fiber.Map{"permissions": permissions})
+}
+
+// GetMyPermissions shows the roles and permissions of the logged in user, for clients deciding what to show
+func GetMyPermissions(c *fiber.Ctx) error {
+	user, err := GetUserProfile(c)
+	if err != nil {
+		return err
+	}
+	if err := config.DB.Model(user).Association("Roles").Find(&user.Roles); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch roles")
+	}
+	permissions := []string{}
+	if user.Status == models.UserStatusActive {
+		if permissions, err = permissionCodes(config.DB, user.ID); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch permissions")
+		}
+	}
+	return c.JSON(fiber.Map{"roles": roleCodes(*user), "permissions": permissions})
+}
+
+var roleCodePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,49}$`)
+
+// roleInput is the payload to create or update a role. Nil fields are left unchanged on update.
+type roleInput struct {
+	Code        *string   `json:"code"`
+	Name        *string   `json:"name"`
+	Permissions *[]string `json:"permissions"` // replaces all the role's permissions
+}
+
+// apply validates the input and copies it onto the role
+func (in roleInput) apply(role *models.Role) error {
+	if in.Code != nil {
+		code := strings.ToLower(strings.TrimSpace(*in.Code))
+		if !roleCodePattern.MatchString(code) {
+			return fiber.NewError(fiber.StatusBadRequest, "code should be 1 to 50 lowercase letters, digits, _ or -, starting with a letter")
+		}
+		if role.ID != 0 && code != role.Code {
+			return fiber.NewError(fiber.StatusBadRequest, "The code of a role cannot be changed")
+		}
+		role.Code = code
+	}
+	if in.Name != nil {
+		if strings.TrimSpace(*in.Name) == "" {
+			return fiber.NewError(fiber.StatusBadRequest, "name is required")
+		}
+		role.Name = strings.TrimSpace(*in.Name)
+	}
+	if in.Permissions != nil {
+		permissions, err := loadPermissions(config.DB, *in.Permissions)
+		if err != nil {
+			return err
+		}
+		role.Permissions = permissions
+	}
+	return nil
+}
+
+// ListRoles lists the roles with their permissions
+func ListRoles(c *fiber.Ctx) error {
+	var roles []models.Role
+	if err := config.DB.Preload("Permissions").Order("id").Find(&roles).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch roles")
+	}
+	return c.JSON(fiber.Map{"roles": roles})
+}
+
+// CreateRole defines a new role
+func CreateRole(c *fiber.Ctx) error {
+	var input roleInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid input",
+			"instruction": "code and name are required; permissions is a list of permission codes",
+		})
+	}
+	if input.Code == nil || input.Name == nil {
+		return fiber.NewError(fiber.StatusBadRequest, "code and name are required")
+	}
+
+	admin, err := GetUserProfile(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnauthorized, "Unauthorized")
+	}
+	role := models.Role{Permissions: []models.Permission{}, CreatedBy: admin.ID, UpdatedBy: admin.ID}
+	if err := input.apply(&role); err != nil {
+		return err
+	}
+	var count int64
+	config.DB.Model(&models.Role{}).Where("code = ?", role.Code).Count(&count)
+	if count > 0 {
+		return fiber.NewError(fiber.StatusConflict, "Role code already exists")
+	}
+	if err := config.DB.Create(&role).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to create role")
+	}
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"message": "Role created", "role": role})
+}
+
+// UpdateRole renames a role or replaces its permissions; the change applies to its holders right away
+func UpdateRole(c *fiber.Ctx) error {
+	var input roleInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid input",
+			"instruction": "Send any of name and permissions (a list of permission codes)",
+		})
+	}
+
+	admin, err := GetUserProfile(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnauthorized, "Unauthorized")
+	}
+	var role models.Role
+	if err := config.DB.Preload("Permissions").First(&role, c.Params("id")).Error; err != nil {
+		return fiber.NewError(fiber.StatusNotFound, "Role not found")
+	}
+	if err := input.apply(&role); err != nil {
+		return err
+	}
+
+	role.UpdatedBy = admin.ID
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Select("name", "updated_by").Updates(&role).Error; err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to update role")
+		}
+		if input.Permissions == nil {
+			return nil
+		}
+		if err := tx.Model(&role).Association("Permissions").Replace(role.Permissions); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to update role permissions")
+		}
+		return checkAccessManageable(tx)
+	})
+	if err != nil {
+		return err
+	}
+	return c.JSON(fiber.Map{"message": "Role updated", "role": role})
+}
+
+// ListRouteGuards lists the permission each guarded route requires
+func ListRouteGuards(c *fiber.Ctx) error {
+	var guards []models.RouteGuard
+	if err := config.DB.Order("path, method").Find(&guards).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch route guards")
+	}
+	return c.JSON(fiber.Map{"route_guards": guards})
+}
+
+// UpdateRouteGuard changes the permission a route requires
+func UpdateRouteGuard(c *fiber.Ctx) error {
+	type Input struct {
+		Permission string `json:"permission"`
+	}
+	var input Input
+	if err := c.BodyParser(&input); err != nil || input.Permission == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid input",
+			"instruction": "permission is required",
+		})
+	}
+
+	admin, err := GetUserProfile(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnauthorized, "Unauthorized")
+	}
+	if _, err := loadPermissions(config.DB, []string{input.Permission}); err != nil {
+		return err
+	}
+
+	var guard models.RouteGuard
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&guard, c.Params("id")).Error; err != nil {
+			return fiber.NewError(fiber.StatusNotFound, "Route guard not found")
+		}
+		guard.Permission = input.Permission
+		guard.UpdatedBy = admin.ID
+		if err := tx.Select("permission", "updated_by").Updates(&guard).Error; err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to update route guard")
+		}
+		return checkAccessManageable(tx)
+	})
+	if err != nil {
+		return err
+	}
+	return c.JSON(fiber.Map{"message": "Route guard updated", "route_guard": guard})
+}
@@ -0,0 +1,44 @@
+package controllers
+
+import (
+	"errors"
+	"go-payroll/models"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var adminPermissions = []string{
+	models.PermEmployeeRead, models.PermEmployeeWrite, models.PermPeriodManage,
+	models.PermPayrollView, models.PermPayrollRun, models.PermPayrollExport,
+	models.PermConfigRead, models.PermConfigWrite, models.PermApprovalsView, models.PermApprovalsReview,
+	models.PermRBACManage,
+}
+
+// Setting a password is logging in as that user, so employee:write alone must not reach accounts with more access
+func TestCheckCanSetPassword(t *testing.T) {
+	hr := []string{models.PermEmployeeRead, models.PermEmployeeWrite, models.PermSelfService}
+	tests := []struct {
+		name           string
+		caller, target []string
+		allowed        bool
+	}{
+		{"employee:write cannot reset an admin", hr, adminPermissions, false},
+		{"employee:write cannot reset a manager", hr, []string{models.PermSelfService, models.PermTeamReview}, false},
+		{"employee:write resets an employee", hr, []string{models.PermSelfService}, true},
+		{"employee:write resets a user without roles", hr, nil, true},
+		{"rbac:manage resets anyone", []string{models.PermEmployeeWrite, models.PermRBACManage}, adminPermissions, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkCanSetPassword(tt.caller, tt.target)
+			var fe *fiber.Error
+			if tt.allowed && err != nil {
+				t.Errorf("refused: %v", err)
+			}
+			if !tt.allowed && (!errors.As(err, &fe) || fe.Code != fiber.StatusForbidden) {
+				t.Errorf("got %v, want 403", err)
+			}
+		})
+	}
+}
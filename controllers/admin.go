@@ -2,230 +2,689 @@
 package controllers
 
 import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-payroll/bank"
 	"go-payroll/config"
+	"go-payroll/export"
 	"go-payroll/models"
-	"go-payroll/utils"
+	"go-payroll/money"
+	"os"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+var accountNumberPattern = regexp.MustCompile(`^[A-Za-z0-9]{5,34}$`)
+
 // Generate PayslipSummary generates a summary of payslips for all employees that have not been processed yet.
 func PayslipSummary(c *fiber.Ctx) error {
-	type Result struct {
-		UserID         uint
-		BaseSalary     float64
-		AttendanceCount int64
-		MonthlySalary float64
-		OvertimeHours  float64
-		OvertimePay    float64
-		Reimbursement  float64
-		TakeHomePay    float64
+	// Optionally restrict the summary to one attendance period
+	var period *models.AttendancePeriod
+	if id := c.QueryInt("attendance_period_id"); id > 0 {
+		period = &models.AttendancePeriod{}
+		if err := config.DB.First(period, id).Error; err != nil {
+			return fiber.NewError(fiber.StatusNotFound, "Attendance period not found")
+		}
 	}
 
 	var users []models.User
-	if err := config.DB.Find(&users).Error; err != nil {
+	if err := config.DB.Scopes(payableUsers(period)).Find(&users).Error; err != nil {
 		return fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch users")
 	}
 
-	var results []Result
+	rows := []summaryRow{}
 	for _, user := range users {
-		var attendanceCount int64
-		var totalOvertime float64
-		var totalReimburse float64
-
-		config.DB.Model(&models.Attendance{}).
-			Where("user_id = ? AND payroll_processed_id = 0", user.ID).
-			Count(&attendanceCount)
-
-		config.DB.Model(&models.Overtime{}).
-			Where("user_id = ? AND payroll_processed_id = 0", user.ID).
-			Select("COALESCE(SUM(hours), 0)").Scan(&totalOvertime)
-
-		config.DB.Model(&models.Reimbursement{}).
-			Where("user_id = ? AND payroll_processed_id = 0", user.ID).
-			Select("COALESCE(SUM(amount), 0)").Scan(&totalReimburse)
-
-		monthlySalary := float64(attendanceCount) * user.Salary
-		overtimePay := totalOvertime * (user.Salary / 8) // assume 8 hours/day
-		takeHome := monthlySalary + overtimePay + totalReimburse
-
-		results = append(results, Result{
-			UserID:        user.ID,
-			BaseSalary:    user.Salary,
-			AttendanceCount: attendanceCount,
-			MonthlySalary: monthlySalary,
-			OvertimeHours: totalOvertime,
-			OvertimePay:   overtimePay,
-			Reimbursement: totalReimburse,
-			TakeHomePay:   takeHome,
-		})
+		records, err := loadUnpaidRecords(config.DB, user.ID, period, false)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch payroll records")
+		}
+		breakdown, err := records.calculate(user)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to calculate payroll for "+user.Username+": "+err.Error())
+		}
+		rows = append(rows, summaryRow{Username: user.Username, Breakdown: breakdown})
 	}
 
-	total := 0.0
-	for _, r := range results {
-		total += r.TakeHomePay
+	return sendSummary(c, "payslip-summary", rows, fiber.Map{
+		"note": "Sum of unpaid base salary, overtime, and reimbursement",
+	})
+}
+
+// PayrollRunSummary summarises the persisted payroll lines of a payroll run
+func PayrollRunSummary(c *fiber.Ctx) error {
+	var run models.PayrollProcessed
+	if err := config.DB.First(&run, c.Params("id")).Error; err != nil {
+		return fiber.NewError(fiber.StatusNotFound, "Payroll run not found")
+	}
+	var lines []models.DailyPayroll
+	if err := config.DB.Where("payroll_processed_id = ?", run.ID).Order("user_id").Find(&lines).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch payroll lines")
 	}
 
-	return c.JSON(fiber.Map{
-		"summary": results,
-		"total_take_home_all_employees": utils.Round(total*100) / 100,
-		"note": "Sum of unpaid base salary, overtime, and reimbursement",
+	rows := []summaryRow{}
+	for _, line := range lines {
+		var u models.User
+		config.DB.Select("username").First(&u, line.UserID)
+		breakdown, err := breakdownFromLine(line)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to read payroll lines")
+		}
+		rows = append(rows, summaryRow{Username: u.Username, Breakdown: breakdown})
+	}
+
+	return sendSummary(c, fmt.Sprintf("payslip-summary-run%d", run.ID), rows, fiber.Map{
+		"payroll_processed_id": run.ID,
+		"status":               run.Status,
 	})
 }
 
 
-// CreateAttendancePeriod creates attendance records for a specified date range for multiple employees
+// CreateAttendancePeriod creates a draft attendance period for a date range
 func CreateAttendancePeriod(c *fiber.Ctx) error {
 	type Input struct {
 		StartDate string `json:"start_date"`
 		EndDate   string `json:"end_date"`
-		// array of employee IDs (optional)
-		Employees []uint `json:"employees,omitempty"`
 	}
 	var body Input
 	if err := c.BodyParser(&body); err != nil {
 		return c.Status(400).JSON(fiber.Map{
 			"error": "Invalid input",
-			"instruction": "Start date and end date should be in YYYY-MM-DD format, and employees should be an array of user IDs",
+			"instruction": "Start date and end date should be in YYYY-MM-DD format",
 		})
 	}
 	// Validate dates
 	if body.StartDate == "" || body.EndDate == "" {
 		return fiber.NewError(fiber.StatusBadRequest, "Start date and end date are required")
 	}
-	// Create attendance records for each employee
+	startDate, err := time.Parse("2006-01-02", body.StartDate)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid start date format")
+	}
+	endDate, err := time.Parse("2006-01-02", body.EndDate)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid end date format")
+	}
+	if endDate.Before(startDate) {
+		return fiber.NewError(fiber.StatusBadRequest, "End date must not be before start date")
+	}
+
 	user, err := GetUserProfile(c)
 	if err != nil {
 		return fiber.NewError(fiber.StatusUnauthorized, "Unauthorized access")
 	}
-	if len(body.Employees) == 0 {
-		return fiber.NewError(fiber.StatusBadRequest, "No employees provided")
-	}
 
-	for _, empID := range body.Employees {
+	// Periods must not overlap, otherwise a record could be paid twice
+	var overlapping int64
+	config.DB.Model(&models.AttendancePeriod{}).
+		Where("start_date <= ? AND end_date >= ?", endDate, startDate).
+		Count(&overlapping)
+	if overlapping > 0 {
+		return fiber.NewError(fiber.StatusConflict, "Attendance period overlaps an existing period")
+	}
 
-		// Loop through each day in the range and create attendance records
-		startDate, err := time.Parse("2006-01-02", body.StartDate)
-		if err != nil {
-			return fiber.NewError(fiber.StatusBadRequest, "Invalid start date format")
-		}
-		endDate, err := time.Parse("2006-01-02", body.EndDate)
-		if err != nil {
-			return fiber.NewError(fiber.StatusBadRequest, "Invalid end date format")
-		}
-		for d := startDate; d.Before(endDate.AddDate(0, 0, 1)); d = d.AddDate(0, 0, 1) {
-			attendance := models.Attendance{
-				UserID: empID,
-				// Set the date range
-				CreatedBy:  user.ID, // Assuming admin ID is 1
-				IPAddress:  c.IP(),
-				Date: 		 d,
-			}
-			if err := config.DB.Create(&attendance).Error; err != nil {
-				return fiber.NewError(fiber.StatusInternalServerError, "Failed to create attendance record")
-			}
-		}
+	period := models.AttendancePeriod{
+		StartDate: startDate,
+		EndDate:   endDate,
+		Status:    models.PeriodStatusDraft,
+		CreatedBy: user.ID,
+		UpdatedBy: user.ID,
+		IPAddress: c.IP(),
+	}
+	if err := config.DB.Create(&period).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to create attendance period")
 	}
 	return c.JSON(fiber.Map{
 		"message": "Attendance period created successfully",
-		"start_date": body.StartDate,
-		"end_date": body.EndDate,
-		"employees": body.Employees,
+		"period":  period,
 	})
 }
 
-// RunPayroll processes the payroll for all users based on attendance, overtime, and reimbursements
+// ListAttendancePeriods lists all attendance periods, most recent first
+func ListAttendancePeriods(c *fiber.Ctx) error {
+	var periods []models.AttendancePeriod
+	if err := config.DB.Order("start_date DESC").Find(&periods).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch attendance periods")
+	}
+	return c.JSON(fiber.Map{"periods": periods})
+}
+
+// periodTransitions lists the status changes an admin may make by hand.
+// A period only becomes "paid" through RunPayroll.
+var periodTransitions = map[string][]string{
+	models.PeriodStatusDraft:  {models.PeriodStatusOpen},
+	models.PeriodStatusOpen:   {models.PeriodStatusClosed},
+	models.PeriodStatusClosed: {models.PeriodStatusOpen},
+}
+
+// UpdateAttendancePeriodStatus moves an attendance period through its lifecycle
+func UpdateAttendancePeriodStatus(c *fiber.Ctx) error {
+	type Input struct {
+		Status string `json:"status"`
+	}
+	var body Input
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid input",
+			"instruction": "Status should be one of open or closed",
+		})
+	}
+	user, err := GetUserProfile(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnauthorized, "Unauthorized")
+	}
+
+	var period models.AttendancePeriod
+	if err := config.DB.First(&period, c.Params("id")).Error; err != nil {
+		return fiber.NewError(fiber.StatusNotFound, "Attendance period not found")
+	}
+
+	allowed := false
+	for _, next := range periodTransitions[period.Status] {
+		if next == body.Status {
+			allowed = true
+		}
+	}
+	if !allowed {
+		return fiber.NewError(fiber.StatusBadRequest, "Cannot change period status from "+period.Status+" to "+body.Status)
+	}
+
+	period.Status = body.Status
+	period.UpdatedBy = user.ID
+	if err := config.DB.Save(&period).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to update attendance period")
+	}
+	return c.JSON(fiber.Map{"message": "Attendance period updated", "period": period})
+}
+
+// RunPayroll processes the payroll of a closed attendance period based on attendance, overtime, and reimbursements
 func RunPayroll(c *fiber.Ctx) error {
 	// Input validation
 	type Input struct {
-		Date string `json:"date"` // Using string for date format consistency
+		AttendancePeriodID uint `json:"attendance_period_id"`
 	}
 	var input Input
-	if err := c.BodyParser(&input); err != nil {
+	if err := c.BodyParser(&input); err != nil || input.AttendancePeriodID == 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid input",
+			"instruction": "attendance_period_id of a closed attendance period is required",
+		})
+	}
+
+	user, err := GetUserProfile(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnauthorized, "Unauthorized")
+	}
+
+	// A retried request with the same Idempotency-Key returns the original run
+	idempotencyKey := c.Get("Idempotency-Key")
+	if replayed, err := replayPayrollRun(c, idempotencyKey, input.AttendancePeriodID); replayed {
+		return err
+	}
+
+	pp := models.PayrollProcessed{
+		AttendancePeriodID: input.AttendancePeriodID,
+		Date:               time.Now(),
+		Status:             models.PayrollStatusCompleted,
+		CreatedBy:          user.ID,
+		UpdatedBy:          user.ID,
+		IPAddress:          c.IP(),
+	}
+	if idempotencyKey != "" {
+		pp.IdempotencyKey = &idempotencyKey
+	}
+
+	// The whole run is a single transaction so a failure leaves nobody paid
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		// Lock the period so it cannot be paid twice
+		var period models.AttendancePeriod
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&period, input.AttendancePeriodID).Error; err != nil {
+			return fiber.NewError(fiber.StatusNotFound, "Attendance period not found")
+		}
+		if period.Status != models.PeriodStatusClosed {
+			return fiber.NewError(fiber.StatusBadRequest, "Attendance period must be closed before running payroll, current status is "+period.Status)
+		}
+		// Overtime and claims left pending would never be paid once the period is paid
+		var pending int64
+		if err := tx.Model(&models.Overtime{}).Where("status = ? AND date BETWEEN ? AND ?", models.OvertimeStatusPending, period.StartDate, period.EndDate).
+			Count(&pending).Error; err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to check pending overtime")
+		}
+		if pending > 0 {
+			return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Attendance period has %d pending overtime requests, approve or reject them first", pending))
+		}
+		if err := tx.Model(&models.Reimbursement{}).Where("status = ? AND date BETWEEN ? AND ?", models.ReimbursementStatusPending, period.StartDate, period.EndDate).
+			Count(&pending).Error; err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to check pending reimbursements")
+		}
+		if pending > 0 {
+			return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Attendance period has %d pending reimbursement claims, approve or reject them first", pending))
+		}
+
+		if err := tx.Create(&pp).Error; err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to create payroll period")
+		}
+
+		// Process per user
+		var users []models.User
+		if err := tx.Scopes(payableUsers(&period)).Find(&users).Error; err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch users")
+		}
+
+		for _, u := range users {
+			if err := lockPayComponents(tx, u.ID); err != nil {
+				return fiber.NewError(fiber.StatusInternalServerError, "Failed to lock pay components")
+			}
+			records, err := loadUnpaidRecords(tx, u.ID, &period, true)
+			if err != nil {
+				return fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch payroll records")
+			}
+			breakdown, err := records.calculate(u)
+			if err != nil {
+				return fiber.NewError(fiber.StatusInternalServerError, "Failed to calculate payroll for "+u.Username+": "+err.Error())
+			}
+			segments, err := json.Marshal(breakdown.SalarySegments)
+			if err != nil {
+				return fiber.NewError(fiber.StatusInternalServerError, "Failed to save salary segments")
+			}
+			components, err := json.Marshal(breakdown.Components)
+			if err != nil {
+				return fiber.NewError(fiber.StatusInternalServerError, "Failed to save pay component lines")
+			}
+			contributionLines, err := json.Marshal(breakdown.Contributions)
+			if err != nil {
+				return fiber.NewError(fiber.StatusInternalServerError, "Failed to save contribution lines")
+			}
+
+			// Create the immutable payroll line for this run
+			dpr := models.DailyPayroll{
+				UserID:                u.ID,
+				PayrollProcessedID:    pp.ID,
+				SalaryRate:            breakdown.SalaryRate,
+				DailyRate:             breakdown.DailyRate,
+				WorkingDays:           breakdown.WorkingDays,
+				TotalAttendance:       breakdown.AttendanceDays,
+				TotalPaidLeave:        breakdown.PaidLeaveDays,
+				TotalUnpaidLeave:      breakdown.UnpaidLeaveDays,
+				BaseSalary:            breakdown.BaseSalary,
+				SalarySegments:        string(segments),
+				TotalOvertime:         breakdown.OvertimeHours,
+				TotalHolidayOvertime:  breakdown.HolidayOvertimeHours,
+				OvertimePay:           breakdown.OvertimePay,
+				Components:            string(components),
+				ComponentEarnings:     breakdown.ComponentEarnings,
+				ComponentDeductions:   breakdown.ComponentDeductions,
+				GrossPay:              breakdown.GrossPay,
+				Contributions:         string(contributionLines),
+				EmployeeContributions: breakdown.EmployeeContributions,
+				EmployerContributions: breakdown.EmployerContributions,
+				TaxableIncome:         breakdown.TaxableIncome,
+				TaxDeductible:         breakdown.TaxDeductible,
+				TaxWithheld:           breakdown.TaxWithheld,
+				TaxMethod:             breakdown.TaxMethod,
+				ReimbursementTotal:    breakdown.ReimbursementTotal,
+				TakeHomePay:           breakdown.TakeHomePay,
+				Currency:              breakdown.Currency,
+				CreatedBy:             user.ID,
+			}
+			if err := tx.Create(&dpr).Error; err != nil {
+				return fiber.NewError(fiber.StatusInternalServerError, "Failed to save payroll summary")
+			}
+			// Remember what each pay component paid so bonuses are paid once, loans stop when repaid and deductions keep their arrears
+			for _, l := range breakdown.Components {
+				if err := tx.Create(&models.PayrollComponentLine{
+					PayrollProcessedID:     pp.ID,
+					UserID:                 u.ID,
+					EmployeePayComponentID: l.AssignmentID,
+					Amount:                 l.Amount,
+					Shortfall:              l.Shortfall,
+				}).Error; err != nil {
+					return fiber.NewError(fiber.StatusInternalServerError, "Failed to save pay component lines")
+				}
+			}
+
+			// Update references
+			if err := records.markProcessed(tx, pp.ID); err != nil {
+				return fiber.NewError(fiber.StatusInternalServerError, "Failed to update payroll references")
+			}
+		}
+
+		period.Status = models.PeriodStatusPaid
+		period.UpdatedBy = user.ID
+		if err := tx.Save(&period).Error; err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to update attendance period")
+		}
+		return nil
+	})
+	if err != nil {
+		// A concurrent request with the same key may have won the race
+		if replayed, replayErr := replayPayrollRun(c, idempotencyKey, input.AttendancePeriodID); replayed {
+			return replayErr
+		}
+		return err
+	}
+
+	return c.JSON(fiber.Map{"message": "Payroll processed", "payroll_processed_id": pp.ID})
+}
+
+// replayPayrollRun answers a retried run with the run saved under its Idempotency-Key, if any. The same key
+// sent for another attendance period is a conflict rather than a retry.
+func replayPayrollRun(c *fiber.Ctx, idempotencyKey string, periodID uint) (bool, error) {
+	if idempotencyKey == "" {
+		return false, nil
+	}
+	var existing models.PayrollProcessed
+	if config.DB.Where("idempotency_key = ?", idempotencyKey).First(&existing).Error != nil {
+		return false, nil
+	}
+	if existing.AttendancePeriodID != periodID {
+		return true, fiber.NewError(fiber.StatusConflict, fmt.Sprintf("Idempotency-Key was already used to run payroll for attendance period %d", existing.AttendancePeriodID))
+	}
+	return true, c.JSON(fiber.Map{"message": "Payroll already processed", "payroll_processed_id": existing.ID, "replayed": true})
+}
+
+// ListPayrollRuns lists all payroll runs, most recent first
+func ListPayrollRuns(c *fiber.Ctx) error {
+	var runs []models.PayrollProcessed
+	if err := config.DB.Order("id DESC").Find(&runs).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch payroll runs")
+	}
+	return c.JSON(fiber.Map{"payroll_runs": runs})
+}
+
+// VoidPayroll reverses a payroll run so the period can be corrected and run again.
+// The records it paid go back to unpaid and its payroll lines are kept but marked reversed.
+func VoidPayroll(c *fiber.Ctx) error {
+	type Input struct {
+		Reason string `json:"reason"`
+		Force  bool   `json:"force"`
+	}
+	var input Input
+	if err := c.BodyParser(&input); err != nil || input.Reason == "" {
 		return c.Status(400).JSON(fiber.Map{
 			"error": "Invalid input",
-			"instruction": "Date should be in YYYY-MM-DD format",
+			"instruction": "A reason for voiding the payroll run is required",
 		})
 	}
 
-	payrollDate, err := time.Parse("2006-01-02", input.Date)
+	user, err := GetUserProfile(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnauthorized, "Unauthorized")
+	}
+
+	var pp models.PayrollProcessed
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&pp, c.Params("id")).Error; err != nil {
+			return fiber.NewError(fiber.StatusNotFound, "Payroll run not found")
+		}
+		if pp.Status == models.PayrollStatusVoided {
+			return fiber.NewError(fiber.StatusBadRequest, "Payroll run is already voided")
+		}
+		// The bank may already have paid the exported transfers, voiding would pay the period twice
+		if pp.BankFileExportedAt != nil && !input.Force {
+			return fiber.NewError(fiber.StatusConflict, "The bank file of this payroll run was exported on "+
+				pp.BankFileExportedAt.Format("2006-01-02 15:04")+", send force: true to void it once its transfers are cancelled or recovered")
+		}
+
+		// Release the paid records
+		if err := releaseRecords(tx, pp.ID); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to release payroll records")
+		}
+
+		now := time.Now()
+		if err := tx.Model(&models.DailyPayroll{}).
+			Where("payroll_processed_id = ?", pp.ID).
+			Updates(map[string]interface{}{"reversed": true, "reversed_at": now}).Error; err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to reverse payroll lines")
+		}
+
+		pp.Status = models.PayrollStatusVoided
+		pp.VoidedAt = &now
+		pp.VoidedBy = user.ID
+		pp.VoidReason = input.Reason
+		pp.UpdatedBy = user.ID
+		if err := tx.Save(&pp).Error; err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to void payroll run")
+		}
+
+		// Hand the period back so it can be corrected and run again
+		if err := tx.Model(&models.AttendancePeriod{}).
+			Where("id = ? AND status = ?", pp.AttendancePeriodID, models.PeriodStatusPaid).
+			Updates(map[string]interface{}{"status": models.PeriodStatusClosed, "updated_by": user.ID}).Error; err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to reopen attendance period")
+		}
+		return nil
+	})
 	if err != nil {
-		return fiber.NewError(fiber.StatusBadRequest, "Invalid date format")
+		return err
 	}
 
-	// Create PayrollProcessed
+	return c.JSON(fiber.Map{"message": "Payroll run voided", "payroll_run": pp})
+}
+
+// ExportPayrollRunPayslips zips the PDF payslip of every employee in a payroll run
+func ExportPayrollRunPayslips(c *fiber.Ctx) error {
+	var run models.PayrollProcessed
+	if err := config.DB.First(&run, c.Params("id")).Error; err != nil {
+		return fiber.NewError(fiber.StatusNotFound, "Payroll run not found")
+	}
+	var period models.AttendancePeriod
+	if err := config.DB.First(&period, run.AttendancePeriodID).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch attendance period")
+	}
+
+	var lines []models.DailyPayroll
+	if err := config.DB.Where("payroll_processed_id = ?", run.ID).Order("user_id").Find(&lines).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch payroll lines")
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, line := range lines {
+		var u models.User
+		if err := config.DB.First(&u, line.UserID).Error; err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch user")
+		}
+		breakdown, err := breakdownFromLine(line)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to read payroll lines")
+		}
+		doc := historicalPayslipDocument(u.Username, historicalPayslip{
+			PayrollProcessedID: run.ID,
+			PeriodStart:        period.StartDate,
+			PeriodEnd:          period.EndDate,
+			Reversed:           line.Reversed,
+			Payslip:            breakdown,
+		})
+		w, err := zw.Create(payslipPDFName(u.Username, run.ID))
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to create archive")
+		}
+		if _, err := w.Write(export.RenderPayslipPDF(doc)); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to create archive")
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to create archive")
+	}
+
+	c.Set(fiber.HeaderContentType, "application/zip")
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="payslips-run%d.zip"`, run.ID))
+	return c.Send(buf.Bytes())
+}
+
+// ExportBankFile turns the take home pay of a completed payroll run into a bank disbursement file
+func ExportBankFile(c *fiber.Ctx) error {
+	formatter, err := bank.Get(c.Query("format", "csv"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	var run models.PayrollProcessed
+	if err := config.DB.First(&run, c.Params("id")).Error; err != nil {
+		return fiber.NewError(fiber.StatusNotFound, "Payroll run not found")
+	}
+	if run.Status != models.PayrollStatusCompleted {
+		return fiber.NewError(fiber.StatusConflict, "Only completed payroll runs can be exported, this run is "+run.Status)
+	}
+
+	var lines []models.DailyPayroll
+	if err := config.DB.Where("payroll_processed_id = ? AND take_home_pay > 0", run.ID).Order("user_id").Find(&lines).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch payroll lines")
+	}
+
+	batch := bank.Batch{
+		MessageID:     fmt.Sprintf("PAYROLL-RUN%d", run.ID),
+		CreatedAt:     time.Now(),
+		ExecutionDate: time.Now(),
+		Currency:      money.DefaultCurrency,
+		DebtorName:    companyName(),
+		DebtorAccount: os.Getenv("COMPANY_BANK_ACCOUNT"),
+		DebtorBIC:     os.Getenv("COMPANY_BANK_BIC"),
+	}
+
+	// The employees of the lines, in one query
+	userIDs := make([]uint, 0, len(lines))
+	for _, line := range lines {
+		userIDs = append(userIDs, line.UserID)
+	}
+	var userList []models.User
+	if len(userIDs) > 0 {
+		if err := config.DB.Where("id IN ?", userIDs).Find(&userList).Error; err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch users")
+		}
+	}
+	users := map[uint]models.User{}
+	for _, u := range userList {
+		users[u.ID] = u
+	}
+
+	// Every employee to be paid needs a bank account, otherwise nothing is exported
+	var missing []string
+	for _, line := range lines {
+		u, ok := users[line.UserID]
+		if !ok {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch user")
+		}
+		// Employees paid in cash are handled outside the bank file
+		if u.PayoutMethod == models.PayoutCash {
+			continue
+		}
+		if u.BankAccountNumber == "" || u.BankName == "" {
+			missing = append(missing, u.Username)
+			continue
+		}
+		name := u.BankAccountName
+		if name == "" {
+			name = u.Username
+		}
+		batch.Payments = append(batch.Payments, bank.Payment{
+			EndToEndID:    fmt.Sprintf("RUN%d-USER%d", run.ID, u.ID),
+			Name:          name,
+			AccountNumber: string(u.BankAccountNumber),
+			BankName:      u.BankName,
+			Amount:        line.TakeHomePay,
+			Reference:     fmt.Sprintf("Salary payroll run %d", run.ID),
+		})
+	}
+	if len(missing) > 0 {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"error":     "Some employees have no bank account details",
+			"employees": missing,
+		})
+	}
+
+	var buf bytes.Buffer
+	if err := formatter.Format(&buf, batch); errors.Is(err, bank.ErrNoDebtorAccount) {
+		return fiber.NewError(fiber.StatusInternalServerError, "COMPANY_BANK_ACCOUNT is not set, it is required for this bank file format")
+	} else if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to write bank file")
+	}
+
+	// Record the export so the run is not voided unnoticed once its transfers may have been sent
 	user, err := GetUserProfile(c)
 	if err != nil {
 		return fiber.NewError(fiber.StatusUnauthorized, "Unauthorized")
 	}
-	pp := models.PayrollProcessed{
-		Date:      payrollDate,
-		CreatedBy: user.ID,
-		UpdatedBy: user.ID,
-		IPAddress: c.IP(),
+	result := config.DB.Model(&models.PayrollProcessed{}).
+		Where("id = ? AND status = ?", run.ID, models.PayrollStatusCompleted).
+		Updates(map[string]interface{}{"bank_file_exported_at": time.Now(), "bank_file_exported_by": user.ID})
+	if result.Error != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to record the bank file export")
 	}
-	if err := config.DB.Create(&pp).Error; err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Failed to create payroll period")
+	if result.RowsAffected == 0 {
+		return fiber.NewError(fiber.StatusConflict, "Payroll run was voided during the export")
 	}
+	c.Set(fiber.HeaderContentType, formatter.ContentType())
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="bank-transfer-run%d.%s"`, run.ID, formatter.Extension()))
+	return c.Send(buf.Bytes())
+}
 
-	// Process per user
-	var users []models.User
-	if err := config.DB.Find(&users).Error; err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch users")
+// UpdateBankAccount sets the payout details of an employee
+func UpdateBankAccount(c *fiber.Ctx) error {
+	type Input struct {
+		PayoutMethod      string `json:"payout_method"`
+		BankName          string `json:"bank_name"`
+		AccountNumber     string `json:"account_number"`
+		AccountHolderName string `json:"account_holder_name"`
+	}
+	var input Input
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid input",
+			"instruction": "payout_method should be bank_transfer or cash; bank transfers need bank_name, account_number and account_holder_name",
+		})
 	}
+	if input.PayoutMethod == "" {
+		input.PayoutMethod = models.PayoutBankTransfer
+	}
+	input.AccountNumber = strings.ReplaceAll(input.AccountNumber, " ", "")
 
-	for _, u := range users {
-		// Count unpaid attendance
-		var attendanceCount int64
-		config.DB.Model(&models.Attendance{}).
-			Where("user_id = ? AND payroll_processed_id = 0", u.ID).
-			Count(&attendanceCount)
-
-		// Sum overtime hours
-		var overtimeHours float64
-		config.DB.Model(&models.Overtime{}).
-			Where("user_id = ? AND payroll_processed_id = 0", u.ID).
-			Select("COALESCE(SUM(hours), 0)").Scan(&overtimeHours)
-
-		// Sum reimbursements
-		var reimburseTotal float64
-		config.DB.Model(&models.Reimbursement{}).
-			Where("user_id = ? AND payroll_processed_id = 0", u.ID).
-			Select("COALESCE(SUM(amount), 0)").Scan(&reimburseTotal)
-
-		// baseSalary := float64(attendanceCount) * u.Salary
-		// overtimePay := overtimeHours * (u.Salary / 8) // assume 8 hours/day
-		// takeHome := baseSalary + overtimePay + reimburseTotal
-
-		// // Create DailyPayroll record
-		// dpr := models.DailyPayroll{
-		// 	UserID:             u.ID,
-		// 	PayrollProcessedID: pp.ID,
-		// 	TotalAttendance:    int(attendanceCount),
-		// 	BaseSalary:         baseSalary,
-		// 	TotalOvertime:      overtimeHours,
-		// 	OvertimePay:        overtimePay,
-		// 	ReimbursementTotal: reimburseTotal,
-		// 	TakeHomePay:        takeHome,
-		// 	CreatedAt:          time.Now(),
-		// 	UpdatedAt:          time.Now(),
-		// }
-		// if err := config.DB.Create(&dpr).Error; err != nil {
-		// 	return fiber.NewError(fiber.StatusInternalServerError, "Failed to save payroll summary")
-		// }
-
-		// Update references
-		config.DB.Model(&models.Attendance{}).
-			Where("user_id = ? AND payroll_processed_id = 0", u.ID).
-			Update("payroll_processed_id", pp.ID)
-		config.DB.Model(&models.Overtime{}).
-			Where("user_id = ? AND payroll_processed_id = 0", u.ID).
-			Update("payroll_processed_id", pp.ID)
-		config.DB.Model(&models.Reimbursement{}).
-			Where("user_id = ? AND payroll_processed_id = 0", u.ID).
-			Update("payroll_processed_id", pp.ID)
+	switch input.PayoutMethod {
+	case models.PayoutBankTransfer:
+		if input.BankName == "" || input.AccountNumber == "" || input.AccountHolderName == "" {
+			return fiber.NewError(fiber.StatusBadRequest, "bank_name, account_number and account_holder_name are required for bank transfers")
+		}
+		if !accountNumberPattern.MatchString(input.AccountNumber) {
+			return fiber.NewError(fiber.StatusBadRequest, "account_number should be 5 to 34 letters or digits")
+		}
+	case models.PayoutCash:
+	default:
+		return fiber.NewError(fiber.StatusBadRequest, "payout_method should be bank_transfer or cash")
 	}
 
-	return c.JSON(fiber.Map{"message": "Payroll processed", "payroll_processed_id": pp.ID})
+	admin, err := GetUserProfile(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnauthorized, "Unauthorized")
+	}
+	var user models.User
+	if err := config.DB.First(&user, c.Params("id")).Error; err != nil {
+		return fiber.NewError(fiber.StatusNotFound, "Employee not found")
+	}
+
+	user.PayoutMethod = input.PayoutMethod
+	user.BankName = input.BankName
+	user.BankAccountNumber = models.EncryptedString(input.AccountNumber)
+	user.BankAccountName = input.AccountHolderName
+	user.UpdatedBy = admin.ID
+	if err := config.DB.Select("payout_method", "bank_name", "bank_account_number", "bank_account_name", "updated_by").Updates(&user).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to save bank account")
+	}
+	return c.JSON(fiber.Map{"message": "Bank account updated", "bank_account": bankAccountResponse(user)})
+}
+
+// GetEmployeeBankAccount shows the payout details of an employee, with the account number masked
+func GetEmployeeBankAccount(c *fiber.Ctx) error {
+	var user models.User
+	if err := config.DB.First(&user, c.Params("id")).Error; err != nil {
+		return fiber.NewError(fiber.StatusNotFound, "Employee not found")
+	}
+	return c.JSON(fiber.Map{"bank_account": bankAccountResponse(user)})
 }
@@ -0,0 +1,341 @@
+// controllers/admin_components.go
+package controllers
+
+import (
+	"go-payroll/config"
+	"go-payroll/models"
+	"go-payroll/money"
+	"go-payroll/payroll"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// payComponentInput is the payload to create or update a pay component. Nil fields are left unchanged on update.
+type payComponentInput struct {
+	Code    *string `json:"code"`
+	Name    *string `json:"name"`
+	Type    *string `json:"type"`
+	Taxable *bool   `json:"taxable"`
+	Active  *bool   `json:"active"`
+}
+
+// apply validates the input and copies it onto the component
+func (in payComponentInput) apply(component *models.PayComponent) error {
+	if in.Code != nil {
+		code := strings.ToLower(strings.TrimSpace(*in.Code))
+		if code == "" || len(code) > 50 {
+			return fiber.NewError(fiber.StatusBadRequest, "code should be 1 to 50 characters")
+		}
+		component.Code = code
+	}
+	if in.Name != nil {
+		name := strings.TrimSpace(*in.Name)
+		if name == "" {
+			return fiber.NewError(fiber.StatusBadRequest, "name is required")
+		}
+		component.Name = name
+	}
+	if in.Type != nil {
+		if payroll.ComponentKind(*in.Type) == "" {
+			return fiber.NewError(fiber.StatusBadRequest, "type should be one of fixed_allowance, percent_of_base, bonus, loan_repayment or deduction")
+		}
+		component.Type = *in.Type
+	}
+	if in.Taxable != nil {
+		component.Taxable = *in.Taxable
+	}
+	if in.Active != nil {
+		component.Active = *in.Active
+	}
+	return nil
+}
+
+// ListPayComponents lists the defined pay components
+func ListPayComponents(c *fiber.Ctx) error {
+	var components []models.PayComponent
+	if err := config.DB.Order("code").Find(&components).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch pay components")
+	}
+	return c.JSON(fiber.Map{"pay_components": components})
+}
+
+// CreatePayComponent defines a new pay component
+func CreatePayComponent(c *fiber.Ctx) error {
+	var input payComponentInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error":       "Invalid input",
+			"instruction": "code, name and type are required; taxable defaults to true",
+		})
+	}
+	if input.Code == nil || input.Name == nil || input.Type == nil {
+		return fiber.NewError(fiber.StatusBadRequest, "code, name and type are required")
+	}
+
+	admin, err := GetUserProfile(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnauthorized, "Unauthorized")
+	}
+	component := models.PayComponent{Taxable: true, Active: true, CreatedBy: admin.ID, UpdatedBy: admin.ID}
+	if err := input.apply(&component); err != nil {
+		return err
+	}
+
+	var count int64
+	config.DB.Model(&models.PayComponent{}).Where("code = ?", component.Code).Count(&count)
+	if count > 0 {
+		return fiber.NewError(fiber.StatusConflict, "Pay component code already exists")
+	}
+	if err := config.DB.Create(&component).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to create pay component")
+	}
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"message": "Pay component created", "pay_component": component})
+}
+
+// UpdatePayComponent renames, retypes or deactivates a pay component. The type of a component
+// that is already assigned cannot change, its assignments were set up for the old type.
+func UpdatePayComponent(c *fiber.Ctx) error {
+	var input payComponentInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error":       "Invalid input",
+			"instruction": "Send any of code, name, type, taxable and active",
+		})
+	}
+
+	admin, err := GetUserProfile(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnauthorized, "Unauthorized")
+	}
+	var component models.PayComponent
+	if err := config.DB.First(&component, c.Params("id")).Error; err != nil {
+		return fiber.NewError(fiber.StatusNotFound, "Pay component not found")
+	}
+
+	before := component
+	if err := input.apply(&component); err != nil {
+		return err
+	}
+	if component.Type != before.Type {
+		var count int64
+		config.DB.Model(&models.EmployeePayComponent{}).Where("pay_component_id = ?", component.ID).Count(&count)
+		if count > 0 {
+			return fiber.NewError(fiber.StatusConflict, "Pay component is assigned to employees, its type cannot change")
+		}
+	}
+	if component.Code != before.Code {
+		var count int64
+		config.DB.Model(&models.PayComponent{}).Where("code = ? AND id <> ?", component.Code, component.ID).Count(&count)
+		if count > 0 {
+			return fiber.NewError(fiber.StatusConflict, "Pay component code already exists")
+		}
+	}
+
+	component.UpdatedBy = admin.ID
+	if err := config.DB.Select("code", "name", "type", "taxable", "active", "updated_by").Updates(&component).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to update pay component")
+	}
+	return c.JSON(fiber.Map{"message": "Pay component updated", "pay_component": component})
+}
+
+// assignmentResponse is how a pay component assignment leaves the admin API
+func assignmentResponse(a models.EmployeePayComponent, paid money.Money) fiber.Map {
+	var endDate string
+	if a.EndDate != nil {
+		endDate = a.EndDate.Format("2006-01-02")
+	}
+	response := fiber.Map{
+		"id":            a.ID,
+		"employee_id":   a.UserID,
+		"pay_component": a.PayComponent,
+		"amount":        a.Amount,
+		"rate":          a.Rate,
+		"start_date":    a.StartDate.Format("2006-01-02"),
+		"end_date":      endDate,
+		"note":          a.Note,
+		"paid_to_date":  paid,
+		"created_at":    a.CreatedAt,
+		"updated_at":    a.UpdatedAt,
+	}
+	if a.PayComponent.Type == models.ComponentLoanRepayment {
+		response["principal"] = a.Principal
+		response["outstanding"] = a.Principal.Sub(paid)
+	}
+	return response
+}
+
+// assignmentInput is the payload to assign a pay component or change an assignment
+type assignmentInput struct {
+	PayComponentID uint         `json:"pay_component_id"`
+	Amount         *money.Money `json:"amount"`
+	Rate           *string      `json:"rate"`
+	Principal      *money.Money `json:"principal"`
+	StartDate      *string      `json:"start_date"`
+	EndDate        *string      `json:"end_date"`
+	Note           *string      `json:"note"`
+}
+
+// apply validates the input against the component type and copies it onto the assignment
+func (in assignmentInput) apply(a *models.EmployeePayComponent) error {
+	if in.Amount != nil {
+		a.Amount = *in.Amount
+	}
+	if in.Rate != nil {
+		a.Rate = strings.TrimSpace(*in.Rate)
+	}
+	if in.Principal != nil {
+		a.Principal = *in.Principal
+	}
+	if in.Note != nil {
+		a.Note = *in.Note
+	}
+	if in.StartDate != nil {
+		date, err := time.Parse("2006-01-02", *in.StartDate)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid start_date format (YYYY-MM-DD)")
+		}
+		a.StartDate = date
+	}
+	if in.EndDate != nil {
+		if *in.EndDate == "" {
+			a.EndDate = nil
+		} else {
+			date, err := time.Parse("2006-01-02", *in.EndDate)
+			if err != nil {
+				return fiber.NewError(fiber.StatusBadRequest, "Invalid end_date format (YYYY-MM-DD)")
+			}
+			a.EndDate = &date
+		}
+	}
+
+	if a.StartDate.IsZero() {
+		return fiber.NewError(fiber.StatusBadRequest, "start_date is required")
+	}
+	if a.EndDate != nil && a.EndDate.Before(a.StartDate) {
+		return fiber.NewError(fiber.StatusBadRequest, "end_date cannot be before start_date")
+	}
+	switch a.PayComponent.Type {
+	case models.ComponentPercentOfBase:
+		rate, ok := new(big.Rat).SetString(a.Rate)
+		if !ok || rate.Sign() <= 0 || rate.Cmp(big.NewRat(100, 1)) > 0 {
+			return fiber.NewError(fiber.StatusBadRequest, "rate should be a percentage between 0 and 100")
+		}
+	case models.ComponentLoanRepayment:
+		if !a.Amount.IsPositive() || !a.Principal.IsPositive() {
+			return fiber.NewError(fiber.StatusBadRequest, "amount (installment) and principal should be positive")
+		}
+	default:
+		if !a.Amount.IsPositive() {
+			return fiber.NewError(fiber.StatusBadRequest, "amount should be positive")
+		}
+	}
+	return nil
+}
+
+// ListEmployeePayComponents lists the pay components assigned to an employee, with what was paid so far
+func ListEmployeePayComponents(c *fiber.Ctx) error {
+	var user models.User
+	if err := config.DB.First(&user, c.Params("id")).Error; err != nil {
+		return fiber.NewError(fiber.StatusNotFound, "Employee not found")
+	}
+	var assignments []models.EmployeePayComponent
+	if err := config.DB.Preload("PayComponent").Where("user_id = ?", user.ID).Order("start_date, id").Find(&assignments).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch pay components")
+	}
+	paid, err := loadComponentsPaid(config.DB, user.ID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch paid pay components")
+	}
+
+	entries := []fiber.Map{}
+	for _, a := range assignments {
+		entries = append(entries, assignmentResponse(a, paid[a.ID]))
+	}
+	return c.JSON(fiber.Map{"employee_id": user.ID, "pay_components": entries})
+}
+
+// AssignPayComponent assigns a pay component to an employee from a start date, optionally until an end date
+func AssignPayComponent(c *fiber.Ctx) error {
+	var input assignmentInput
+	if err := c.BodyParser(&input); err != nil || input.PayComponentID == 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error":       "Invalid input",
+			"instruction": "pay_component_id and start_date (YYYY-MM-DD) are required, with amount, rate (percent_of_base) or amount and principal (loan_repayment); end_date is optional",
+		})
+	}
+
+	admin, err := GetUserProfile(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnauthorized, "Unauthorized")
+	}
+	var user models.User
+	if err := config.DB.First(&user, c.Params("id")).Error; err != nil {
+		return fiber.NewError(fiber.StatusNotFound, "Employee not found")
+	}
+	var component models.PayComponent
+	if err := config.DB.First(&component, input.PayComponentID).Error; err != nil {
+		return fiber.NewError(fiber.StatusNotFound, "Pay component not found")
+	}
+	if !component.Active {
+		return fiber.NewError(fiber.StatusBadRequest, "Pay component is inactive")
+	}
+
+	assignment := models.EmployeePayComponent{
+		UserID:         user.ID,
+		PayComponentID: component.ID,
+		PayComponent:   component,
+		CreatedBy:      admin.ID,
+		UpdatedBy:      admin.ID,
+	}
+	if err := input.apply(&assignment); err != nil {
+		return err
+	}
+	if err := config.DB.Omit("PayComponent").Create(&assignment).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to assign pay component")
+	}
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message":       "Pay component assigned",
+		"pay_component": assignmentResponse(assignment, money.Money{}),
+	})
+}
+
+// UpdateEmployeePayComponent changes an assignment, e.g. sets its end date to stop it
+func UpdateEmployeePayComponent(c *fiber.Ctx) error {
+	var input assignmentInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error":       "Invalid input",
+			"instruction": "Send any of amount, rate, principal, start_date, end_date (YYYY-MM-DD, empty for open ended) and note",
+		})
+	}
+
+	admin, err := GetUserProfile(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnauthorized, "Unauthorized")
+	}
+	var assignment models.EmployeePayComponent
+	if err := config.DB.Preload("PayComponent").Where("user_id = ?", c.Params("id")).
+		First(&assignment, c.Params("assignmentId")).Error; err != nil {
+		return fiber.NewError(fiber.StatusNotFound, "Pay component assignment not found")
+	}
+	if err := input.apply(&assignment); err != nil {
+		return err
+	}
+
+	assignment.UpdatedBy = admin.ID
+	if err := config.DB.Select("amount", "rate", "principal", "start_date", "end_date", "note", "updated_by").
+		Updates(&assignment).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to update pay component assignment")
+	}
+	paid, err := loadComponentsPaid(config.DB, assignment.UserID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch paid pay components")
+	}
+	return c.JSON(fiber.Map{
+		"message":       "Pay component assignment updated",
+		"pay_component": assignmentResponse(assignment, paid[assignment.ID]),
+	})
+}
@@ -0,0 +1,556 @@
+// controllers/admin_employees.go
+package controllers
+
+import (
+	"errors"
+	"go-payroll/config"
+	"go-payroll/models"
+	"go-payroll/money"
+	"go-payroll/utils"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// employeeResponse is how a user leaves the admin API, without password or bank account number
+func employeeResponse(user models.User) fiber.Map {
+	var hireDate string
+	if user.HireDate != nil {
+		hireDate = user.HireDate.Format("2006-01-02")
+	}
+	return fiber.Map{
+		"id":         user.ID,
+		"username":   user.Username,
+		"role":       user.Role,
+		"roles":      roleCodes(user),
+		"salary":     user.Salary,
+		"department": user.Department,
+		"hire_date":  hireDate,
+		"status":     user.Status,
+		"married":    user.Married,
+		"dependents": user.Dependents,
+		"work_schedule_id": user.WorkScheduleID,
+		"manager_id": user.ManagerID,
+		"created_at": user.CreatedAt,
+		"updated_at": user.UpdatedAt,
+		"created_by": user.CreatedBy,
+		"updated_by": user.UpdatedBy,
+	}
+}
+
+// employeeInput is the payload to create or update an employee. Nil fields are left unchanged on update.
+type employeeInput struct {
+	Username   *string  `json:"username"`
+	Password   *string  `json:"password"`
+	Role       *string  `json:"role"`  // shorthand for roles with a single role
+	Roles      *[]string `json:"roles"` // replaces all the user's roles, the first is the primary role
+	Salary     *money.Money `json:"salary"`
+	Department *string  `json:"department"`
+	HireDate   *string  `json:"hire_date"`
+	Married    *bool    `json:"married"`
+	Dependents *int     `json:"dependents"`
+	WorkScheduleID *uint `json:"work_schedule_id"` // 0 for the default schedule
+	ManagerID  *uint    `json:"manager_id"`          // 0 for nobody
+}
+
+// apply validates the input and copies it onto the user
+func (in employeeInput) apply(user *models.User) error {
+	if in.Username != nil {
+		username := strings.TrimSpace(*in.Username)
+		if len(username) < 3 || len(username) > 50 {
+			return fiber.NewError(fiber.StatusBadRequest, "username should be 3 to 50 characters")
+		}
+		user.Username = username
+	}
+	if in.Password != nil {
+		if len(*in.Password) < 8 {
+			return fiber.NewError(fiber.StatusBadRequest, "password should be at least 8 characters")
+		}
+		hashed, err := utils.HashPassword(*in.Password)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Could not hash password")
+		}
+		user.Password = hashed
+	}
+	if in.Role != nil || in.Roles != nil {
+		var codes []string
+		if in.Roles != nil {
+			codes = *in.Roles
+		} else {
+			codes = []string{*in.Role}
+		}
+		roles, err := loadRoles(config.DB, codes)
+		if err != nil {
+			return err
+		}
+		user.Roles = roles
+		user.Role = roles[0].Code
+	}
+	if in.Salary != nil {
+		if in.Salary.IsNegative() {
+			return fiber.NewError(fiber.StatusBadRequest, "salary cannot be negative")
+		}
+		user.Salary = *in.Salary
+	}
+	if in.Department != nil {
+		user.Department = strings.TrimSpace(*in.Department)
+	}
+	if in.Married != nil {
+		user.Married = *in.Married
+	}
+	if in.Dependents != nil {
+		if *in.Dependents < 0 {
+			return fiber.NewError(fiber.StatusBadRequest, "dependents cannot be negative")
+		}
+		user.Dependents = *in.Dependents
+	}
+	if in.WorkScheduleID != nil {
+		if *in.WorkScheduleID == 0 {
+			user.WorkScheduleID = nil
+		} else {
+			var count int64
+			config.DB.Model(&models.WorkSchedule{}).Where("id = ?", *in.WorkScheduleID).Count(&count)
+			if count == 0 {
+				return fiber.NewError(fiber.StatusBadRequest, "work_schedule_id does not exist")
+			}
+			id := *in.WorkScheduleID
+			user.WorkScheduleID = &id
+		}
+	}
+	if in.ManagerID != nil {
+		if *in.ManagerID == 0 {
+			user.ManagerID = nil
+		} else {
+			var manager models.User
+			if err := config.DB.First(&manager, *in.ManagerID).Error; err != nil {
+				return fiber.NewError(fiber.StatusBadRequest, "manager_id does not exist")
+			}
+			if manager.ID == user.ID {
+				return fiber.NewError(fiber.StatusBadRequest, "An employee cannot report to themselves")
+			}
+			// Reporting to one of your own reports would make the hierarchy a loop
+			if user.ID != 0 {
+				reports, err := reportIDs(config.DB, user.ID)
+				if err != nil {
+					return fiber.NewError(fiber.StatusInternalServerError, "Could not check the reporting line")
+				}
+				if slices.Contains(reports, manager.ID) {
+					return fiber.NewError(fiber.StatusBadRequest, "manager_id is one of the employee's own reports")
+				}
+			}
+			user.ManagerID = &manager.ID
+		}
+	}
+	if in.HireDate != nil {
+		if *in.HireDate == "" {
+			user.HireDate = nil
+		} else {
+			date, err := time.Parse("2006-01-02", *in.HireDate)
+			if err != nil {
+				return fiber.NewError(fiber.StatusBadRequest, "Invalid hire date format (YYYY-MM-DD)")
+			}
+			user.HireDate = &date
+		}
+	}
+	return nil
+}
+
+// usernameTaken reports whether another user already has the username
+func usernameTaken(username string, exceptID uint) bool {
+	var count int64
+	config.DB.Model(&models.User{}).Where("username = ? AND id <> ?", username, exceptID).Count(&count)
+	return count > 0
+}
+
+// ListEmployees lists users with pagination and optional role, status, department and username filters
+func ListEmployees(c *fiber.Ctx) error {
+	page := c.QueryInt("page", 1)
+	if page < 1 {
+		page = 1
+	}
+	pageSize := c.QueryInt("page_size", 20)
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	q := config.DB.Model(&models.User{})
+	if role := c.Query("role"); role != "" {
+		q = q.Where("id IN (?)", config.DB.Table("user_roles").Select("user_roles.user_id").
+			Joins("JOIN roles ON roles.id = user_roles.role_id").Where("roles.code = ?", role))
+	}
+	if status := c.Query("status"); status != "" {
+		q = q.Where("status = ?", status)
+	}
+	if department := c.Query("department"); department != "" {
+		q = q.Where("department = ?", department)
+	}
+	if search := c.Query("q"); search != "" {
+		q = q.Where("username ILIKE ?", "%"+search+"%")
+	}
+
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to count employees")
+	}
+	var users []models.User
+	if err := q.Preload("Roles").Order("id").Offset((page - 1) * pageSize).Limit(pageSize).Find(&users).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch employees")
+	}
+
+	employees := []fiber.Map{}
+	for _, u := range users {
+		employees = append(employees, employeeResponse(u))
+	}
+	return c.JSON(fiber.Map{
+		"employees": employees,
+		"page":      page,
+		"page_size": pageSize,
+		"total":     total,
+	})
+}
+
+// GetEmployee shows a single user
+func GetEmployee(c *fiber.Ctx) error {
+	var user models.User
+	if err := config.DB.Preload("Roles").First(&user, c.Params("id")).Error; err != nil {
+		return fiber.NewError(fiber.StatusNotFound, "Employee not found")
+	}
+	return c.JSON(fiber.Map{"employee": employeeResponse(user)})
+}
+
+// CreateEmployee creates a user, employee by default
+func CreateEmployee(c *fiber.Ctx) error {
+	var input employeeInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid input",
+			"instruction": "username and password are required; roles (or a single role), salary, department, hire_date (YYYY-MM-DD), work_schedule_id and manager_id are optional",
+		})
+	}
+	if input.Username == nil || input.Password == nil {
+		return fiber.NewError(fiber.StatusBadRequest, "username and password are required")
+	}
+	if input.Role == nil && input.Roles == nil {
+		input.Roles = &[]string{models.RoleEmployee}
+	}
+
+	admin, err := GetUserProfile(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnauthorized, "Unauthorized")
+	}
+
+	user := models.User{
+		Role:      models.RoleEmployee,
+		Status:    models.UserStatusActive,
+		CreatedBy: admin.ID,
+		UpdatedBy: admin.ID,
+	}
+	if err := input.apply(&user); err != nil {
+		return err
+	}
+	// New users are employees unless someone who manages access says otherwise
+	if err := checkCanAssignRoles(admin.ID, []models.Role{{Code: models.RoleEmployee}}, user.Roles); err != nil {
+		return err
+	}
+	if usernameTaken(user.Username, 0) {
+		return fiber.NewError(fiber.StatusConflict, "Username already exists")
+	}
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Roles").Create(&user).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&user).Association("Roles").Append(user.Roles); err != nil {
+			return err
+		}
+		// Start the salary history at the hire date
+		effectiveFrom := today()
+		if user.HireDate != nil {
+			effectiveFrom = *user.HireDate
+		}
+		return tx.Create(&models.SalaryHistory{
+			UserID:        user.ID,
+			Salary:        user.Salary,
+			EffectiveFrom: effectiveFrom,
+			Note:          "Starting salary",
+			CreatedBy:     admin.ID,
+		}).Error
+	})
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to create employee")
+	}
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"message": "Employee created", "employee": employeeResponse(user)})
+}
+
+// UpdateEmployee changes the given fields of a user
+func UpdateEmployee(c *fiber.Ctx) error {
+	var input employeeInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid input",
+			"instruction": "Send any of username, password, roles (or a single role), salary, department, hire_date (YYYY-MM-DD), work_schedule_id and manager_id",
+		})
+	}
+
+	admin, err := GetUserProfile(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnauthorized, "Unauthorized")
+	}
+	var user models.User
+	if err := config.DB.Preload("Roles").First(&user, c.Params("id")).Error; err != nil {
+		return fiber.NewError(fiber.StatusNotFound, "Employee not found")
+	}
+
+	if input.Password != nil && user.ID != admin.ID {
+		callerPermissions, err := permissionCodes(config.DB, admin.ID)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Could not check permissions")
+		}
+		targetPermissions, err := permissionCodes(config.DB, user.ID)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Could not check permissions")
+		}
+		if err := checkCanSetPassword(callerPermissions, targetPermissions); err != nil {
+			return err
+		}
+	}
+
+	before := user
+	if err := input.apply(&user); err != nil {
+		return err
+	}
+	if err := checkCanAssignRoles(admin.ID, before.Roles, user.Roles); err != nil {
+		return err
+	}
+	if usernameTaken(user.Username, user.ID) {
+		return fiber.NewError(fiber.StatusConflict, "Username already exists")
+	}
+	user.UpdatedBy = admin.ID
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Select("username", "password", "role", "department", "hire_date", "married", "dependents", "work_schedule_id", "manager_id", "updated_by").Updates(&user).Error; err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to update employee")
+		}
+		if input.Role != nil || input.Roles != nil {
+			if err := tx.Model(&user).Association("Roles").Replace(user.Roles); err != nil {
+				return fiber.NewError(fiber.StatusInternalServerError, "Failed to update employee roles")
+			}
+			if err := checkAccessManageable(tx); err != nil {
+				return err
+			}
+		}
+		// A new password logs the user out everywhere
+		if user.Password != before.Password {
+			if err := revokeSessions(tx, user.ID, models.SessionRevokedPasswordChanged); err != nil {
+				return fiber.NewError(fiber.StatusInternalServerError, "Failed to end sessions")
+			}
+		}
+		// A salary edited here takes effect today, future raises go through the salary history
+		if user.Salary == before.Salary {
+			return nil
+		}
+		if err := recordSalaryChange(tx, before, models.SalaryHistory{
+			Salary:        user.Salary,
+			EffectiveFrom: today(),
+			Note:          "Updated from employee record",
+			CreatedBy:     admin.ID,
+		}); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to update employee")
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return c.JSON(fiber.Map{"message": "Employee updated", "employee": employeeResponse(user)})
+}
+
+// DeactivateEmployee marks a user inactive. Users are never deleted so their payroll history stays intact.
+func DeactivateEmployee(c *fiber.Ctx) error {
+	admin, err := GetUserProfile(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnauthorized, "Unauthorized")
+	}
+	var user models.User
+	if err := config.DB.Preload("Roles").First(&user, c.Params("id")).Error; err != nil {
+		return fiber.NewError(fiber.StatusNotFound, "Employee not found")
+	}
+	if user.ID == admin.ID {
+		return fiber.NewError(fiber.StatusBadRequest, "You cannot deactivate yourself")
+	}
+	if user.Status == models.UserStatusInactive {
+		return fiber.NewError(fiber.StatusBadRequest, "Employee is already inactive")
+	}
+
+	user.Status = models.UserStatusInactive
+	user.UpdatedBy = admin.ID
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Select("status", "updated_by").Updates(&user).Error; err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to deactivate employee")
+		}
+		if err := checkAccessManageable(tx); err != nil {
+			return err
+		}
+		if err := revokeSessions(tx, user.ID, models.SessionRevokedDeactivated); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to end sessions")
+		}
+		// Their direct reports move up to the next manager in line
+		if err := tx.Model(&models.User{}).Where("manager_id = ?", user.ID).
+			Updates(map[string]interface{}{"manager_id": user.ManagerID, "updated_by": admin.ID}).Error; err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to deactivate employee")
+		}
+		// Drop assignments that have not started yet, nothing was paid for them, and stop the others so later
+		// runs do not pay them
+		if err := tx.Where("user_id = ? AND start_date > ?", user.ID, today()).
+			Where("NOT EXISTS (SELECT 1 FROM payroll_component_lines pcl WHERE pcl.employee_pay_component_id = employee_pay_components.id)").
+			Delete(&models.EmployeePayComponent{}).Error; err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to deactivate employee")
+		}
+		if err := tx.Model(&models.EmployeePayComponent{}).
+			Where("user_id = ? AND (end_date IS NULL OR end_date > ?)", user.ID, today()).
+			Updates(map[string]interface{}{"end_date": today(), "updated_by": admin.ID}).Error; err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to deactivate employee")
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return c.JSON(fiber.Map{"message": "Employee deactivated", "employee": employeeResponse(user)})
+}
+
+// today is the current date at midnight UTC, like dates parsed from YYYY-MM-DD
+func today() time.Time {
+	return time.Now().UTC().Truncate(24 * time.Hour)
+}
+
+// recordSalaryChange adds a salary history entry for the user, whose Salary is the salary before the change.
+// Users without history first get an entry for their existing salary so earlier dates keep it.
+// An entry on the same date as an existing one replaces it.
+func recordSalaryChange(tx *gorm.DB, user models.User, change models.SalaryHistory) error {
+	change.UserID = user.ID
+
+	var count int64
+	if err := tx.Model(&models.SalaryHistory{}).Where("user_id = ?", user.ID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		opening := time.Time{}
+		if user.HireDate != nil {
+			opening = *user.HireDate
+		}
+		if opening.Before(change.EffectiveFrom) {
+			if err := tx.Create(&models.SalaryHistory{
+				UserID:        user.ID,
+				Salary:        user.Salary,
+				EffectiveFrom: opening,
+				Note:          "Salary before history was recorded",
+				CreatedBy:     change.CreatedBy,
+			}).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "effective_from"}},
+		DoUpdates: clause.AssignmentColumns([]string{"salary", "note", "created_by"}),
+	}).Create(&change).Error; err != nil {
+		return err
+	}
+
+	// Keep User.Salary on the salary in effect today
+	var current models.SalaryHistory
+	if err := tx.Where("user_id = ? AND effective_from <= ?", user.ID, today()).
+		Order("effective_from DESC").First(&current).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	return tx.Model(&models.User{}).Where("id = ?", user.ID).Update("salary", current.Salary).Error
+}
+
+// ListSalaryHistory lists the salary history of an employee, including scheduled raises
+func ListSalaryHistory(c *fiber.Ctx) error {
+	var user models.User
+	if err := config.DB.First(&user, c.Params("id")).Error; err != nil {
+		return fiber.NewError(fiber.StatusNotFound, "Employee not found")
+	}
+	var history []models.SalaryHistory
+	if err := config.DB.Where("user_id = ?", user.ID).Order("effective_from").Find(&history).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch salary history")
+	}
+
+	entries := []fiber.Map{}
+	for _, h := range history {
+		entries = append(entries, fiber.Map{
+			"id":             h.ID,
+			"salary":         h.Salary,
+			"effective_from": h.EffectiveFrom.Format("2006-01-02"),
+			"note":           h.Note,
+			"scheduled":      h.EffectiveFrom.After(today()),
+			"created_at":     h.CreatedAt,
+			"created_by":     h.CreatedBy,
+		})
+	}
+	return c.JSON(fiber.Map{
+		"employee_id":    user.ID,
+		"current_salary": user.Salary,
+		"salary_history": entries,
+	})
+}
+
+// ScheduleSalaryChange adds a salary that takes effect on a date, e.g. a future raise.
+// Payroll prorates attendance days across salary changes within a period.
+func ScheduleSalaryChange(c *fiber.Ctx) error {
+	type Input struct {
+		Salary        money.Money `json:"salary"`
+		EffectiveFrom string  `json:"effective_from"`
+		Note          string  `json:"note"`
+	}
+	var input Input
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid input",
+			"instruction": "salary should be a positive number and effective_from should be in YYYY-MM-DD format",
+		})
+	}
+	if !input.Salary.IsPositive() {
+		return fiber.NewError(fiber.StatusBadRequest, "salary should be a positive number")
+	}
+	effectiveFrom, err := time.Parse("2006-01-02", input.EffectiveFrom)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid effective_from format (YYYY-MM-DD)")
+	}
+
+	admin, err := GetUserProfile(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnauthorized, "Unauthorized")
+	}
+	var user models.User
+	if err := config.DB.First(&user, c.Params("id")).Error; err != nil {
+		return fiber.NewError(fiber.StatusNotFound, "Employee not found")
+	}
+
+	change := models.SalaryHistory{
+		Salary:        input.Salary,
+		EffectiveFrom: effectiveFrom,
+		Note:          input.Note,
+		CreatedBy:     admin.ID,
+	}
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		return recordSalaryChange(tx, user, change)
+	})
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to save salary change")
+	}
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message":        "Salary change scheduled",
+		"employee_id":    user.ID,
+		"salary":         input.Salary,
+		"effective_from": input.EffectiveFrom,
+	})
+}
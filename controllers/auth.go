@@ -5,8 +5,12 @@ import (
 	"go-payroll/config"
 	"go-payroll/models"
 	"go-payroll/utils"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type LoginInput struct {
@@ -30,15 +34,213 @@ func Login(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid credentials"})
 	}
 
-	token, err := utils.GenerateJWT(user.ID, user.Role)
+	if user.Status == models.UserStatusInactive {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Account is deactivated"})
+	}
+
+	session := models.Session{
+		ID:        uuid.New().String(),
+		UserID:    user.ID,
+		IPAddress: utils.GetIPAddress(c),
+		UserAgent: c.Get(fiber.HeaderUserAgent),
+	}
+	var tokens fiber.Map
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&session).Error; err != nil {
+			return err
+		}
+		var err error
+		tokens, err = issueTokens(tx, user, session.ID)
+		return err
+	})
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not generate token"})
 	}
 
-	return c.JSON(fiber.Map{
-		"message": "Login successful",
-		"token":   token,
+	tokens["message"] = "Login successful"
+	return c.JSON(tokens)
+}
+
+// issueTokens creates a refresh token for the session and an access token to go with it.
+// token is the access token, under the name it had before refresh tokens.
+func issueTokens(tx *gorm.DB, user models.User, sessionID string) (fiber.Map, error) {
+	refreshToken, err := utils.RandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Create(&models.RefreshToken{
+		SessionID: sessionID,
+		TokenHash: utils.HashToken(refreshToken),
+		ExpiresAt: time.Now().Add(config.RefreshTokenTTL),
+	}).Error; err != nil {
+		return nil, err
+	}
+	accessToken, err := utils.GenerateJWT(user.ID, user.Role, sessionID, config.AccessTokenTTL)
+	if err != nil {
+		return nil, err
+	}
+	return fiber.Map{
+		"token":              accessToken,
+		"token_type":         "Bearer",
+		"expires_in":         int(config.AccessTokenTTL.Seconds()),
+		"refresh_token":      refreshToken,
+		"refresh_expires_in": int(config.RefreshTokenTTL.Seconds()),
+	}, nil
+}
+
+// revokeSessions ends every open session of a user, so their refresh tokens and access tokens stop working
+func revokeSessions(tx *gorm.DB, userID uint, reason string) error {
+	return tx.Model(&models.Session{}).Where("user_id = ? AND revoked_at IS NULL", userID).
+		Updates(map[string]interface{}{"revoked_at": time.Now(), "revoked_reason": reason}).Error
+}
+
+// RefreshToken exchanges a refresh token for a new access token and a new refresh token. Refresh tokens
+// work once: presenting one again means it leaked, and the whole session is revoked.
+func RefreshToken(c *fiber.Ctx) error {
+	type Input struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	var input Input
+	if err := c.BodyParser(&input); err != nil || input.RefreshToken == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+			"instruction": "refresh_token is required",
+		})
+	}
+
+	invalid := fiber.NewError(fiber.StatusUnauthorized, "Invalid or expired refresh token")
+	reused := false
+	var tokens fiber.Map
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var token models.RefreshToken
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", utils.HashToken(input.RefreshToken)).First(&token).Error; err != nil {
+			return invalid
+		}
+		var session models.Session
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&session, "id = ?", token.SessionID).Error; err != nil {
+			return invalid
+		}
+		if session.RevokedAt != nil {
+			return invalid
+		}
+		if token.UsedAt != nil {
+			// Commit the revocation, the caller still gets refused
+			reused = true
+			now := time.Now()
+			return tx.Model(&session).Updates(map[string]interface{}{"revoked_at": now, "revoked_reason": models.SessionRevokedTokenReuse}).Error
+		}
+		if time.Now().After(token.ExpiresAt) {
+			return invalid
+		}
+		var user models.User
+		if err := tx.First(&user, session.UserID).Error; err != nil || user.Status != models.UserStatusActive {
+			return invalid
+		}
+
+		now := time.Now()
+		if err := tx.Model(&token).Update("used_at", now).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&session).Update("last_refreshed_at", now).Error; err != nil {
+			return err
+		}
+		var err error
+		tokens, err = issueTokens(tx, user, session.ID)
+		return err
 	})
+	if err != nil {
+		if err == invalid {
+			return err
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not refresh token"})
+	}
+	if reused {
+		return fiber.NewError(fiber.StatusUnauthorized, "Refresh token was already used, the session has been ended")
+	}
+	tokens["message"] = "Token refreshed"
+	return c.JSON(tokens)
+}
+
+// Logout ends the current session, or every session of the user with all set
+func Logout(c *fiber.Ctx) error {
+	type Input struct {
+		All bool `json:"all"`
+	}
+	var input Input
+	if err := parseOptionalBody(c, &input); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid input",
+			"instruction": "Send the optional all flag as JSON",
+		})
+	}
+
+	user, err := GetUserProfile(c)
+	if err != nil {
+		return err
+	}
+	q := config.DB.Model(&models.Session{}).Where("user_id = ? AND revoked_at IS NULL", user.ID)
+	if !input.All {
+		q = q.Where("id = ?", c.Locals("session_id"))
+	}
+	if err := q.Updates(map[string]interface{}{"revoked_at": time.Now(), "revoked_reason": models.SessionRevokedLogout}).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to log out")
+	}
+	return c.JSON(fiber.Map{"message": "Logged out"})
+}
+
+// ChangePassword changes the password of the logged in user and ends all their sessions
+func ChangePassword(c *fiber.Ctx) error {
+	type Input struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	var input Input
+	if err := c.BodyParser(&input); err != nil || input.CurrentPassword == "" || input.NewPassword == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+			"instruction": "current_password and new_password are required",
+		})
+	}
+	if len(input.NewPassword) < 8 {
+		return fiber.NewError(fiber.StatusBadRequest, "new_password should be at least 8 characters")
+	}
+
+	profile, err := GetUserProfile(c)
+	if err != nil {
+		return err
+	}
+	var user models.User
+	if err := config.DB.First(&user, profile.ID).Error; err != nil {
+		return fiber.NewError(fiber.StatusNotFound, "User not found")
+	}
+	if !utils.CheckPasswordHash(input.CurrentPassword, user.Password) {
+		return fiber.NewError(fiber.StatusUnauthorized, "current_password is wrong")
+	}
+	hashed, err := utils.HashPassword(input.NewPassword)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Could not hash password")
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Updates(map[string]interface{}{"password": hashed, "updated_by": user.ID}).Error; err != nil {
+			return err
+		}
+		return revokeSessions(tx, user.ID, models.SessionRevokedPasswordChanged)
+	})
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to change password")
+	}
+	return c.JSON(fiber.Map{"message": "Password changed, log in again"})
+}
+
+// parseOptionalBody parses a body whose fields are all optional. Without a body out is left as it is,
+// a body that cannot be parsed is an error.
+func parseOptionalBody(c *fiber.Ctx, out interface{}) error {
+	if len(c.Body()) == 0 {
+		return nil
+	}
+	return c.BodyParser(out)
 }
 
 func GetUserProfile(c *fiber.Ctx) (*models.User, error) {
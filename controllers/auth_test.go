@@ -0,0 +1,51 @@
+package controllers
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// A review or logout without a body keeps its defaults, a malformed one must not be taken as empty
+func TestParseOptionalBody(t *testing.T) {
+	app := fiber.New()
+	app.Post("/", func(c *fiber.Ctx) error {
+		input := struct {
+			Comment string `json:"comment"`
+		}{Comment: "default"}
+		if err := parseOptionalBody(c, &input); err != nil {
+			return c.Status(400).SendString("invalid")
+		}
+		return c.SendString(input.Comment)
+	})
+
+	tests := []struct {
+		name, body string
+		wantStatus int
+		wantBody   string
+	}{
+		{"no body", "", 200, "default"},
+		{"a comment", `{"comment": "ok"}`, 200, "ok"},
+		{"malformed", `{"comment": `, 400, "invalid"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.wantStatus || string(body) != tt.wantBody {
+				t.Errorf("got %d %q, want %d %q", resp.StatusCode, body, tt.wantStatus, tt.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,207 @@
+// controllers/calendar.go
+package controllers
+
+import (
+	"bytes"
+	"go-payroll/config"
+	"go-payroll/ical"
+	"go-payroll/models"
+	"go-payroll/payroll"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// loadCalendar loads a user's working weekdays and the holidays of the whole months between two dates,
+// so working days per month can be counted
+func loadCalendar(db *gorm.DB, userID uint, from, to time.Time) (*payroll.Calendar, error) {
+	schedule, err := loadWorkSchedule(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	first := time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, time.UTC)
+	last := time.Date(to.Year(), to.Month()+1, 0, 0, 0, 0, 0, time.UTC)
+	var holidays []models.Holiday
+	if err := db.Where("date BETWEEN ? AND ?", first, last).Find(&holidays).Error; err != nil {
+		return nil, err
+	}
+	cal := &payroll.Calendar{Holidays: map[string]string{}}
+	if schedule != nil {
+		if cal.Weekdays, err = payroll.ParseWeekdays(schedule.Weekdays); err != nil {
+			return nil, err
+		}
+		cal.HoursPerDay = schedule.HoursPerDay
+	}
+	for _, h := range holidays {
+		cal.Holidays[h.Date.Format("2006-01-02")] = h.Name
+	}
+	return cal, nil
+}
+
+// flagHolidayAttendance tells whether attendance on a public holiday is accepted and flagged (HOLIDAY_ATTENDANCE=flag)
+// instead of rejected, the default
+func flagHolidayAttendance() bool {
+	return strings.EqualFold(os.Getenv("HOLIDAY_ATTENDANCE"), "flag")
+}
+
+// ListHolidays lists the public holidays of a year, the current one by default
+func ListHolidays(c *fiber.Ctx) error {
+	year := c.QueryInt("year", today().Year())
+	var holidays []models.Holiday
+	err := config.DB.Where("date BETWEEN ? AND ?",
+		time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(year, time.December, 31, 0, 0, 0, 0, time.UTC)).
+		Order("date").Find(&holidays).Error
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch holidays")
+	}
+	return c.JSON(fiber.Map{"year": year, "holidays": holidays})
+}
+
+// CreateHoliday adds a public holiday, or renames the holiday already on that date
+func CreateHoliday(c *fiber.Ctx) error {
+	type Input struct {
+		Date string `json:"date"`
+		Name string `json:"name"`
+	}
+	var input Input
+	if err := c.BodyParser(&input); err != nil || strings.TrimSpace(input.Name) == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid input",
+			"instruction": "date (YYYY-MM-DD) and name are required",
+		})
+	}
+	date, err := time.Parse("2006-01-02", input.Date)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid date format (YYYY-MM-DD)")
+	}
+	if err := checkPeriodOpen(config.DB, date); err != nil {
+		return err
+	}
+
+	admin, err := GetUserProfile(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnauthorized, "Unauthorized")
+	}
+	holiday := models.Holiday{Date: date, Name: strings.TrimSpace(input.Name), Source: "manual", CreatedBy: admin.ID}
+	if err := upsertHolidays(config.DB, []models.Holiday{holiday}); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to save holiday")
+	}
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"message": "Holiday saved", "holiday": holiday})
+}
+
+// DeleteHoliday removes a public holiday that is not in a closed or paid attendance period
+func DeleteHoliday(c *fiber.Ctx) error {
+	var holiday models.Holiday
+	if err := config.DB.First(&holiday, c.Params("id")).Error; err != nil {
+		return fiber.NewError(fiber.StatusNotFound, "Holiday not found")
+	}
+	if err := checkPeriodOpen(config.DB, holiday.Date); err != nil {
+		return err
+	}
+	if err := config.DB.Delete(&holiday).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to delete holiday")
+	}
+	return c.JSON(fiber.Map{"message": "Holiday deleted"})
+}
+
+// ImportHolidays adds the all day events of an iCalendar (.ics) file as holidays, sent as the
+// multipart "file" field or as the raw request body. Events on existing holidays rename them.
+// Days in closed or paid attendance periods are skipped, their payroll is already settled.
+func ImportHolidays(c *fiber.Ctx) error {
+	admin, err := GetUserProfile(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnauthorized, "Unauthorized")
+	}
+
+	source := "import.ics"
+	var data []byte
+	if file, err := c.FormFile("file"); err == nil {
+		f, err := file.Open()
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Could not read uploaded file")
+		}
+		defer f.Close()
+		if data, err = io.ReadAll(f); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Could not read uploaded file")
+		}
+		source = file.Filename
+	} else {
+		data = c.Body()
+	}
+	if len(data) == 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid input",
+			"instruction": "Upload an iCalendar file as the multipart field \"file\" or send it as a text/calendar body",
+		})
+	}
+
+	events, err := ical.Parse(bytes.NewReader(data))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid iCalendar file: "+err.Error())
+	}
+
+	var holidays []models.Holiday
+	var skipped []string
+	for _, e := range events {
+		name := strings.TrimSpace(e.Summary)
+		if name == "" {
+			name = "Holiday"
+		}
+		closed, err := settledPeriods(config.DB, e.Start, e.End.AddDate(0, 0, -1))
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Could not check attendance period")
+		}
+		for _, day := range e.Days() {
+			if slices.ContainsFunc(closed, func(p models.AttendancePeriod) bool { return p.Contains(day) }) {
+				skipped = append(skipped, day.Format("2006-01-02"))
+				continue
+			}
+			holidays = append(holidays, models.Holiday{Date: day, Name: name, Source: source, CreatedBy: admin.ID})
+		}
+	}
+	if len(holidays) > 0 {
+		if err := upsertHolidays(config.DB, holidays); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to save holidays")
+		}
+	}
+	return c.JSON(fiber.Map{
+		"message":  "Holidays imported",
+		"imported": len(holidays),
+		"skipped":  skipped,
+	})
+}
+
+// settledPeriods lists the closed and paid attendance periods overlapping a range of dates
+func settledPeriods(db *gorm.DB, from, to time.Time) ([]models.AttendancePeriod, error) {
+	var periods []models.AttendancePeriod
+	err := db.Where("status IN ? AND start_date <= ? AND end_date >= ?",
+		[]string{models.PeriodStatusClosed, models.PeriodStatusPaid}, to, from).Find(&periods).Error
+	return periods, err
+}
+
+// upsertHolidays saves holidays, renaming the ones already on the same date
+func upsertHolidays(db *gorm.DB, holidays []models.Holiday) error {
+	// A file may list the same day twice, the last name wins
+	byDate := map[string]int{}
+	var unique []models.Holiday
+	for _, h := range holidays {
+		key := h.Date.Format("2006-01-02")
+		if i, ok := byDate[key]; ok {
+			unique[i] = h
+			continue
+		}
+		byDate[key] = len(unique)
+		unique = append(unique, h)
+	}
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "date"}},
+		DoUpdates: clause.AssignmentColumns([]string{"name", "source", "updated_at"}),
+	}).Create(&unique).Error
+}
@@ -0,0 +1,287 @@
+// controllers/clock.go
+package controllers
+
+import (
+	"errors"
+	"go-payroll/config"
+	"go-payroll/models"
+	"go-payroll/payroll"
+	"go-payroll/utils"
+	"math"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// staleClockIn is how long a clock-in stays open for clocking out; older ones need an attendance correction
+const staleClockIn = 24 * time.Hour
+
+// errAttendanceExists refuses a second attendance of a user on a date
+var errAttendanceExists = fiber.NewError(fiber.StatusBadRequest, "Attendance already submitted for this date")
+
+// saveAttendanceError turns the error of creating an attendance into a response. The unique index on user
+// and date refuses the second of two requests that both passed checkAttendanceDay.
+func saveAttendanceError(err error) error {
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return errAttendanceExists
+	}
+	return fiber.NewError(fiber.StatusInternalServerError, "Could not save attendance")
+}
+
+// maxClockOvertimeHours caps the overtime derived from a clock-out, like the limit on submitted overtime
+const maxClockOvertimeHours = 3
+
+// checkWorkingDay rejects attendance on a day off in the user's schedule, on a public holiday unless
+// HOLIDAY_ATTENDANCE=flag, or on approved leave. It returns the name of the holiday on the date, empty on
+// a normal working day.
+func checkWorkingDay(db *gorm.DB, userID uint, date time.Time) (string, error) {
+	cal, err := loadCalendar(db, userID, date, date)
+	if err != nil {
+		return "", fiber.NewError(fiber.StatusInternalServerError, "Could not load work schedule")
+	}
+	if !cal.IsScheduled(date) {
+		return "", fiber.NewError(fiber.StatusBadRequest, "Cannot submit attendance on a day off in your work schedule")
+	}
+	holiday := cal.Holidays[date.Format("2006-01-02")]
+	if holiday != "" && !flagHolidayAttendance() {
+		return "", fiber.NewError(fiber.StatusBadRequest, "Cannot submit attendance on a public holiday ("+holiday+")")
+	}
+	var count int64
+	db.Model(&models.LeaveDay{}).Where("user_id = ? AND date = ?", userID, date).Count(&count)
+	if count > 0 {
+		return "", fiber.NewError(fiber.StatusBadRequest, "You are on approved leave on this date")
+	}
+	return holiday, nil
+}
+
+// checkAttendanceDay runs checkWorkingDay and also rejects dates in a closed period and a second
+// attendance on the same day
+func checkAttendanceDay(db *gorm.DB, userID uint, date time.Time) (string, error) {
+	holiday, err := checkWorkingDay(db, userID, date)
+	if err != nil {
+		return "", err
+	}
+	if err := checkPeriodOpen(db, date); err != nil {
+		return "", err
+	}
+	var count int64
+	db.Model(&models.Attendance{}).Where("user_id = ? AND date = ?", userID, date).Count(&count)
+	if count > 0 {
+		return "", errAttendanceExists
+	}
+	return holiday, nil
+}
+
+// shift is a scheduled working day in the schedule's time zone
+type shift struct {
+	Start, End  time.Time // zero for flexible hours
+	HoursPerDay float64
+	Location    *time.Location
+}
+
+// shiftOn returns the shift of a schedule on a date; a shift ending before it starts ends the next day.
+// Without a schedule the day has flexible hours of the payroll default length.
+func shiftOn(schedule *models.WorkSchedule, date time.Time) shift {
+	s := shift{HoursPerDay: float64(payroll.DefaultRules.HoursPerDay), Location: time.UTC}
+	if schedule == nil {
+		return s
+	}
+	s.HoursPerDay = schedule.HoursPerDay
+	// Time zones and shift times are validated when the schedule is saved
+	if loc, err := time.LoadLocation(schedule.Timezone); err == nil {
+		s.Location = loc
+	}
+	if schedule.ShiftStart == "" {
+		return s
+	}
+	at := func(clock string) time.Time {
+		t, _ := time.Parse("15:04", clock)
+		return time.Date(date.Year(), date.Month(), date.Day(), t.Hour(), t.Minute(), 0, 0, s.Location)
+	}
+	s.Start, s.End = at(schedule.ShiftStart), at(schedule.ShiftEnd)
+	if !s.End.After(s.Start) {
+		s.End = s.End.AddDate(0, 0, 1)
+	}
+	return s
+}
+
+// stamp sets the worked hours and the late and early flags of an attendance from its clock times
+func (s shift) stamp(a *models.Attendance) {
+	a.Late = a.ClockIn != nil && !s.Start.IsZero() && a.ClockIn.After(s.Start)
+	a.LeftEarly = a.ClockOut != nil && !s.End.IsZero() && a.ClockOut.Before(s.End)
+	a.WorkedHours = 0
+	if a.ClockIn != nil && a.ClockOut != nil {
+		a.WorkedHours = math.Round(a.ClockOut.Sub(*a.ClockIn).Hours()*100) / 100
+	}
+}
+
+// flexibleDayEnd is when a day of flexible hours is over, for submitting its overtime
+const flexibleDayEnd = 17 * time.Hour
+
+// over is when the shift of a date is over: the shift end, or flexibleDayEnd in the schedule's time zone
+// for flexible hours
+func (s shift) over(date time.Time) time.Time {
+	if !s.End.IsZero() {
+		return s.End
+	}
+	return time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, s.Location).Add(flexibleDayEnd)
+}
+
+// overtimeHours is the time worked past the shift end, or past the scheduled hours for flexible hours,
+// rounded down to quarter hours and capped at maxClockOvertimeHours
+func (s shift) overtimeHours(clockIn, clockOut time.Time) float64 {
+	extra := clockOut.Sub(clockIn) - time.Duration(s.HoursPerDay*float64(time.Hour))
+	if !s.End.IsZero() {
+		extra = clockOut.Sub(s.End)
+	}
+	hours := math.Floor(extra.Minutes()/15) / 4
+	return math.Max(0, math.Min(hours, maxClockOvertimeHours))
+}
+
+// syncClockOvertime records the time an attendance was worked past its shift as clock overtime pending
+// approval, and returns its hours. Clock overtime already recorded for the day takes the new hours and goes
+// back to pending, or is removed when there is none left; rejected clock overtime and overtime submitted
+// for the day are left as they are.
+func syncClockOvertime(tx *gorm.DB, attendance models.Attendance, s shift, by uint, ip string) (float64, error) {
+	hours := 0.0
+	if attendance.ClockIn != nil && attendance.ClockOut != nil {
+		hours = s.overtimeHours(*attendance.ClockIn, *attendance.ClockOut)
+	}
+	var existing []models.Overtime
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("user_id = ? AND date = ?", attendance.UserID, attendance.Date).
+		Find(&existing).Error
+	if err != nil {
+		return 0, err
+	}
+	if len(existing) == 0 {
+		if hours == 0 {
+			return 0, nil
+		}
+		return hours, tx.Create(&models.Overtime{
+			UserID:    attendance.UserID,
+			Date:      attendance.Date,
+			Hours:     hours,
+			Source:    models.OvertimeSourceClock,
+			Status:    models.OvertimeStatusPending,
+			CreatedBy: by,
+			IPAddress: ip,
+		}).Error
+	}
+	overtime := existing[0]
+	if len(existing) > 1 || overtime.Source != models.OvertimeSourceClock || overtime.Status == models.OvertimeStatusRejected {
+		return 0, nil
+	}
+	if hours == 0 {
+		return 0, tx.Delete(&overtime).Error
+	}
+	if overtime.Hours == hours {
+		return hours, nil
+	}
+	return hours, tx.Model(&overtime).Updates(map[string]interface{}{
+		"hours":          hours,
+		"status":         models.OvertimeStatusPending,
+		"reviewed_by":    0,
+		"reviewed_at":    nil,
+		"review_comment": "",
+		"updated_by":     by,
+	}).Error
+}
+
+// ClockIn starts today's attendance of the logged in employee, flagged late after the scheduled shift start
+func ClockIn(c *fiber.Ctx) error {
+	user, err := GetUserProfile(c)
+	if err != nil {
+		return err
+	}
+	schedule, err := loadWorkSchedule(config.DB, user.ID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Could not load work schedule")
+	}
+
+	// The working day is the date in the schedule's time zone, stored at midnight UTC like submitted dates
+	now := time.Now().In(shiftOn(schedule, time.Now()).Location)
+	date := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	holiday, err := checkAttendanceDay(config.DB, user.ID, date)
+	if err != nil {
+		return err
+	}
+
+	s := shiftOn(schedule, date)
+	attendance := models.Attendance{
+		UserID:    user.ID,
+		Date:      date,
+		ClockIn:   &now,
+		Holiday:   holiday != "",
+		CreatedBy: user.ID,
+		IPAddress: utils.GetIPAddress(c),
+	}
+	s.stamp(&attendance)
+	if err := config.DB.Create(&attendance).Error; err != nil {
+		return saveAttendanceError(err)
+	}
+	response := fiber.Map{"message": "Clocked in", "attendance": attendance}
+	if holiday != "" {
+		response["holiday"] = holiday
+	}
+	var stale models.Attendance
+	err = config.DB.Where("user_id = ? AND clock_in IS NOT NULL AND clock_out IS NULL AND clock_in < ?", user.ID, now.Add(-staleClockIn)).
+		Order("clock_in DESC").First(&stale).Error
+	if err == nil {
+		response["note"] = "You never clocked out on " + stale.Date.Format("2006-01-02") +
+			", request an attendance correction with its clock_in and clock_out at /api/employee/attendance-corrections"
+	}
+	return c.JSON(response)
+}
+
+// ClockOut ends the open attendance of the logged in employee. It records the worked hours, flags leaving
+// before the scheduled shift end and records time past the shift end as overtime pending approval, unless
+// overtime was already submitted for the day.
+func ClockOut(c *fiber.Ctx) error {
+	user, err := GetUserProfile(c)
+	if err != nil {
+		return err
+	}
+
+	// Clock-ins left open for longer are stale, they are closed with an attendance correction and do not
+	// stop the employee from clocking out of a newer one
+	var attendance models.Attendance
+	err = config.DB.Where("user_id = ? AND clock_in IS NOT NULL AND clock_out IS NULL AND clock_in >= ?", user.ID, time.Now().Add(-staleClockIn)).
+		Order("clock_in DESC").First(&attendance).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		var stale models.Attendance
+		if config.DB.Where("user_id = ? AND clock_in IS NOT NULL AND clock_out IS NULL", user.ID).Order("clock_in DESC").First(&stale).Error == nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Your clock-in on "+stale.Date.Format("2006-01-02")+
+				" is more than 24 hours old, request an attendance correction with its clock_in and clock_out instead")
+		}
+		return fiber.NewError(fiber.StatusBadRequest, "You are not clocked in")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Could not load attendance")
+	}
+	now := time.Now().In(attendance.ClockIn.Location())
+	if err := checkPeriodOpen(config.DB, attendance.Date); err != nil {
+		return err
+	}
+	schedule, err := loadWorkSchedule(config.DB, user.ID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Could not load work schedule")
+	}
+
+	s := shiftOn(schedule, attendance.Date)
+	attendance.ClockOut = &now
+	s.stamp(&attendance)
+	var overtimeHours float64
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Select("clock_out", "worked_hours", "left_early").Updates(&attendance).Error; err != nil {
+			return err
+		}
+		overtimeHours, err = syncClockOvertime(tx, attendance, s, user.ID, utils.GetIPAddress(c))
+		return err
+	})
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Could not save attendance")
+	}
+	return c.JSON(fiber.Map{"message": "Clocked out", "attendance": attendance, "overtime_hours": overtimeHours})
+}
@@ -0,0 +1,105 @@
+package controllers
+
+import (
+	"go-payroll/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShiftOvertimeHours(t *testing.T) {
+	day := time.Date(2025, 1, 6, 0, 0, 0, 0, time.UTC)
+	office := shiftOn(&models.WorkSchedule{HoursPerDay: 8, ShiftStart: "09:00", ShiftEnd: "17:00", Timezone: "UTC"}, day)
+	night := shiftOn(&models.WorkSchedule{HoursPerDay: 8, ShiftStart: "22:00", ShiftEnd: "06:00", Timezone: "UTC"}, day)
+	flexible := shiftOn(&models.WorkSchedule{HoursPerDay: 7.5, Timezone: "UTC"}, day)
+	at := func(hour, minute int) time.Time {
+		return day.Add(time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute)
+	}
+
+	tests := []struct {
+		name      string
+		shift     shift
+		in, out   time.Time
+		wantHours float64
+	}{
+		{"leaving at the shift end is no overtime", office, at(9, 0), at(17, 0), 0},
+		{"leaving early is no overtime", office, at(9, 0), at(16, 0), 0},
+		{"less than a quarter hour is dropped", office, at(9, 0), at(17, 14), 0},
+		{"a quarter hour counts", office, at(9, 0), at(17, 15), 0.25},
+		{"overtime rounds down to quarter hours", office, at(9, 0), at(19, 40), 2.5},
+		{"overtime is past the shift end, not past the hours worked", office, at(11, 0), at(18, 0), 1},
+		{"overtime is capped", office, at(9, 0), at(23, 0), maxClockOvertimeHours},
+		{"a night shift ends the next day", night, at(22, 0), at(31, 0), 1},
+		{"a night shift is not over at midnight", night, at(22, 0), at(24, 30), 0},
+		{"flexible hours count past the scheduled hours", flexible, at(8, 0), at(17, 0), 1.5},
+		{"flexible hours short of the scheduled hours", flexible, at(8, 0), at(15, 0), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.shift.overtimeHours(tt.in, tt.out); got != tt.wantHours {
+				t.Errorf("overtimeHours = %v, want %v", got, tt.wantHours)
+			}
+		})
+	}
+}
+
+func TestShiftOnWithoutSchedule(t *testing.T) {
+	s := shiftOn(nil, time.Date(2025, 1, 6, 0, 0, 0, 0, time.UTC))
+	if !s.Start.IsZero() || !s.End.IsZero() || s.HoursPerDay != 8 || s.Location != time.UTC {
+		t.Errorf("shiftOn(nil) = %+v, want flexible 8 hours in UTC", s)
+	}
+}
+
+func TestShiftOver(t *testing.T) {
+	day := time.Date(2025, 1, 6, 0, 0, 0, 0, time.UTC)
+	jakarta, err := time.LoadLocation("Asia/Jakarta")
+	if err != nil {
+		t.Skip("no time zone data")
+	}
+	tests := []struct {
+		name     string
+		schedule *models.WorkSchedule
+		want     time.Time
+	}{
+		{"a shift is over at its end", &models.WorkSchedule{HoursPerDay: 8, ShiftStart: "08:00", ShiftEnd: "16:00", Timezone: "Asia/Jakarta"},
+			time.Date(2025, 1, 6, 16, 0, 0, 0, jakarta)},
+		{"a night shift is over the next day", &models.WorkSchedule{HoursPerDay: 8, ShiftStart: "22:00", ShiftEnd: "06:00", Timezone: "UTC"},
+			time.Date(2025, 1, 7, 6, 0, 0, 0, time.UTC)},
+		{"flexible hours are over at 5 PM in the schedule's time zone", &models.WorkSchedule{HoursPerDay: 8, Timezone: "Asia/Jakarta"},
+			time.Date(2025, 1, 6, 17, 0, 0, 0, jakarta)},
+		{"without a schedule the day is over at 5 PM UTC", nil, time.Date(2025, 1, 6, 17, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := shiftOn(tt.schedule, day).over(day); !got.Equal(tt.want) {
+				t.Errorf("over = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// An approved correction must record the overtime of its clock times like a clock-out does
+func TestSyncClockOvertimeRecordsNewOvertime(t *testing.T) {
+	day := time.Date(2025, 1, 6, 0, 0, 0, 0, time.UTC)
+	s := shiftOn(&models.WorkSchedule{HoursPerDay: 8, ShiftStart: "09:00", ShiftEnd: "17:00", Timezone: "UTC"}, day)
+	in, out := day.Add(9*time.Hour), day.Add(19*time.Hour)
+
+	db, recorder := dryRunDB(t)
+	hours, err := syncClockOvertime(db, models.Attendance{UserID: 5, Date: day, ClockIn: &in, ClockOut: &out}, s, 1, "")
+	if err != nil {
+		t.Fatalf("syncClockOvertime: %v", err)
+	}
+	statements := recorder.take()
+	if hours != 2 || len(statements) != 2 || !strings.HasSuffix(statements[0], "FOR UPDATE") ||
+		!strings.HasPrefix(statements[1], `INSERT INTO "overtimes"`) {
+		t.Errorf("got %v hours with %q, want 2 hours inserted", hours, statements)
+	}
+
+	early := day.Add(16 * time.Hour)
+	if hours, err := syncClockOvertime(db, models.Attendance{UserID: 5, Date: day, ClockIn: &in, ClockOut: &early}, s, 1, ""); err != nil || hours != 0 {
+		t.Errorf("got %v hours, %v, want none", hours, err)
+	}
+	if statements := recorder.take(); len(statements) != 1 {
+		t.Errorf("got %q, want only the lookup", statements)
+	}
+}
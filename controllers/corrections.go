@@ -0,0 +1,252 @@
+// controllers/corrections.go
+package controllers
+
+import (
+	"errors"
+	"go-payroll/config"
+	"go-payroll/models"
+	"go-payroll/utils"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// correctionTimes turns the HH:MM clock times of a correction into timestamps on the date in the
+// schedule's time zone; a clock-out not after the clock-in is on the next day
+func correctionTimes(s shift, date time.Time, clockIn, clockOut string) (*time.Time, *time.Time, error) {
+	if clockIn == "" && clockOut == "" {
+		return nil, nil, nil
+	}
+	if clockIn == "" || clockOut == "" {
+		return nil, nil, fiber.NewError(fiber.StatusBadRequest, "clock_in and clock_out are sent together")
+	}
+	at := func(clock string) (time.Time, error) {
+		t, err := time.Parse("15:04", clock)
+		if err != nil {
+			return time.Time{}, fiber.NewError(fiber.StatusBadRequest, "clock_in and clock_out should be HH:MM")
+		}
+		return time.Date(date.Year(), date.Month(), date.Day(), t.Hour(), t.Minute(), 0, 0, s.Location), nil
+	}
+	in, err := at(clockIn)
+	if err != nil {
+		return nil, nil, err
+	}
+	out, err := at(clockOut)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !out.After(in) {
+		out = out.AddDate(0, 0, 1)
+	}
+	if out.After(time.Now()) {
+		return nil, nil, fiber.NewError(fiber.StatusBadRequest, "clock_out cannot be in the future")
+	}
+	return &in, &out, nil
+}
+
+// RequestAttendanceCorrection asks to record a missed day or fix the clock times of a day, applied once a
+// manager or admin approves it
+func RequestAttendanceCorrection(c *fiber.Ctx) error {
+	type payload struct {
+		Date     string `json:"date"`
+		ClockIn  string `json:"clock_in"`
+		ClockOut string `json:"clock_out"`
+		Reason   string `json:"reason"`
+	}
+	var body payload
+	if err := c.BodyParser(&body); err != nil || strings.TrimSpace(body.Reason) == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid input",
+			"instruction": "date (YYYY-MM-DD) and reason are required; clock_in and clock_out (HH:MM) are optional",
+		})
+	}
+
+	user, err := GetUserProfile(c)
+	if err != nil {
+		return err
+	}
+	date, err := time.Parse("2006-01-02", body.Date)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid date format (YYYY-MM-DD)"})
+	}
+	if date.After(today()) {
+		return c.Status(400).JSON(fiber.Map{"error": "Cannot correct attendance in the future"})
+	}
+	if err := checkPeriodOpen(config.DB, date); err != nil {
+		return err
+	}
+
+	var existing models.Attendance
+	err = config.DB.Where("user_id = ? AND date = ?", user.ID, date).First(&existing).Error
+	found := err == nil
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not load attendance"})
+	}
+	if !found {
+		if _, err := checkWorkingDay(config.DB, user.ID, date); err != nil {
+			return err
+		}
+	}
+
+	schedule, err := loadWorkSchedule(config.DB, user.ID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not load work schedule"})
+	}
+	clockIn, clockOut, err := correctionTimes(shiftOn(schedule, date), date, body.ClockIn, body.ClockOut)
+	if err != nil {
+		return err
+	}
+	if found && clockIn == nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Attendance is already recorded for this date, send clock_in and clock_out to correct its times"})
+	}
+
+	var pending int64
+	config.DB.Model(&models.AttendanceCorrection{}).
+		Where("user_id = ? AND date = ? AND status = ?", user.ID, date, models.CorrectionStatusPending).Count(&pending)
+	if pending > 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "A correction for this date is already waiting for approval"})
+	}
+
+	correction := models.AttendanceCorrection{
+		UserID:    user.ID,
+		Date:      date,
+		ClockIn:   clockIn,
+		ClockOut:  clockOut,
+		Reason:    strings.TrimSpace(body.Reason),
+		Status:    models.CorrectionStatusPending,
+		CreatedBy: user.ID,
+		IPAddress: utils.GetIPAddress(c),
+	}
+	if err := config.DB.Create(&correction).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not save attendance correction"})
+	}
+	return c.JSON(fiber.Map{"message": "Attendance correction submitted for approval", "attendance_correction": correction})
+}
+
+// ListMyAttendanceCorrections lists the attendance corrections of the logged in employee
+func ListMyAttendanceCorrections(c *fiber.Ctx) error {
+	user, err := GetUserProfile(c)
+	if err != nil {
+		return err
+	}
+	var corrections []models.AttendanceCorrection
+	if err := config.DB.Where("user_id = ?", user.ID).Order("date DESC").Find(&corrections).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not load attendance corrections"})
+	}
+	return c.JSON(fiber.Map{"attendance_corrections": corrections})
+}
+
+// ListAttendanceCorrections lists attendance corrections, optionally filtered by status and employee
+func ListAttendanceCorrections(c *fiber.Ctx) error {
+	q := config.DB.Scopes(teamScope(c)).Order("date DESC")
+	if status := c.Query("status"); status != "" {
+		q = q.Where("status = ?", status)
+	}
+	if employeeID := c.QueryInt("employee_id"); employeeID > 0 {
+		q = q.Where("user_id = ?", employeeID)
+	}
+	var corrections []models.AttendanceCorrection
+	if err := q.Find(&corrections).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch attendance corrections")
+	}
+	return c.JSON(fiber.Map{"attendance_corrections": corrections})
+}
+
+// reviewCorrection approves or rejects a pending attendance correction. Approval creates the attendance
+// of the day or replaces its clock times and updates the clock overtime they give; days in closed or paid
+// periods can no longer be corrected.
+func reviewCorrection(c *fiber.Ctx, status string) error {
+	type Input struct {
+		Comment string `json:"comment"`
+	}
+	var input Input
+	if err := parseOptionalBody(c, &input); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid input",
+			"instruction": "Send the optional comment as JSON",
+		})
+	}
+
+	reviewer, err := GetUserProfile(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnauthorized, "Unauthorized")
+	}
+
+	var correction models.AttendanceCorrection
+	var overtimeHours float64
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Scopes(teamScope(c)).Clauses(clause.Locking{Strength: "UPDATE"}).First(&correction, c.Params("id")).Error; err != nil {
+			return fiber.NewError(fiber.StatusNotFound, "Attendance correction not found")
+		}
+		if correction.Status != models.CorrectionStatusPending {
+			return fiber.NewError(fiber.StatusBadRequest, "Attendance correction is already "+correction.Status)
+		}
+
+		if status == models.CorrectionStatusApproved {
+			// The share lock waits for a payroll run holding the period, which then finds it paid
+			if err := checkPeriodOpen(tx.Clauses(clause.Locking{Strength: "SHARE"}), correction.Date); err != nil {
+				return err
+			}
+
+			var attendance models.Attendance
+			err = tx.Where("user_id = ? AND date = ?", correction.UserID, correction.Date).First(&attendance).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				holiday, err := checkWorkingDay(tx, correction.UserID, correction.Date)
+				if err != nil {
+					return err
+				}
+				attendance = models.Attendance{
+					UserID:    correction.UserID,
+					Date:      correction.Date,
+					Holiday:   holiday != "",
+					CreatedBy: reviewer.ID,
+					IPAddress: utils.GetIPAddress(c),
+				}
+			} else if err != nil {
+				return fiber.NewError(fiber.StatusInternalServerError, "Could not load attendance")
+			}
+			if attendance.PayrollProcessedID != 0 {
+				return fiber.NewError(fiber.StatusBadRequest, "Attendance on this date is already paid")
+			}
+
+			schedule, err := loadWorkSchedule(tx, correction.UserID)
+			if err != nil {
+				return fiber.NewError(fiber.StatusInternalServerError, "Could not load work schedule")
+			}
+			attendance.ClockIn, attendance.ClockOut = correction.ClockIn, correction.ClockOut
+			s := shiftOn(schedule, correction.Date)
+			s.stamp(&attendance)
+			if err := tx.Save(&attendance).Error; err != nil {
+				return saveAttendanceError(err)
+			}
+			correction.AttendanceID = attendance.ID
+			if overtimeHours, err = syncClockOvertime(tx, attendance, s, reviewer.ID, utils.GetIPAddress(c)); err != nil {
+				return fiber.NewError(fiber.StatusInternalServerError, "Could not save overtime")
+			}
+		}
+
+		now := time.Now()
+		correction.Status = status
+		correction.ReviewedBy = reviewer.ID
+		correction.ReviewedAt = &now
+		correction.ReviewComment = input.Comment
+		return tx.Select("status", "attendance_id", "reviewed_by", "reviewed_at", "review_comment").Updates(&correction).Error
+	})
+	if err != nil {
+		return err
+	}
+	return c.JSON(fiber.Map{"message": "Attendance correction " + status, "attendance_correction": correction, "overtime_hours": overtimeHours})
+}
+
+// ApproveAttendanceCorrection approves a pending correction and applies it to the attendance
+func ApproveAttendanceCorrection(c *fiber.Ctx) error {
+	return reviewCorrection(c, models.CorrectionStatusApproved)
+}
+
+// RejectAttendanceCorrection rejects a pending correction
+func RejectAttendanceCorrection(c *fiber.Ctx) error {
+	return reviewCorrection(c, models.CorrectionStatusRejected)
+}
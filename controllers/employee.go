@@ -2,12 +2,20 @@
 package controllers
 
 import (
+	"fmt"
 	"go-payroll/config"
+	"go-payroll/export"
 	"go-payroll/models"
+	"go-payroll/money"
+	"go-payroll/payroll"
 	"go-payroll/utils"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 func SubmitAttendance(c *fiber.Ctx) error {
@@ -32,15 +40,9 @@ func SubmitAttendance(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid date format (YYYY-MM-DD)"})
 	}
 
-	weekday := date.Weekday()
-	if weekday == time.Saturday || weekday == time.Sunday {
-		return c.Status(400).JSON(fiber.Map{"error": "Cannot submit attendance on weekends"})
-	}
-
-	exists := models.Attendance{}
-	err = config.DB.Where("user_id = ? AND date = ?", user.ID, date).First(&exists).Error
-	if err == nil {
-		return c.Status(400).JSON(fiber.Map{"error": "Attendance already submitted for this date"})
+	holiday, err := checkAttendanceDay(config.DB, user.ID, date)
+	if err != nil {
+		return err
 	}
 
 	attendance := models.Attendance{
@@ -48,11 +50,15 @@ func SubmitAttendance(c *fiber.Ctx) error {
 		Date:      date,
 		CreatedBy: user.ID,
 		IPAddress: utils.GetIPAddress(c),
+		Holiday:   holiday != "",
 	}
 	if err := config.DB.Create(&attendance).Error; err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Could not save attendance"})
+		return saveAttendanceError(err)
 	}
 
+	if holiday != "" {
+		return c.JSON(fiber.Map{"message": "Attendance submitted", "holiday": holiday})
+	}
 	return c.JSON(fiber.Map{"message": "Attendance submitted"})
 }
 
@@ -80,14 +86,28 @@ func SubmitOvertime(c *fiber.Ctx) error {
 	if body.Hours > 3 || body.Hours <= 0 {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid number of overtime hours (1-3 allowed)"})
 	}
-	// Optional: check if submission is after 5PM
-	if time.Now().Hour() < 17 {
-		return c.Status(400).JSON(fiber.Map{"error": "Overtime can only be submitted after working hours (5PM)"})
+	if err := checkPeriodOpen(config.DB, date); err != nil {
+		return err
+	}
+	schedule, err := loadWorkSchedule(config.DB, user.ID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not load work schedule"})
+	}
+	// Overtime is submitted once the day's shift is over, in the schedule's time zone
+	if over := shiftOn(schedule, date).over(date); time.Now().Before(over) {
+		return c.Status(400).JSON(fiber.Map{"error": "Overtime can only be submitted after working hours (" + over.Format("2006-01-02 15:04 MST") + ")"})
+	}
+	var derived int64
+	config.DB.Model(&models.Overtime{}).Where("user_id = ? AND date = ? AND source = ?", user.ID, date, models.OvertimeSourceClock).Count(&derived)
+	if derived > 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "Overtime for this date was already recorded from your clock-out"})
 	}
 	overtime := models.Overtime{
 		UserID:    user.ID,
 		Date:      date,
 		Hours:     body.Hours,
+		Source:    models.OvertimeSourceManual,
+		Status:    models.OvertimeStatusPending,
 		CreatedBy: user.ID,
 		IPAddress: utils.GetIPAddress(c),
 	}
@@ -95,20 +115,30 @@ func SubmitOvertime(c *fiber.Ctx) error {
 		return c.Status(500).JSON(fiber.Map{"error": "Could not save overtime"})
 	}
 
-	return c.JSON(fiber.Map{"message": "Overtime submitted"})
+	return c.JSON(fiber.Map{"message": "Overtime submitted for approval", "overtime": overtime})
 }
 
+// SubmitReimbursement files a reimbursement claim for approval. It is sent as JSON, or as a multipart form
+// with the receipt file in the "receipt" field.
 func SubmitReimbursement(c *fiber.Ctx) error {
 	type payload struct {
-		Amount float64 `json:"amount"`
-		Desc   string  `json:"desc"`
-		Date	 string  `json:"date"` // Optional date field
+		Amount   money.Money `json:"amount"`
+		Desc     string      `json:"desc"`
+		Date     string      `json:"date"`
+		Category string      `json:"category"` // category code
 	}
+	instruction := "amount should be a positive number, desc should not be empty, date (YYYY-MM-DD) of the expense and category are required; a receipt can be sent as the multipart field \"receipt\""
 	var body payload
-	if err := c.BodyParser(&body); err != nil {
+	if strings.HasPrefix(string(c.Request().Header.ContentType()), fiber.MIMEMultipartForm) {
+		amount, err := money.Parse(c.FormValue("amount"))
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid input", "instruction": instruction})
+		}
+		body = payload{Amount: amount, Desc: c.FormValue("desc"), Date: c.FormValue("date"), Category: c.FormValue("category")}
+	} else if err := c.BodyParser(&body); err != nil {
 		return c.Status(400).JSON(fiber.Map{
 			"error": "Invalid input",
-			"instruction": "Amount should be a positive number, description should not be empty, and date should be in YYYY-MM-DD format",
+			"instruction": instruction,
 		})
 	}
 
@@ -117,31 +147,82 @@ func SubmitReimbursement(c *fiber.Ctx) error {
 		return err
 	}
 
+	if !body.Amount.IsPositive() {
+		return c.Status(400).JSON(fiber.Map{"error": "Amount should be a positive number"})
+	}
+	if strings.TrimSpace(body.Desc) == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "Description should not be empty"})
+	}
+	if body.Date == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "Date of the expense is required (YYYY-MM-DD)"})
+	}
+	date, err := time.Parse("2006-01-02", body.Date)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid date format (YYYY-MM-DD)"})
+	}
+	if date.After(today()) {
+		return c.Status(400).JSON(fiber.Map{"error": "Date of the expense cannot be in the future"})
+	}
+	if err := checkPeriodOpen(config.DB, date); err != nil {
+		return err
+	}
+	var category models.ReimbursementCategory
+	if err := config.DB.Where("code = ? AND active = ?", strings.ToLower(strings.TrimSpace(body.Category)), true).First(&category).Error; err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Unknown reimbursement category, see GET /api/employee/reimbursement-categories"})
+	}
+
 	reimbursement := models.Reimbursement{
-		UserID:    user.ID,
-		Amount:    body.Amount,
-		Desc:      body.Desc,
-		CreatedBy: user.ID,
-		IPAddress: utils.GetIPAddress(c),
+		UserID:     user.ID,
+		Amount:     body.Amount,
+		Desc:       strings.TrimSpace(body.Desc),
+		Date:       date,
+		CategoryID: category.ID,
+		Status:     models.ReimbursementStatusPending,
+		CreatedBy:  user.ID,
+		IPAddress:  utils.GetIPAddress(c),
 	}
-	if err := config.DB.Create(&reimbursement).Error; err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Could not save reimbursement"})
+	receipt, err := saveReceipt(c, user.ID)
+	if err != nil {
+		return err
+	}
+	if receipt != nil {
+		reimbursement.ReceiptKey, reimbursement.ReceiptName, reimbursement.ReceiptContentType = receipt.Key, receipt.Name, receipt.ContentType
+	}
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		// Claims of an employee are checked one at a time, or two sent together could both fit under the monthly limit
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&models.User{}, user.ID).Error; err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Could not save reimbursement")
+		}
+		if err := checkClaimLimits(tx, category, reimbursement); err != nil {
+			return err
+		}
+		if err := tx.Create(&reimbursement).Error; err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Could not save reimbursement")
+		}
+		return nil
+	})
+	if err != nil {
+		if receipt != nil {
+			config.Receipts.Delete(receipt.Key)
+		}
+		return err
 	}
 
-	return c.JSON(fiber.Map{"message": "Reimbursement submitted"})
+	response := fiber.Map{"message": "Reimbursement submitted for approval", "reimbursement": reimbursement}
+	if category.ReceiptRequired && receipt == nil {
+		response["note"] = category.Name + " claims need a receipt before approval, upload it to /api/employee/reimbursements/" +
+			strconv.FormatUint(uint64(reimbursement.ID), 10) + "/receipt"
+	}
+	return c.JSON(response)
 }
 
 
 
 func GeneratePayslip(c *fiber.Ctx) error {
 	/**
-		RULES:
+		RULES: see payroll.Calculate
 		- Employees view only their own payslip
-		- Daily rate = Base Salary / 20 days
-		- Base Salary = Attendance Days * Daily Rate
-		- Overtime Pay = 2 * (Daily Rate / 8 hours) * Overtime Hours
-		- Reimbursement Total = SUM of reimbursements in the period
-		- Take Home Pay = Base Salary + Overtime Pay + Reimbursement
+		- Only records not yet included in a payroll run are counted
 	**/
 
 	user, err := GetUserProfile(c)
@@ -149,52 +230,228 @@ func GeneratePayslip(c *fiber.Ctx) error {
 		return err
 	}
 
-	baseSalary := user.Salary
-	dailyRate := baseSalary / 20
+	records, err := loadUnpaidRecords(config.DB, user.ID, nil, false)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not load payroll records"})
+	}
+	b, err := records.calculate(*user)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not calculate payslip: " + err.Error()})
+	}
 
-	// Attendance (unpaid records only: attendance_period_id == 0)
-	var attendanceCount int64
-	config.DB.Model(&models.Attendance{}).
-		Where("user_id = ? AND attendance_period_id = 0", user.ID).
-		Count(&attendanceCount)
+	asPDF, err := wantsPDF(c)
+	if err != nil {
+		return err
+	}
+	if asPDF {
+		pdf := export.RenderPayslipPDF(export.PayslipDocument{
+			CompanyName:    companyName(),
+			EmployeeName:   user.Username,
+			Period:         "Unpaid records as of " + time.Now().Format("2006-01-02"),
+			Breakdown:      b,
+			Reimbursements: reimbursementItems(records.Reimbursements),
+		})
+		return sendPDF(c, payslipPDFName(user.Username, 0), pdf)
+	}
+
+	hoursPerDay := float64(payroll.DefaultRules.HoursPerDay)
+	if records.Calendar.HoursPerDay > 0 {
+		hoursPerDay = records.Calendar.HoursPerDay
+	}
 
-	monthlySalary := float64(attendanceCount) * dailyRate
+	return c.JSON(fiber.Map{
+		"employee_id":       b.UserID,
+		"attendance_days":   b.AttendanceDays,
+		"paid_leave_days":   b.PaidLeaveDays,
+		"unpaid_leave_days": b.UnpaidLeaveDays,
+		"daily_rate":        b.DailyRate,
+		"working_days":      b.WorkingDays,
+		"daily_rate_note":   "Calculated as base_salary_rate ÷ working_days, the days of the month in your work schedule that are not public holidays",
+		"base_salary_total": b.BaseSalary,
+		"base_salary_note":  "Calculated as (attendance_days + paid_leave_days) × daily_rate",
+		"base_salary_rate":  b.SalaryRate,
+		"salary_segments":   b.SalarySegments,
 
-	// Overtime
-	var totalOvertime float64
-	config.DB.Model(&models.Overtime{}).
-		Select("COALESCE(SUM(hours), 0)").
-		Where("user_id = ? AND attendance_period_id = 0", user.ID).
-		Scan(&totalOvertime)
+		"overtime_hours":    b.OvertimeHours,
+		"overtime_pay":      b.OvertimePay,
+		"holiday_overtime_hours": b.HolidayOvertimeHours,
+		"overtime_note": fmt.Sprintf("Calculated as %d × (daily_rate ÷ %g) × overtime_hours, %d × on public holidays",
+			payroll.DefaultRules.OvertimeMultiplier, hoursPerDay, payroll.DefaultRules.HolidayOvertimeMultiplier),
 
-	overtimePay := 2 * (dailyRate / 8) * totalOvertime
+		"components":           b.Components,
+		"component_earnings":   b.ComponentEarnings,
+		"component_deductions": b.ComponentDeductions,
 
-	// Reimbursements
-	var reimbursementTotal float64
-	config.DB.Model(&models.Reimbursement{}).
-		Select("COALESCE(SUM(amount), 0)").
-		Where("user_id = ? AND attendance_period_id = 0", user.ID).
-		Scan(&reimbursementTotal)
+		"gross_pay":         b.GrossPay,
+		"gross_pay_note":    "Calculated as base_salary_total + overtime_pay + component_earnings",
 
-	// Total take home
-	takeHomePay := monthlySalary + overtimePay + reimbursementTotal
+		"contributions":          b.Contributions,
+		"employee_contributions": b.EmployeeContributions,
+		"employer_contributions": b.EmployerContributions,
+		"contributions_note":     "Statutory contributions; the employee share is deducted, the employer share is paid by the company",
 
-	return c.JSON(fiber.Map{
-		"employee_id":       user.ID,
-		"attendance_days":   attendanceCount,
-		"daily_rate":        utils.Round(dailyRate),
-		"base_salary_total": utils.Round(monthlySalary),
-		"base_salary_note":  "Calculated as attendance_days × daily_rate",
-		"base_salary_rate":  utils.Round(baseSalary),
-
-		"overtime_hours":    utils.Round(totalOvertime),
-		"overtime_pay":      utils.Round(overtimePay),
-		"overtime_note":     "Calculated as 2 × (daily_rate ÷ 8) × overtime_hours",
-
-		"reimbursement_total": utils.Round(reimbursementTotal),
-		"reimbursement_note":  "Sum of all reimbursements with no attendance period",
-
-		"take_home_pay":    utils.Round(takeHomePay),
-		"take_home_note":   "Calculated as base_salary_total + overtime_pay + reimbursement_total",
+		"taxable_income":    b.TaxableIncome,
+		"tax_withheld":      b.TaxWithheld,
+		"tax_method":        b.TaxMethod,
+
+		"reimbursement_total": b.ReimbursementTotal,
+		"reimbursement_note":  "Sum of all reimbursements not yet included in a payroll run",
+
+		"take_home_pay":    b.TakeHomePay,
+		"currency":         b.Currency,
+		"take_home_note":   "Calculated as gross_pay - employee_contributions - tax_withheld - component_deductions + reimbursement_total",
 	})
 }
+
+// historicalPayslip is a payslip of a past payroll run
+type historicalPayslip struct {
+	PayrollProcessedID uint              `json:"payroll_processed_id"`
+	RunDate            time.Time         `json:"run_date"`
+	Status             string            `json:"status"`
+	PeriodStart        time.Time         `json:"period_start"`
+	PeriodEnd          time.Time         `json:"period_end"`
+	Reversed           bool              `json:"reversed"`
+	Payslip            payroll.Breakdown `json:"payslip"`
+}
+
+// loadHistoricalPayslips reads the persisted payroll lines of a user, optionally for a single run
+func loadHistoricalPayslips(userID uint, payrollProcessedID uint) ([]historicalPayslip, error) {
+	q := config.DB.Where("user_id = ?", userID)
+	if payrollProcessedID != 0 {
+		q = q.Where("payroll_processed_id = ?", payrollProcessedID)
+	}
+	var lines []models.DailyPayroll
+	if err := q.Order("payroll_processed_id DESC").Find(&lines).Error; err != nil {
+		return nil, err
+	}
+
+	// The runs of the lines and their periods, one query each
+	runs := map[uint]models.PayrollProcessed{}
+	periods := map[uint]models.AttendancePeriod{}
+	var runIDs, periodIDs []uint
+	for _, line := range lines {
+		runIDs = append(runIDs, line.PayrollProcessedID)
+	}
+	var runList []models.PayrollProcessed
+	if len(runIDs) > 0 {
+		if err := config.DB.Where("id IN ?", runIDs).Find(&runList).Error; err != nil {
+			return nil, err
+		}
+	}
+	for _, run := range runList {
+		runs[run.ID] = run
+		periodIDs = append(periodIDs, run.AttendancePeriodID)
+	}
+	var periodList []models.AttendancePeriod
+	if len(periodIDs) > 0 {
+		if err := config.DB.Where("id IN ?", periodIDs).Find(&periodList).Error; err != nil {
+			return nil, err
+		}
+	}
+	for _, period := range periodList {
+		periods[period.ID] = period
+	}
+
+	payslips := []historicalPayslip{}
+	for _, line := range lines {
+		breakdown, err := breakdownFromLine(line)
+		if err != nil {
+			return nil, err
+		}
+		run, ok := runs[line.PayrollProcessedID]
+		if !ok {
+			return nil, fmt.Errorf("payroll run %d not found", line.PayrollProcessedID)
+		}
+		period, ok := periods[run.AttendancePeriodID]
+		if !ok {
+			return nil, fmt.Errorf("attendance period %d of payroll run %d not found", run.AttendancePeriodID, run.ID)
+		}
+
+		payslips = append(payslips, historicalPayslip{
+			PayrollProcessedID: run.ID,
+			RunDate:            run.Date,
+			Status:             run.Status,
+			PeriodStart:        period.StartDate,
+			PeriodEnd:          period.EndDate,
+			Reversed:           line.Reversed,
+			Payslip:            breakdown,
+		})
+	}
+	return payslips, nil
+}
+
+// historicalPayslipDocument prepares a past payslip for rendering
+func historicalPayslipDocument(username string, h historicalPayslip) export.PayslipDocument {
+	doc := export.PayslipDocument{
+		CompanyName:  companyName(),
+		EmployeeName: username,
+		Period:       periodLabel(h.PeriodStart, h.PeriodEnd),
+		Breakdown:    h.Payslip,
+	}
+	if h.Reversed {
+		doc.Status = models.PayrollStatusVoided
+	}
+	return doc
+}
+
+// ListPayslips lists the payslips of every payroll run the employee was part of
+func ListPayslips(c *fiber.Ctx) error {
+	user, err := GetUserProfile(c)
+	if err != nil {
+		return err
+	}
+	payslips, err := loadHistoricalPayslips(user.ID, 0)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not load payslips"})
+	}
+	return c.JSON(fiber.Map{"payslips": payslips})
+}
+
+// GetPayslip returns the employee's payslip for one payroll run
+func GetPayslip(c *fiber.Ctx) error {
+	user, err := GetUserProfile(c)
+	if err != nil {
+		return err
+	}
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid payroll run ID"})
+	}
+	payslips, err := loadHistoricalPayslips(user.ID, uint(id))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not load payslip"})
+	}
+	if len(payslips) == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Payslip not found"})
+	}
+
+	asPDF, err := wantsPDF(c)
+	if err != nil {
+		return err
+	}
+	if asPDF {
+		pdf := export.RenderPayslipPDF(historicalPayslipDocument(user.Username, payslips[0]))
+		return sendPDF(c, payslipPDFName(user.Username, uint(id)), pdf)
+	}
+	return c.JSON(payslips[0])
+}
+
+// bankAccountResponse is how payout details leave the API, never with the full account number
+func bankAccountResponse(user models.User) fiber.Map {
+	return fiber.Map{
+		"employee_id":         user.ID,
+		"payout_method":       user.PayoutMethod,
+		"bank_name":           user.BankName,
+		"account_number":      utils.MaskAccountNumber(string(user.BankAccountNumber)),
+		"account_holder_name": user.BankAccountName,
+	}
+}
+
+// GetBankAccount shows the employee their own payout details, with the account number masked
+func GetBankAccount(c *fiber.Ctx) error {
+	user, err := GetUserProfile(c)
+	if err != nil {
+		return err
+	}
+	return c.JSON(fiber.Map{"bank_account": bankAccountResponse(*user)})
+}
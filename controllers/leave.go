@@ -0,0 +1,518 @@
+// controllers/leave.go
+package controllers
+
+import (
+	"go-payroll/config"
+	"go-payroll/models"
+	"go-payroll/utils"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// leaveDates lists a user's working days between two dates, both inclusive; days off in the user's work schedule
+// and public holidays are not leave
+func leaveDates(db *gorm.DB, userID uint, start, end time.Time) ([]time.Time, error) {
+	cal, err := loadCalendar(db, userID, start, end)
+	if err != nil {
+		return nil, err
+	}
+	return cal.WorkingDays(start, end), nil
+}
+
+// leaveBalance is what an employee earned, used and has left of a leave type in a calendar year
+type leaveBalance struct {
+	LeaveType string  `json:"leave_type"`
+	Name      string  `json:"name"`
+	Paid      bool    `json:"paid"`
+	Year      int     `json:"year"`
+	Limited   bool    `json:"limited"` // false when the leave type has no balance
+	Accrued   float64 `json:"accrued"`
+	Used      float64 `json:"used"`    // approved days
+	Pending   float64 `json:"pending"` // days waiting for approval
+	Available float64 `json:"available"`
+}
+
+// loadLeaveBalance computes the balance of a leave type in the year, accrued up to and including the month asOf.
+// A month counts once the employee was hired in or before it; pending requests already reduce what is available.
+func loadLeaveBalance(db *gorm.DB, user models.User, leaveType models.LeaveType, year int, asOf time.Time) (leaveBalance, error) {
+	b := leaveBalance{
+		LeaveType: leaveType.Code,
+		Name:      leaveType.Name,
+		Paid:      leaveType.Paid,
+		Year:      year,
+		Limited:   leaveType.AccrualDaysPerMonth > 0,
+	}
+
+	var rows []struct {
+		Status string
+		Days   float64
+	}
+	err := db.Model(&models.LeaveRequest{}).Select("status, COALESCE(SUM(days), 0) AS days").
+		Where("user_id = ? AND leave_type_id = ? AND status IN ? AND EXTRACT(YEAR FROM start_date) = ?",
+			user.ID, leaveType.ID, []string{models.LeaveStatusApproved, models.LeaveStatusPending}, year).
+		Group("status").Scan(&rows).Error
+	if err != nil {
+		return b, err
+	}
+	for _, r := range rows {
+		if r.Status == models.LeaveStatusApproved {
+			b.Used = r.Days
+		} else {
+			b.Pending = r.Days
+		}
+	}
+	if !b.Limited {
+		return b, nil
+	}
+
+	lastMonth := 12
+	if asOf.Year() == year {
+		lastMonth = int(asOf.Month())
+	} else if asOf.Year() < year {
+		lastMonth = 0
+	}
+	firstMonth := 1
+	hired := user.CreatedAt
+	if user.HireDate != nil {
+		hired = *user.HireDate
+	}
+	if hired.Year() == year {
+		firstMonth = int(hired.Month())
+	} else if hired.Year() > year {
+		firstMonth = 13
+	}
+	if months := lastMonth - firstMonth + 1; months > 0 {
+		b.Accrued = float64(months) * leaveType.AccrualDaysPerMonth
+	}
+	if leaveType.MaxDaysPerYear > 0 {
+		b.Accrued = math.Min(b.Accrued, leaveType.MaxDaysPerYear)
+	}
+	b.Available = b.Accrued - b.Used - b.Pending
+	return b, nil
+}
+
+// checkLeaveDates rejects leave on days in a closed or paid attendance period or with attendance already submitted
+func checkLeaveDates(db *gorm.DB, userID uint, dates []time.Time) error {
+	for _, d := range dates {
+		if err := checkPeriodOpen(db, d); err != nil {
+			return err
+		}
+	}
+	var count int64
+	if err := db.Model(&models.Attendance{}).Where("user_id = ? AND date IN ?", userID, dates).Count(&count).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Could not check attendance")
+	}
+	if count > 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "Attendance was already submitted on a day of this leave")
+	}
+	return nil
+}
+
+// RequestLeave submits a leave request for the logged in employee
+func RequestLeave(c *fiber.Ctx) error {
+	type payload struct {
+		LeaveType string `json:"leave_type"`
+		StartDate string `json:"start_date"`
+		EndDate   string `json:"end_date"`
+		Reason    string `json:"reason"`
+	}
+	var body payload
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid input",
+			"instruction": "leave_type, start_date and end_date (YYYY-MM-DD) are required",
+		})
+	}
+
+	user, err := GetUserProfile(c)
+	if err != nil {
+		return err
+	}
+	start, err := time.Parse("2006-01-02", body.StartDate)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid start_date format (YYYY-MM-DD)"})
+	}
+	end, err := time.Parse("2006-01-02", body.EndDate)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid end_date format (YYYY-MM-DD)"})
+	}
+	if end.Before(start) {
+		return c.Status(400).JSON(fiber.Map{"error": "end_date cannot be before start_date"})
+	}
+	if start.Year() != end.Year() {
+		return c.Status(400).JSON(fiber.Map{"error": "Leave cannot span two calendar years, request each year separately"})
+	}
+	dates, err := leaveDates(config.DB, user.ID, start, end)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not load working days"})
+	}
+	if len(dates) == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "Leave has no working days"})
+	}
+
+	var leaveType models.LeaveType
+	if err := config.DB.Where("code = ? AND active = ?", strings.ToLower(body.LeaveType), true).First(&leaveType).Error; err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Unknown leave type"})
+	}
+	if err := checkLeaveDates(config.DB, user.ID, dates); err != nil {
+		return err
+	}
+
+	var overlapping int64
+	config.DB.Model(&models.LeaveRequest{}).
+		Where("user_id = ? AND status IN ? AND start_date <= ? AND end_date >= ?",
+			user.ID, []string{models.LeaveStatusPending, models.LeaveStatusApproved}, end, start).
+		Count(&overlapping)
+	if overlapping > 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "Leave overlaps another pending or approved leave request"})
+	}
+
+	balance, err := loadLeaveBalance(config.DB, *user, leaveType, start.Year(), start)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not load leave balance"})
+	}
+	if balance.Limited && float64(len(dates)) > balance.Available {
+		return c.Status(400).JSON(fiber.Map{"error": "Not enough leave balance", "balance": balance})
+	}
+
+	request := models.LeaveRequest{
+		UserID:      user.ID,
+		LeaveTypeID: leaveType.ID,
+		StartDate:   start,
+		EndDate:     end,
+		Days:        len(dates),
+		Reason:      body.Reason,
+		Status:      models.LeaveStatusPending,
+		CreatedBy:   user.ID,
+		IPAddress:   utils.GetIPAddress(c),
+	}
+	if err := config.DB.Create(&request).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not save leave request"})
+	}
+	request.LeaveType = leaveType
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"message": "Leave requested", "leave_request": request})
+}
+
+// ListMyLeave lists the leave requests of the logged in employee
+func ListMyLeave(c *fiber.Ctx) error {
+	user, err := GetUserProfile(c)
+	if err != nil {
+		return err
+	}
+	var requests []models.LeaveRequest
+	if err := config.DB.Preload("LeaveType").Where("user_id = ?", user.ID).Order("start_date DESC").Find(&requests).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not load leave requests"})
+	}
+	return c.JSON(fiber.Map{"leave_requests": requests})
+}
+
+// leaveBalances computes the balance of every active leave type for a user
+func leaveBalances(user models.User, year int) ([]leaveBalance, error) {
+	var leaveTypes []models.LeaveType
+	if err := config.DB.Where("active = ?", true).Order("id").Find(&leaveTypes).Error; err != nil {
+		return nil, err
+	}
+	balances := []leaveBalance{}
+	for _, t := range leaveTypes {
+		b, err := loadLeaveBalance(config.DB, user, t, year, today())
+		if err != nil {
+			return nil, err
+		}
+		balances = append(balances, b)
+	}
+	return balances, nil
+}
+
+// GetLeaveBalances shows the logged in employee's leave balances for a year, the current one by default
+func GetLeaveBalances(c *fiber.Ctx) error {
+	user, err := GetUserProfile(c)
+	if err != nil {
+		return err
+	}
+	balances, err := leaveBalances(*user, c.QueryInt("year", today().Year()))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not load leave balances"})
+	}
+	return c.JSON(fiber.Map{"balances": balances})
+}
+
+// CancelLeave withdraws a pending or approved leave request. Approved leave can only be
+// cancelled while none of its days were paid by a payroll run.
+func CancelLeave(c *fiber.Ctx) error {
+	user, err := GetUserProfile(c)
+	if err != nil {
+		return err
+	}
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		var request models.LeaveRequest
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("user_id = ?", user.ID).First(&request, c.Params("id")).Error; err != nil {
+			return fiber.NewError(fiber.StatusNotFound, "Leave request not found")
+		}
+		if request.Status != models.LeaveStatusPending && request.Status != models.LeaveStatusApproved {
+			return fiber.NewError(fiber.StatusBadRequest, "Leave request is already "+request.Status)
+		}
+		if request.Status == models.LeaveStatusApproved {
+			var paid int64
+			tx.Model(&models.LeaveDay{}).Where("leave_request_id = ? AND payroll_processed_id <> 0", request.ID).Count(&paid)
+			if paid > 0 {
+				return fiber.NewError(fiber.StatusBadRequest, "Leave was already paid by a payroll run")
+			}
+			var days []models.LeaveDay
+			if err := tx.Where("leave_request_id = ?", request.ID).Find(&days).Error; err != nil {
+				return fiber.NewError(fiber.StatusInternalServerError, "Could not load leave days")
+			}
+			for _, d := range days {
+				if err := checkPeriodOpen(tx, d.Date); err != nil {
+					return err
+				}
+			}
+			if err := tx.Where("leave_request_id = ?", request.ID).Delete(&models.LeaveDay{}).Error; err != nil {
+				return fiber.NewError(fiber.StatusInternalServerError, "Could not remove leave days")
+			}
+		}
+		return tx.Model(&request).Update("status", models.LeaveStatusCancelled).Error
+	})
+	if err != nil {
+		return err
+	}
+	return c.JSON(fiber.Map{"message": "Leave request cancelled"})
+}
+
+// leaveTypeInput is the payload to create or update a leave type. Nil fields are left unchanged on update.
+type leaveTypeInput struct {
+	Code                *string  `json:"code"`
+	Name                *string  `json:"name"`
+	Paid                *bool    `json:"paid"`
+	AccrualDaysPerMonth *float64 `json:"accrual_days_per_month"`
+	MaxDaysPerYear      *float64 `json:"max_days_per_year"`
+	Active              *bool    `json:"active"`
+}
+
+// apply validates the input and copies it onto the leave type
+func (in leaveTypeInput) apply(t *models.LeaveType) error {
+	if in.Code != nil {
+		code := strings.ToLower(strings.TrimSpace(*in.Code))
+		if code == "" || len(code) > 50 {
+			return fiber.NewError(fiber.StatusBadRequest, "code should be 1 to 50 characters")
+		}
+		t.Code = code
+	}
+	if in.Name != nil {
+		if strings.TrimSpace(*in.Name) == "" {
+			return fiber.NewError(fiber.StatusBadRequest, "name is required")
+		}
+		t.Name = strings.TrimSpace(*in.Name)
+	}
+	if in.Paid != nil {
+		t.Paid = *in.Paid
+	}
+	if in.AccrualDaysPerMonth != nil {
+		if *in.AccrualDaysPerMonth < 0 {
+			return fiber.NewError(fiber.StatusBadRequest, "accrual_days_per_month cannot be negative")
+		}
+		t.AccrualDaysPerMonth = *in.AccrualDaysPerMonth
+	}
+	if in.MaxDaysPerYear != nil {
+		if *in.MaxDaysPerYear < 0 {
+			return fiber.NewError(fiber.StatusBadRequest, "max_days_per_year cannot be negative")
+		}
+		t.MaxDaysPerYear = *in.MaxDaysPerYear
+	}
+	if in.Active != nil {
+		t.Active = *in.Active
+	}
+	return nil
+}
+
+// ListLeaveTypes lists the leave types
+func ListLeaveTypes(c *fiber.Ctx) error {
+	var leaveTypes []models.LeaveType
+	if err := config.DB.Order("id").Find(&leaveTypes).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch leave types")
+	}
+	return c.JSON(fiber.Map{"leave_types": leaveTypes})
+}
+
+// CreateLeaveType defines a new leave type
+func CreateLeaveType(c *fiber.Ctx) error {
+	var input leaveTypeInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid input",
+			"instruction": "code and name are required; paid, accrual_days_per_month and max_days_per_year are optional",
+		})
+	}
+	if input.Code == nil || input.Name == nil {
+		return fiber.NewError(fiber.StatusBadRequest, "code and name are required")
+	}
+
+	admin, err := GetUserProfile(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnauthorized, "Unauthorized")
+	}
+	leaveType := models.LeaveType{Paid: true, Active: true, CreatedBy: admin.ID, UpdatedBy: admin.ID}
+	if err := input.apply(&leaveType); err != nil {
+		return err
+	}
+	var count int64
+	config.DB.Model(&models.LeaveType{}).Where("code = ?", leaveType.Code).Count(&count)
+	if count > 0 {
+		return fiber.NewError(fiber.StatusConflict, "Leave type code already exists")
+	}
+	if err := config.DB.Create(&leaveType).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to create leave type")
+	}
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"message": "Leave type created", "leave_type": leaveType})
+}
+
+// UpdateLeaveType changes a leave type. Approved leave keeps the paid flag it was approved with.
+func UpdateLeaveType(c *fiber.Ctx) error {
+	var input leaveTypeInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid input",
+			"instruction": "Send any of code, name, paid, accrual_days_per_month, max_days_per_year and active",
+		})
+	}
+
+	admin, err := GetUserProfile(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnauthorized, "Unauthorized")
+	}
+	var leaveType models.LeaveType
+	if err := config.DB.First(&leaveType, c.Params("id")).Error; err != nil {
+		return fiber.NewError(fiber.StatusNotFound, "Leave type not found")
+	}
+	if err := input.apply(&leaveType); err != nil {
+		return err
+	}
+	var count int64
+	config.DB.Model(&models.LeaveType{}).Where("code = ? AND id <> ?", leaveType.Code, leaveType.ID).Count(&count)
+	if count > 0 {
+		return fiber.NewError(fiber.StatusConflict, "Leave type code already exists")
+	}
+
+	leaveType.UpdatedBy = admin.ID
+	if err := config.DB.Select("code", "name", "paid", "accrual_days_per_month", "max_days_per_year", "active", "updated_by").
+		Updates(&leaveType).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to update leave type")
+	}
+	return c.JSON(fiber.Map{"message": "Leave type updated", "leave_type": leaveType})
+}
+
+// ListLeaveRequests lists leave requests, optionally filtered by status and employee.
+// On the manager routes only the requests of the manager's team are listed and can be reviewed.
+func ListLeaveRequests(c *fiber.Ctx) error {
+	q := config.DB.Scopes(teamScope(c)).Preload("LeaveType").Order("start_date DESC")
+	if status := c.Query("status"); status != "" {
+		q = q.Where("status = ?", status)
+	}
+	if employeeID := c.QueryInt("employee_id"); employeeID > 0 {
+		q = q.Where("user_id = ?", employeeID)
+	}
+	var requests []models.LeaveRequest
+	if err := q.Find(&requests).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch leave requests")
+	}
+	return c.JSON(fiber.Map{"leave_requests": requests})
+}
+
+// GetEmployeeLeaveBalances shows an employee's leave balances for a year, the current one by default.
+// Managers only see their team.
+func GetEmployeeLeaveBalances(c *fiber.Ctx) error {
+	var user models.User
+	if err := config.DB.First(&user, c.Params("id")).Error; err != nil || !inTeam(c, user.ID) {
+		return fiber.NewError(fiber.StatusNotFound, "Employee not found")
+	}
+	balances, err := leaveBalances(user, c.QueryInt("year", today().Year()))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load leave balances")
+	}
+	return c.JSON(fiber.Map{"employee_id": user.ID, "balances": balances})
+}
+
+// reviewLeave approves or rejects a pending leave request. Approval creates a leave day per working day,
+// which payroll pays like attendance when the leave type is paid.
+func reviewLeave(c *fiber.Ctx, status string) error {
+	type Input struct {
+		Comment string `json:"comment"`
+	}
+	var input Input
+	if err := parseOptionalBody(c, &input); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid input",
+			"instruction": "Send the optional comment as JSON",
+		})
+	}
+
+	reviewer, err := GetUserProfile(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnauthorized, "Unauthorized")
+	}
+
+	var request models.LeaveRequest
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Scopes(teamScope(c)).Clauses(clause.Locking{Strength: "UPDATE"}).First(&request, c.Params("id")).Error; err != nil {
+			return fiber.NewError(fiber.StatusNotFound, "Leave request not found")
+		}
+		if request.Status != models.LeaveStatusPending {
+			return fiber.NewError(fiber.StatusBadRequest, "Leave request is already "+request.Status)
+		}
+		if err := tx.First(&request.LeaveType, request.LeaveTypeID).Error; err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch leave type")
+		}
+
+		if status == models.LeaveStatusApproved {
+			// Holidays added and schedule changes since the request are taken into account
+			dates, err := leaveDates(tx, request.UserID, request.StartDate, request.EndDate)
+			if err != nil {
+				return fiber.NewError(fiber.StatusInternalServerError, "Failed to load working days")
+			}
+			if len(dates) == 0 {
+				return fiber.NewError(fiber.StatusBadRequest, "Leave has no working days left")
+			}
+			request.Days = len(dates)
+			if err := checkLeaveDates(tx, request.UserID, dates); err != nil {
+				return err
+			}
+			days := make([]models.LeaveDay, 0, len(dates))
+			for _, d := range dates {
+				days = append(days, models.LeaveDay{
+					UserID:         request.UserID,
+					Date:           d,
+					LeaveRequestID: request.ID,
+					Paid:           request.LeaveType.Paid,
+				})
+			}
+			if err := tx.Create(&days).Error; err != nil {
+				return fiber.NewError(fiber.StatusConflict, "Employee already has leave on one of these days")
+			}
+		}
+
+		now := time.Now()
+		request.Status = status
+		request.ReviewedBy = reviewer.ID
+		request.ReviewedAt = &now
+		request.ReviewComment = input.Comment
+		return tx.Select("status", "days", "reviewed_by", "reviewed_at", "review_comment").Updates(&request).Error
+	})
+	if err != nil {
+		return err
+	}
+	return c.JSON(fiber.Map{"message": "Leave request " + status, "leave_request": request})
+}
+
+// ApproveLeave approves a pending leave request
+func ApproveLeave(c *fiber.Ctx) error {
+	return reviewLeave(c, models.LeaveStatusApproved)
+}
+
+// RejectLeave rejects a pending leave request
+func RejectLeave(c *fiber.Ctx) error {
+	return reviewLeave(c, models.LeaveStatusRejected)
+}
@@ -0,0 +1,112 @@
+// controllers/overtime.go
+package controllers
+
+import (
+	"go-payroll/config"
+	"go-payroll/models"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ListMyOvertime lists the overtime of the logged in employee with its approval status
+func ListMyOvertime(c *fiber.Ctx) error {
+	user, err := GetUserProfile(c)
+	if err != nil {
+		return err
+	}
+	q := config.DB.Where("user_id = ?", user.ID).Order("date DESC")
+	if status := c.Query("status"); status != "" {
+		q = q.Where("status = ?", status)
+	}
+	var overtimes []models.Overtime
+	if err := q.Find(&overtimes).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not load overtime"})
+	}
+	return c.JSON(fiber.Map{"overtime": overtimes})
+}
+
+// ListOvertime lists overtime, optionally filtered by status, employee and attendance period.
+// On the manager routes only the overtime of the manager's team is listed and can be reviewed.
+func ListOvertime(c *fiber.Ctx) error {
+	q := config.DB.Scopes(teamScope(c)).Order("date DESC")
+	if status := c.Query("status"); status != "" {
+		q = q.Where("status = ?", status)
+	}
+	if employeeID := c.QueryInt("employee_id"); employeeID > 0 {
+		q = q.Where("user_id = ?", employeeID)
+	}
+	if periodID := c.QueryInt("attendance_period_id"); periodID > 0 {
+		var period models.AttendancePeriod
+		if err := config.DB.First(&period, periodID).Error; err != nil {
+			return fiber.NewError(fiber.StatusNotFound, "Attendance period not found")
+		}
+		q = q.Where("date BETWEEN ? AND ?", period.StartDate, period.EndDate)
+	}
+	var overtimes []models.Overtime
+	if err := q.Find(&overtimes).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch overtime")
+	}
+	return c.JSON(fiber.Map{"overtime": overtimes})
+}
+
+// reviewOvertime approves or rejects pending overtime. Overtime in a paid period can no longer be reviewed,
+// its payroll is settled.
+func reviewOvertime(c *fiber.Ctx, status string) error {
+	type Input struct {
+		Comment string `json:"comment"`
+	}
+	var input Input
+	if err := parseOptionalBody(c, &input); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid input",
+			"instruction": "Send the optional comment as JSON",
+		})
+	}
+
+	reviewer, err := GetUserProfile(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnauthorized, "Unauthorized")
+	}
+
+	var overtime models.Overtime
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Scopes(teamScope(c)).Clauses(clause.Locking{Strength: "UPDATE"}).First(&overtime, c.Params("id")).Error; err != nil {
+			return fiber.NewError(fiber.StatusNotFound, "Overtime not found")
+		}
+		if overtime.Status != models.OvertimeStatusPending {
+			return fiber.NewError(fiber.StatusBadRequest, "Overtime is already "+overtime.Status)
+		}
+		period, err := findPeriod(tx, overtime.Date)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Could not check attendance period")
+		}
+		if period != nil && period.Status == models.PeriodStatusPaid {
+			return fiber.NewError(fiber.StatusBadRequest, "Attendance period for this date is "+period.Status)
+		}
+
+		now := time.Now()
+		overtime.Status = status
+		overtime.ReviewedBy = reviewer.ID
+		overtime.ReviewedAt = &now
+		overtime.ReviewComment = input.Comment
+		overtime.UpdatedBy = reviewer.ID
+		return tx.Select("status", "reviewed_by", "reviewed_at", "review_comment", "updated_by").Updates(&overtime).Error
+	})
+	if err != nil {
+		return err
+	}
+	return c.JSON(fiber.Map{"message": "Overtime " + status, "overtime": overtime})
+}
+
+// ApproveOvertime approves pending overtime so the next payroll run pays it
+func ApproveOvertime(c *fiber.Ctx) error {
+	return reviewOvertime(c, models.OvertimeStatusApproved)
+}
+
+// RejectOvertime rejects pending overtime
+func RejectOvertime(c *fiber.Ctx) error {
+	return reviewOvertime(c, models.OvertimeStatusRejected)
+}
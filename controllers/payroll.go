@@ -0,0 +1,578 @@
+// controllers/payroll.go
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-payroll/contributions"
+	"go-payroll/export"
+	"go-payroll/models"
+	"go-payroll/money"
+	"go-payroll/payroll"
+	"go-payroll/utils"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// payrollRecords groups the records of a user that feed a payroll calculation
+type payrollRecords struct {
+	Salaries       []models.SalaryHistory
+	Attendances    []models.Attendance
+	LeaveDays      []models.LeaveDay
+	Overtimes      []models.Overtime
+	Reimbursements []models.Reimbursement
+	Calendar       *payroll.Calendar
+	PayDate        time.Time
+	PeriodStart    time.Time
+	FinalPeriod    bool // the employee's last period of the tax year, see finalTaxPeriod
+	YearToDate     payroll.YearToDate
+	Components     []models.EmployeePayComponent
+	ComponentsPaid map[uint]money.Money
+	Arrears        map[uint]money.Money
+}
+
+// payableUsers limits a query on users to the ones payroll covers: active users, and users who left with
+// records still unpaid, in the period when one is given. The summary and the run share it so they agree.
+func payableUsers(period *models.AttendancePeriod) func(*gorm.DB) *gorm.DB {
+	return func(q *gorm.DB) *gorm.DB {
+		unpaid := func(table, condition string, args ...interface{}) *gorm.DB {
+			sub := q.Session(&gorm.Session{NewDB: true}).Table(table+" r").Select("1").
+				Where("r.user_id = users.id AND r.payroll_processed_id = 0")
+			if condition != "" {
+				sub = sub.Where(condition, args...)
+			}
+			if period != nil {
+				sub = sub.Where("r.date BETWEEN ? AND ?", period.StartDate, period.EndDate)
+			}
+			return sub
+		}
+		return q.Where("users.status = ?", models.UserStatusActive).
+			Or("EXISTS (?)", unpaid("attendances", "")).
+			Or("EXISTS (?)", unpaid("leave_days", "r.paid")).
+			Or("EXISTS (?)", unpaid("overtimes", "r.status = ?", models.OvertimeStatusApproved)).
+			Or("EXISTS (?)", unpaid("reimbursements", "r.status = ?", models.ReimbursementStatusApproved))
+	}
+}
+
+// unpaidRecords limits a query on attendances, leave days, overtime or reimbursements to the unpaid ones
+// of a user, in the period when one is given, locked for update with lock
+func unpaidRecords(userID uint, period *models.AttendancePeriod, lock bool) func(*gorm.DB) *gorm.DB {
+	return func(q *gorm.DB) *gorm.DB {
+		q = q.Where("user_id = ? AND payroll_processed_id = 0", userID)
+		if period != nil {
+			q = q.Where("date BETWEEN ? AND ?", period.StartDate, period.EndDate)
+		}
+		if lock {
+			q = q.Clauses(clause.Locking{Strength: "UPDATE"})
+		}
+		return q
+	}
+}
+
+// loadUnpaidRecords fetches the records of a user that are not part of any payroll run yet.
+// When a period is given only records dated inside it are returned and pay is dated at its end, otherwise today.
+// With lock the records to be paid are locked for update, so a concurrent run cannot pick them up as well;
+// salaries, schedules, holidays and earlier runs are read without locks.
+func loadUnpaidRecords(db *gorm.DB, userID uint, period *models.AttendancePeriod, lock bool) (payrollRecords, error) {
+	r := payrollRecords{PayDate: today()}
+	if period != nil {
+		r.PayDate = period.EndDate
+		r.PeriodStart = period.StartDate
+	}
+	scope := unpaidRecords(userID, period, lock)
+	if err := db.Where("user_id = ?", userID).Find(&r.Salaries).Error; err != nil {
+		return r, err
+	}
+	if err := db.Scopes(scope).Find(&r.Attendances).Error; err != nil {
+		return r, err
+	}
+	if err := db.Scopes(scope).Find(&r.LeaveDays).Error; err != nil {
+		return r, err
+	}
+	// Overtime and reimbursement claims are paid once approved
+	if err := db.Scopes(scope).Where("status = ?", models.OvertimeStatusApproved).Find(&r.Overtimes).Error; err != nil {
+		return r, err
+	}
+	if err := db.Scopes(scope).Where("status = ?", models.ReimbursementStatusApproved).Find(&r.Reimbursements).Error; err != nil {
+		return r, err
+	}
+
+	// Scheduled weekdays and the holidays of every month a record falls in, for the working days that divide the salary
+	from := r.PayDate
+	if period != nil {
+		from = period.StartDate
+	}
+	for _, a := range r.Attendances {
+		if a.Date.Before(from) {
+			from = a.Date
+		}
+	}
+	for _, l := range r.LeaveDays {
+		if l.Date.Before(from) {
+			from = l.Date
+		}
+	}
+	for _, o := range r.Overtimes {
+		if o.Date.Before(from) {
+			from = o.Date
+		}
+	}
+	cal, err := loadCalendar(db, userID, from, r.PayDate)
+	if err != nil {
+		return r, err
+	}
+	r.Calendar = cal
+
+	if err := db.Preload("PayComponent").Where("user_id = ?", userID).Find(&r.Components).Error; err != nil {
+		return r, err
+	}
+	paid, err := loadComponentsPaid(db, userID)
+	if err != nil {
+		return r, err
+	}
+	r.ComponentsPaid = paid
+	arrears, err := loadComponentArrears(db, userID)
+	if err != nil {
+		return r, err
+	}
+	r.Arrears = arrears
+
+	ytd, err := loadYearToDate(db, userID, r.PayDate)
+	if err != nil {
+		return r, err
+	}
+	r.YearToDate = ytd
+
+	// Without a period the pay is a preview up to today, which never reconciles the year
+	if period != nil {
+		if r.FinalPeriod, err = finalTaxPeriod(db, userID, *period); err != nil {
+			return r, err
+		}
+	}
+	return r, nil
+}
+
+// lastPeriodOfYear tells whether a period is the last one ending in its tax year: no later period ends in
+// the year, and one of the same length after it would end in the next year. A year whose last period ends
+// on December 25 reconciles then.
+func lastPeriodOfYear(period models.AttendancePeriod, laterInYear bool) bool {
+	if laterInYear {
+		return false
+	}
+	days := int(period.EndDate.Sub(period.StartDate).Hours()/24) + 1
+	return period.EndDate.AddDate(0, 0, days).Year() > period.EndDate.Year()
+}
+
+// finalTaxPeriod tells whether a period is the user's last of the tax year, where the annual tax is
+// reconciled: the last period of the year, or the period of the last unpaid records of a user who left
+func finalTaxPeriod(db *gorm.DB, userID uint, period models.AttendancePeriod) (bool, error) {
+	yearEnd := time.Date(period.EndDate.Year(), time.December, 31, 0, 0, 0, 0, time.UTC)
+	var later int64
+	if err := db.Model(&models.AttendancePeriod{}).Where("end_date > ? AND end_date <= ?", period.EndDate, yearEnd).
+		Count(&later).Error; err != nil {
+		return false, err
+	}
+	if lastPeriodOfYear(period, later > 0) {
+		return true, nil
+	}
+
+	var user models.User
+	if err := db.Select("id", "status").First(&user, userID).Error; err != nil {
+		return false, err
+	}
+	if user.Status != models.UserStatusInactive {
+		return false, nil
+	}
+	// Someone who left is paid in the period of their last records
+	for _, table := range paidRecords {
+		var count int64
+		if err := db.Model(table).Where("user_id = ? AND payroll_processed_id = 0 AND date > ?", userID, period.EndDate).
+			Count(&count).Error; err != nil {
+			return false, err
+		}
+		if count > 0 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// lockPayComponents locks the pay component assignments of a user until the transaction ends. A run takes the lock
+// before reading what was paid on them, so a concurrent run for another period waits for its lines and cannot pay
+// the same bonus or loan installment again.
+func lockPayComponents(tx *gorm.DB, userID uint) error {
+	var ids []uint
+	return tx.Model(&models.EmployeePayComponent{}).Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("user_id = ?", userID).Pluck("id", &ids).Error
+}
+
+// loadComponentsPaid sums what completed payroll runs paid or deducted per pay component assignment of a user
+func loadComponentsPaid(db *gorm.DB, userID uint) (map[uint]money.Money, error) {
+	var rows []struct {
+		EmployeePayComponentID uint
+		Amount                 money.Money
+	}
+	err := db.Raw(`SELECT pcl.employee_pay_component_id, SUM(pcl.amount) AS amount
+		FROM payroll_component_lines pcl
+		JOIN payroll_processeds pp ON pp.id = pcl.payroll_processed_id
+		WHERE pcl.user_id = ? AND pp.status = ?
+		GROUP BY pcl.employee_pay_component_id`,
+		userID, models.PayrollStatusCompleted).Scan(&rows).Error
+	paid := map[uint]money.Money{}
+	for _, row := range rows {
+		paid[row.EmployeePayComponentID] = row.Amount
+	}
+	return paid, err
+}
+
+// loadComponentArrears finds what the latest completed run could not deduct per pay component assignment of a user.
+// A deduction line includes the arrears before it, so its shortfall is all that is still owed.
+func loadComponentArrears(db *gorm.DB, userID uint) (map[uint]money.Money, error) {
+	var rows []struct {
+		EmployeePayComponentID uint
+		Amount                 money.Money
+	}
+	err := db.Raw(`SELECT DISTINCT ON (pcl.employee_pay_component_id) pcl.employee_pay_component_id, COALESCE(pcl.shortfall, 0) AS amount
+		FROM payroll_component_lines pcl
+		JOIN payroll_processeds pp ON pp.id = pcl.payroll_processed_id
+		WHERE pcl.user_id = ? AND pp.status = ?
+		ORDER BY pcl.employee_pay_component_id, pcl.id DESC`,
+		userID, models.PayrollStatusCompleted).Scan(&rows).Error
+	arrears := map[uint]money.Money{}
+	for _, row := range rows {
+		if row.Amount.IsPositive() {
+			arrears[row.EmployeePayComponentID] = row.Amount
+		}
+	}
+	return arrears, err
+}
+
+// loadYearToDate sums the payroll lines of completed runs for periods that ended earlier in the tax year of payDate
+func loadYearToDate(db *gorm.DB, userID uint, payDate time.Time) (payroll.YearToDate, error) {
+	yearStart := time.Date(payDate.Year(), time.January, 1, 0, 0, 0, 0, time.UTC)
+	var ytd payroll.YearToDate
+	// Lines from before contributions were tracked have no taxable income, their gross pay was taxed
+	err := db.Raw(`SELECT COALESCE(SUM(CASE WHEN COALESCE(dp.taxable_income, 0) = 0 THEN dp.gross_pay ELSE dp.taxable_income END), 0) AS taxable_income,
+		COALESCE(SUM(dp.tax_deductible), 0) AS tax_deductible, COALESCE(SUM(dp.tax_withheld), 0) AS tax_withheld
+		FROM daily_payrolls dp
+		JOIN payroll_processeds pp ON pp.id = dp.payroll_processed_id
+		JOIN attendance_periods ap ON ap.id = pp.attendance_period_id
+		WHERE dp.user_id = ? AND dp.reversed = false AND pp.status = ?
+		AND ap.end_date >= ? AND ap.end_date < ?`,
+		userID, models.PayrollStatusCompleted, yearStart, payDate).Scan(&ytd).Error
+	return ytd, err
+}
+
+// findPeriod looks up the attendance period covering a date, nil if there is none
+func findPeriod(db *gorm.DB, date time.Time) (*models.AttendancePeriod, error) {
+	var period models.AttendancePeriod
+	err := db.Where("start_date <= ? AND end_date >= ?", date, date).First(&period).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &period, nil
+}
+
+// checkPeriodOpen rejects dates that belong to a closed or paid attendance period
+func checkPeriodOpen(db *gorm.DB, date time.Time) error {
+	period, err := findPeriod(db, date)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Could not check attendance period")
+	}
+	if period != nil && (period.Status == models.PeriodStatusClosed || period.Status == models.PeriodStatusPaid) {
+		return fiber.NewError(fiber.StatusBadRequest, "Attendance period for this date is "+period.Status)
+	}
+	return nil
+}
+
+// calculate runs the shared payroll engine over the loaded records
+func (r payrollRecords) calculate(user models.User) (payroll.Breakdown, error) {
+	return payroll.Calculate(payroll.Input{
+		User:              user,
+		Salaries:          r.Salaries,
+		Attendances:       r.Attendances,
+		LeaveDays:         r.LeaveDays,
+		Overtimes:         r.Overtimes,
+		Reimbursements:    r.Reimbursements,
+		Calendar:          r.Calendar,
+		PayDate:           r.PayDate,
+		PeriodStart:       r.PeriodStart,
+		FinalPeriod:       r.FinalPeriod,
+		YearToDate:        r.YearToDate,
+		Components:        r.Components,
+		ComponentsPaid:    r.ComponentsPaid,
+		ComponentsArrears: r.Arrears,
+	}, payroll.DefaultRules)
+}
+
+// markProcessed stamps the loaded records with the payroll run that paid them
+func (r payrollRecords) markProcessed(tx *gorm.DB, payrollProcessedID uint) error {
+	var ids []uint
+	for _, a := range r.Attendances {
+		ids = append(ids, a.ID)
+	}
+	if len(ids) > 0 {
+		if err := tx.Model(&models.Attendance{}).Where("id IN ?", ids).Update("payroll_processed_id", payrollProcessedID).Error; err != nil {
+			return err
+		}
+	}
+
+	ids = nil
+	for _, l := range r.LeaveDays {
+		ids = append(ids, l.ID)
+	}
+	if len(ids) > 0 {
+		if err := tx.Model(&models.LeaveDay{}).Where("id IN ?", ids).Update("payroll_processed_id", payrollProcessedID).Error; err != nil {
+			return err
+		}
+	}
+
+	ids = nil
+	for _, o := range r.Overtimes {
+		ids = append(ids, o.ID)
+	}
+	if len(ids) > 0 {
+		if err := tx.Model(&models.Overtime{}).Where("id IN ?", ids).Update("payroll_processed_id", payrollProcessedID).Error; err != nil {
+			return err
+		}
+	}
+
+	ids = nil
+	for _, rb := range r.Reimbursements {
+		ids = append(ids, rb.ID)
+	}
+	if len(ids) > 0 {
+		if err := tx.Model(&models.Reimbursement{}).Where("id IN ?", ids).Update("payroll_processed_id", payrollProcessedID).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// paidRecords are the record types markProcessed stamps with the payroll run that paid them
+var paidRecords = []interface{}{&models.Attendance{}, &models.LeaveDay{}, &models.Overtime{}, &models.Reimbursement{}}
+
+// releaseRecords makes the records a payroll run paid unpaid again, so the next run of the period picks them up
+func releaseRecords(tx *gorm.DB, payrollProcessedID uint) error {
+	for _, model := range paidRecords {
+		if err := tx.Model(model).Where("payroll_processed_id = ?", payrollProcessedID).Update("payroll_processed_id", 0).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// breakdownFromLine rebuilds a payslip breakdown from a persisted payroll line
+func breakdownFromLine(line models.DailyPayroll) (payroll.Breakdown, error) {
+	var segments []payroll.SalarySegment
+	if line.SalarySegments != "" {
+		if err := json.Unmarshal([]byte(line.SalarySegments), &segments); err != nil {
+			return payroll.Breakdown{}, fmt.Errorf("payroll line %d: salary segments: %w", line.ID, err)
+		}
+	}
+	var components []payroll.ComponentLine
+	if line.Components != "" {
+		if err := json.Unmarshal([]byte(line.Components), &components); err != nil {
+			return payroll.Breakdown{}, fmt.Errorf("payroll line %d: components: %w", line.ID, err)
+		}
+	}
+	var contributionLines []contributions.Line
+	if line.Contributions != "" {
+		if err := json.Unmarshal([]byte(line.Contributions), &contributionLines); err != nil {
+			return payroll.Breakdown{}, fmt.Errorf("payroll line %d: contributions: %w", line.ID, err)
+		}
+	}
+	return payroll.Breakdown{
+		UserID:                line.UserID,
+		SalaryRate:            line.SalaryRate,
+		DailyRate:             line.DailyRate,
+		WorkingDays:           line.WorkingDays,
+		AttendanceDays:        line.TotalAttendance,
+		PaidLeaveDays:         line.TotalPaidLeave,
+		UnpaidLeaveDays:       line.TotalUnpaidLeave,
+		BaseSalary:            line.BaseSalary,
+		SalarySegments:        segments,
+		OvertimeHours:         line.TotalOvertime,
+		HolidayOvertimeHours:  line.TotalHolidayOvertime,
+		OvertimePay:           line.OvertimePay,
+		Components:            components,
+		ComponentEarnings:     line.ComponentEarnings,
+		ComponentDeductions:   line.ComponentDeductions,
+		GrossPay:              line.GrossPay,
+		Contributions:         contributionLines,
+		EmployeeContributions: line.EmployeeContributions,
+		EmployerContributions: line.EmployerContributions,
+		TaxableIncome:         line.TaxableIncome,
+		TaxDeductible:         line.TaxDeductible,
+		TaxWithheld:           line.TaxWithheld,
+		TaxMethod:             line.TaxMethod,
+		ReimbursementTotal:    line.ReimbursementTotal,
+		TakeHomePay:           line.TakeHomePay,
+		Currency:              line.TakeHomePay.CurrencyCode(),
+	}, nil
+}
+
+// companyName is printed in the header of payslip documents
+func companyName() string {
+	if name := os.Getenv("COMPANY_NAME"); name != "" {
+		return name
+	}
+	return "Go Payroll"
+}
+
+// periodLabel formats the dates of an attendance period for documents
+func periodLabel(start, end time.Time) string {
+	return start.Format("2006-01-02") + " to " + end.Format("2006-01-02")
+}
+
+// Content types of the document formats an endpoint can be asked for
+const (
+	mimePDF  = "application/pdf"
+	mimeCSV  = "text/csv"
+	mimeXLSX = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+)
+
+// formatMIMEs are the response formats and their content types, in order of preference of the Accept header
+var formatMIMEs = map[string]string{"json": fiber.MIMEApplicationJSON, "pdf": mimePDF, "csv": mimeCSV, "xlsx": mimeXLSX}
+
+// responseFormat returns the format requested with ?format= or the Accept header among the supported ones,
+// the first of them by default. An unsupported ?format= is an error listing the supported ones.
+func responseFormat(c *fiber.Ctx, supported ...string) (string, error) {
+	if format := c.Query("format"); format != "" {
+		if !slices.Contains(supported, format) {
+			return "", fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("unknown format %q, available: %v", format, supported))
+		}
+		return format, nil
+	}
+	mimes := make([]string, 0, len(supported))
+	for _, format := range supported {
+		mimes = append(mimes, formatMIMEs[format])
+	}
+	accepted := c.Accepts(mimes...)
+	for _, format := range supported {
+		if formatMIMEs[format] == accepted {
+			return format, nil
+		}
+	}
+	return supported[0], nil
+}
+
+// wantsPDF reports whether the client asked for a PDF rather than JSON
+func wantsPDF(c *fiber.Ctx) (bool, error) {
+	format, err := responseFormat(c, "json", "pdf")
+	return format == "pdf", err
+}
+
+// sendPDF sends a PDF document as a download
+func sendPDF(c *fiber.Ctx, filename string, data []byte) error {
+	c.Set(fiber.HeaderContentType, mimePDF)
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s"`, filename))
+	return c.Send(data)
+}
+
+// reimbursementItems itemises reimbursements for a payslip document
+func reimbursementItems(reimbursements []models.Reimbursement) []export.ReimbursementItem {
+	items := []export.ReimbursementItem{}
+	for _, r := range reimbursements {
+		items = append(items, export.ReimbursementItem{
+			Date:   r.Date.Format("2006-01-02"),
+			Desc:   r.Desc,
+			Amount: r.Amount,
+		})
+	}
+	return items
+}
+
+// payslipPDFName is the file name of a payslip PDF
+func payslipPDFName(username string, payrollProcessedID uint) string {
+	if payrollProcessedID == 0 {
+		return fmt.Sprintf("payslip-%s.pdf", username)
+	}
+	return fmt.Sprintf("payslip-%s-run%d.pdf", username, payrollProcessedID)
+}
+
+// summaryRow is one employee in a payslip summary
+type summaryRow struct {
+	Username string `json:"username"`
+	payroll.Breakdown
+}
+
+// sendSummary responds with a payslip summary as JSON, CSV or XLSX
+func sendSummary(c *fiber.Ctx, filename string, rows []summaryRow, extra fiber.Map) error {
+	// Amounts are exact, so the total is the sum of what each employee takes home
+	total := money.New(0, money.DefaultCurrency)
+	for _, r := range rows {
+		total = total.Add(r.TakeHomePay)
+	}
+
+	format, err := responseFormat(c, "json", "csv", "xlsx")
+	if err != nil {
+		return err
+	}
+	if format == "json" {
+		body := fiber.Map{
+			"summary": rows,
+			"total_take_home_all_employees": total,
+			"currency": total.CurrencyCode(),
+		}
+		for k, v := range extra {
+			body[k] = v
+		}
+		return c.JSON(body)
+	}
+
+	table := export.Table{
+		Header: []string{"Employee ID", "Username", "Attendance Days", "Paid Leave Days", "Daily Rate", "Base Salary", "Overtime Hours", "Overtime Pay", "Component Earnings", "Gross Pay", "Employee Contributions", "Tax Withheld", "Component Deductions", "Reimbursements", "Take Home Pay", "Employer Contributions"},
+	}
+	var days, leaveDays int
+	var hours float64
+	zero := money.New(0, total.Currency)
+	base, overtime, gross, withheld, reimbursed := zero, zero, zero, zero, zero
+	employeeShare, employerShare, earnings, deductions := zero, zero, zero, zero
+	for _, r := range rows {
+		table.Rows = append(table.Rows, []interface{}{
+			r.UserID, r.Username, r.AttendanceDays, r.PaidLeaveDays, r.DailyRate, r.BaseSalary, r.OvertimeHours, r.OvertimePay, r.ComponentEarnings, r.GrossPay, r.EmployeeContributions, r.TaxWithheld, r.ComponentDeductions, r.ReimbursementTotal, r.TakeHomePay, r.EmployerContributions,
+		})
+		days += r.AttendanceDays
+		leaveDays += r.PaidLeaveDays
+		base = base.Add(r.BaseSalary)
+		hours += r.OvertimeHours
+		overtime = overtime.Add(r.OvertimePay)
+		earnings = earnings.Add(r.ComponentEarnings)
+		gross = gross.Add(r.GrossPay)
+		deductions = deductions.Add(r.ComponentDeductions)
+		employeeShare = employeeShare.Add(r.EmployeeContributions)
+		employerShare = employerShare.Add(r.EmployerContributions)
+		withheld = withheld.Add(r.TaxWithheld)
+		reimbursed = reimbursed.Add(r.ReimbursementTotal)
+	}
+	// The take home total matches total_take_home_all_employees of the JSON summary
+	table.Rows = append(table.Rows, []interface{}{
+		"TOTAL", nil, days, leaveDays, nil, base, utils.Round(hours), overtime, earnings, gross, employeeShare, withheld, deductions, reimbursed, total, employerShare,
+	})
+
+	var buf bytes.Buffer
+	if format == "csv" {
+		if err := export.WriteCSV(&buf, table); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to write CSV")
+		}
+		c.Set(fiber.HeaderContentType, mimeCSV)
+	} else {
+		if err := export.WriteXLSX(&buf, "Payslip summary", table); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to write XLSX")
+		}
+		c.Set(fiber.HeaderContentType, mimeXLSX)
+	}
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s.%s"`, filename, format))
+	return c.Send(buf.Bytes())
+}
@@ -0,0 +1,193 @@
+package controllers
+
+import (
+	"go-payroll/models"
+	"io"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// A voided run must release everything the run marked paid, or the run of the period after the void
+// silently leaves it out
+func TestReleaseRecordsUndoesMarkProcessed(t *testing.T) {
+	db, recorder := dryRunDB(t)
+	records := payrollRecords{
+		Attendances:    []models.Attendance{{ID: 1}},
+		LeaveDays:      []models.LeaveDay{{ID: 2, Paid: true}},
+		Overtimes:      []models.Overtime{{ID: 3}},
+		Reimbursements: []models.Reimbursement{{ID: 4}},
+	}
+	if err := records.markProcessed(db, 7); err != nil {
+		t.Fatalf("markProcessed: %v", err)
+	}
+	marked := updatedTables(recorder.take())
+	if err := releaseRecords(db, 7); err != nil {
+		t.Fatalf("releaseRecords: %v", err)
+	}
+	statements := recorder.take()
+	released := updatedTables(statements)
+
+	slices.Sort(marked)
+	slices.Sort(released)
+	if !slices.Equal(marked, released) {
+		t.Errorf("run marks %v but void releases %v", marked, released)
+	}
+	for _, s := range statements {
+		if !strings.Contains(s, `SET "payroll_processed_id"=0`) || !strings.Contains(s, "payroll_processed_id = 7") {
+			t.Errorf("unexpected release statement %s", s)
+		}
+	}
+}
+
+// Runs for different periods must serialise on the pay component assignments, or both read the same paid
+// amounts and pay a bonus or the last loan installment twice
+func TestLockPayComponentsLocksTheAssignments(t *testing.T) {
+	db, recorder := dryRunDB(t)
+	if err := lockPayComponents(db, 5); err != nil {
+		t.Fatalf("lockPayComponents: %v", err)
+	}
+	statements := recorder.take()
+	if len(statements) != 1 {
+		t.Fatalf("got %d statements, want 1", len(statements))
+	}
+	s := statements[0]
+	if !strings.Contains(s, `FROM "employee_pay_components"`) || !strings.Contains(s, "user_id = 5") || !strings.HasSuffix(s, "FOR UPDATE") {
+		t.Errorf("unexpected lock statement %s", s)
+	}
+}
+
+// A payroll line whose stored breakdown cannot be read must fail rather than show an empty payslip
+func TestBreakdownFromLineReportsUnreadableLines(t *testing.T) {
+	for _, line := range []models.DailyPayroll{
+		{ID: 1, SalarySegments: "{"},
+		{ID: 2, Components: "[1]"},
+		{ID: 3, Contributions: "null,"},
+	} {
+		if _, err := breakdownFromLine(line); err == nil {
+			t.Errorf("line %d: no error", line.ID)
+		}
+	}
+	if _, err := breakdownFromLine(models.DailyPayroll{ID: 4, Components: "[]"}); err != nil {
+		t.Errorf("line 4: %v", err)
+	}
+}
+
+// Users who left are only in the summary and the run while they have unpaid records in the period
+func TestPayableUsersLeavesOutUsersWhoLeft(t *testing.T) {
+	db, recorder := dryRunDB(t)
+	period := &models.AttendancePeriod{StartDate: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), EndDate: time.Date(2025, 1, 31, 0, 0, 0, 0, time.UTC)}
+	var users []models.User
+	if err := db.Scopes(payableUsers(period)).Find(&users).Error; err != nil {
+		t.Fatalf("Find: %v", err)
+	}
+	statements := recorder.take()
+	if len(statements) != 1 {
+		t.Fatalf("got %d statements, want 1", len(statements))
+	}
+	s := statements[0]
+	for _, want := range []string{
+		"users.status = 'active'",
+		"EXISTS (SELECT 1 FROM attendances r WHERE (r.user_id = users.id AND r.payroll_processed_id = 0) AND (r.date BETWEEN '2025-01-01",
+		"FROM leave_days r WHERE (r.user_id = users.id AND r.payroll_processed_id = 0) AND r.paid",
+		"FROM overtimes r WHERE (r.user_id = users.id AND r.payroll_processed_id = 0) AND r.status = 'approved'",
+		"FROM reimbursements r WHERE (r.user_id = users.id AND r.payroll_processed_id = 0) AND r.status = 'approved'",
+	} {
+		if !strings.Contains(s, want) {
+			t.Errorf("%s\nmissing %s", s, want)
+		}
+	}
+}
+
+// A run locks the records it pays, and nothing else: the scope is what takes the lock, the shared rows like
+// schedules and holidays that loadUnpaidRecords also reads are queried without it
+func TestUnpaidRecordsLocksOnlyForARun(t *testing.T) {
+	db, recorder := dryRunDB(t)
+	period := &models.AttendancePeriod{StartDate: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), EndDate: time.Date(2025, 1, 31, 0, 0, 0, 0, time.UTC)}
+	for _, lock := range []bool{true, false} {
+		var attendances []models.Attendance
+		if err := db.Scopes(unpaidRecords(5, period, lock)).Find(&attendances).Error; err != nil {
+			t.Fatalf("Find: %v", err)
+		}
+		s := recorder.take()[0]
+		if !strings.Contains(s, "user_id = 5 AND payroll_processed_id = 0") || strings.HasSuffix(s, "FOR UPDATE") != lock {
+			t.Errorf("lock %v: %s", lock, s)
+		}
+	}
+}
+
+func TestLastPeriodOfYear(t *testing.T) {
+	day := func(s string) time.Time {
+		d, _ := time.Parse("2006-01-02", s)
+		return d
+	}
+	tests := []struct {
+		name        string
+		start, end  string
+		laterInYear bool
+		want        bool
+	}{
+		{"a year ending on December 25", "2024-11-26", "2024-12-25", false, true},
+		{"the month before", "2024-10-26", "2024-11-25", false, false},
+		{"a calendar December", "2024-12-01", "2024-12-31", false, true},
+		{"the first half of December", "2024-12-01", "2024-12-15", false, false},
+		{"the second half of December", "2024-12-16", "2024-12-31", false, true},
+		{"a later period already ends in the year", "2024-11-26", "2024-12-25", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			period := models.AttendancePeriod{StartDate: day(tt.start), EndDate: day(tt.end)}
+			if got := lastPeriodOfYear(period, tt.laterInYear); got != tt.want {
+				t.Errorf("lastPeriodOfYear = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// A misspelt ?format= must not quietly fall back to JSON
+func TestResponseFormat(t *testing.T) {
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error {
+		format, err := responseFormat(c, "json", "csv", "xlsx")
+		if err != nil {
+			return err
+		}
+		return c.SendString(format)
+	})
+
+	tests := []struct {
+		name, query, accept string
+		wantStatus          int
+		wantBody            string
+	}{
+		{"json by default", "", "", 200, "json"},
+		{"a supported format", "?format=xlsx", "", 200, "xlsx"},
+		{"the Accept header", "", mimeCSV, 200, "csv"},
+		{"an unsupported Accept header", "", mimePDF, 200, "json"},
+		{"a misspelt format", "?format=xlxs", "", 400, `unknown format "xlxs", available: [json csv xlsx]`},
+		{"a format of another endpoint", "?format=pdf", "", 400, `unknown format "pdf", available: [json csv xlsx]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/"+tt.query, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.wantStatus || string(body) != tt.wantBody {
+				t.Errorf("got %d %q, want %d %q", resp.StatusCode, body, tt.wantStatus, tt.wantBody)
+			}
+		})
+	}
+}
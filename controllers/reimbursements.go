@@ -0,0 +1,437 @@
+// controllers/reimbursements.go
+package controllers
+
+import (
+	"bytes"
+	"errors"
+	"go-payroll/config"
+	"go-payroll/models"
+	"go-payroll/money"
+	"go-payroll/storage"
+	"go-payroll/utils"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxReceiptSize is the largest receipt file accepted
+const maxReceiptSize = 4 << 20
+
+// MaxBodySize is the request body limit the server needs: a receipt of maxReceiptSize with room for the
+// multipart framing and the other form fields
+const MaxBodySize = maxReceiptSize + 1<<20
+
+// receiptTypes are the accepted receipt content types and the file extension they are stored with
+var receiptTypes = map[string]string{
+	"application/pdf": ".pdf",
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+}
+
+// receipt is an uploaded receipt file kept in the receipt storage
+type receipt struct {
+	Key, Name, ContentType string
+}
+
+// saveReceipt stores the multipart "receipt" file of a request, nil when none was sent
+func saveReceipt(c *fiber.Ctx, userID uint) (*receipt, error) {
+	file, err := c.FormFile("receipt")
+	if err != nil {
+		return nil, nil
+	}
+	if file.Size > maxReceiptSize {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Receipt should be at most 4 MB")
+	}
+	f, err := file.Open()
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Could not read uploaded receipt")
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Could not read uploaded receipt")
+	}
+
+	// Trust the content, not the name or header the client sent
+	contentType := http.DetectContentType(data)
+	ext, ok := receiptTypes[contentType]
+	if !ok {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Receipt should be a PDF, JPEG or PNG file")
+	}
+	token, err := utils.RandomToken(16)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Could not store receipt")
+	}
+	r := &receipt{
+		Key:         strconv.FormatUint(uint64(userID), 10) + "/" + token + ext,
+		Name:        filepath.Base(file.Filename),
+		ContentType: contentType,
+	}
+	if err := config.Receipts.Save(r.Key, bytes.NewReader(data)); err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Could not store receipt")
+	}
+	return r, nil
+}
+
+// sendReceipt streams the receipt of a claim
+func sendReceipt(c *fiber.Ctx, claim models.Reimbursement) error {
+	if claim.ReceiptKey == "" {
+		return fiber.NewError(fiber.StatusNotFound, "Claim has no receipt")
+	}
+	f, err := config.Receipts.Open(claim.ReceiptKey)
+	if errors.Is(err, storage.ErrNotFound) {
+		return fiber.NewError(fiber.StatusNotFound, "Receipt file not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Could not read receipt")
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Could not read receipt")
+	}
+	c.Set(fiber.HeaderContentType, claim.ReceiptContentType)
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="`+strings.ReplaceAll(claim.ReceiptName, `"`, "")+`"`)
+	return c.Send(data)
+}
+
+// checkClaimLimits rejects a claim above the per claim limit of its category, or that would take the employee's
+// pending and approved claims in the category over the monthly limit in the month of the expense
+func checkClaimLimits(db *gorm.DB, category models.ReimbursementCategory, claim models.Reimbursement) error {
+	if category.LimitPerClaim.IsPositive() && claim.Amount.Minor > category.LimitPerClaim.Minor {
+		return fiber.NewError(fiber.StatusBadRequest, "Amount is above the "+category.Name+" limit of "+category.LimitPerClaim.String()+" per claim")
+	}
+	if !category.LimitPerMonth.IsPositive() {
+		return nil
+	}
+	monthStart := time.Date(claim.Date.Year(), claim.Date.Month(), 1, 0, 0, 0, 0, time.UTC)
+	var sum struct{ Claimed money.Money }
+	err := db.Model(&models.Reimbursement{}).Select("COALESCE(SUM(amount), 0) AS claimed").
+		Where("user_id = ? AND category_id = ? AND status IN ? AND date BETWEEN ? AND ? AND id <> ?",
+			claim.UserID, category.ID, []string{models.ReimbursementStatusPending, models.ReimbursementStatusApproved},
+			monthStart, monthStart.AddDate(0, 1, -1), claim.ID).
+		Scan(&sum).Error
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Could not check the monthly limit")
+	}
+	claimed := sum.Claimed
+	if claimed.Add(claim.Amount).Minor > category.LimitPerMonth.Minor {
+		return fiber.NewError(fiber.StatusBadRequest, "Claims in "+category.Name+" would exceed the monthly limit of "+
+			category.LimitPerMonth.String()+", already claimed "+claimed.String())
+	}
+	return nil
+}
+
+// ListMyReimbursements lists the reimbursement claims of the logged in employee
+func ListMyReimbursements(c *fiber.Ctx) error {
+	user, err := GetUserProfile(c)
+	if err != nil {
+		return err
+	}
+	q := config.DB.Where("user_id = ?", user.ID).Order("date DESC")
+	if status := c.Query("status"); status != "" {
+		q = q.Where("status = ?", status)
+	}
+	var claims []models.Reimbursement
+	if err := q.Find(&claims).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not load reimbursements"})
+	}
+	return c.JSON(fiber.Map{"reimbursements": claims})
+}
+
+// findMyClaim loads a claim of the logged in employee
+func findMyClaim(c *fiber.Ctx) (models.Reimbursement, error) {
+	var claim models.Reimbursement
+	user, err := GetUserProfile(c)
+	if err != nil {
+		return claim, err
+	}
+	if err := config.DB.Where("user_id = ?", user.ID).First(&claim, c.Params("id")).Error; err != nil {
+		return claim, fiber.NewError(fiber.StatusNotFound, "Reimbursement not found")
+	}
+	return claim, nil
+}
+
+// UploadReceipt attaches a receipt to a pending claim of the logged in employee, replacing an earlier one
+func UploadReceipt(c *fiber.Ctx) error {
+	claim, err := findMyClaim(c)
+	if err != nil {
+		return err
+	}
+	if claim.Status != models.ReimbursementStatusPending {
+		return fiber.NewError(fiber.StatusBadRequest, "Reimbursement is already "+claim.Status)
+	}
+	r, err := saveReceipt(c, claim.UserID)
+	if err != nil {
+		return err
+	}
+	if r == nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid input",
+			"instruction": "Upload the receipt as the multipart field \"receipt\" (PDF, JPEG or PNG)",
+		})
+	}
+
+	previous := claim.ReceiptKey
+	claim.ReceiptKey, claim.ReceiptName, claim.ReceiptContentType = r.Key, r.Name, r.ContentType
+	claim.UpdatedBy = claim.UserID
+	if err := config.DB.Select("receipt_key", "receipt_name", "receipt_content_type", "updated_by").Updates(&claim).Error; err != nil {
+		config.Receipts.Delete(r.Key)
+		return fiber.NewError(fiber.StatusInternalServerError, "Could not save receipt")
+	}
+	if previous != "" {
+		config.Receipts.Delete(previous)
+	}
+	return c.JSON(fiber.Map{"message": "Receipt uploaded", "reimbursement": claim})
+}
+
+// GetMyReceipt downloads the receipt of a claim of the logged in employee
+func GetMyReceipt(c *fiber.Ctx) error {
+	claim, err := findMyClaim(c)
+	if err != nil {
+		return err
+	}
+	return sendReceipt(c, claim)
+}
+
+// ListReimbursementCategoriesForEmployee lists the active categories employees can claim
+func ListReimbursementCategoriesForEmployee(c *fiber.Ctx) error {
+	var categories []models.ReimbursementCategory
+	if err := config.DB.Where("active = ?", true).Order("id").Find(&categories).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not load reimbursement categories"})
+	}
+	return c.JSON(fiber.Map{"reimbursement_categories": categories})
+}
+
+// reimbursementCategoryInput is the payload to create or update a category. Nil fields are left unchanged on update.
+type reimbursementCategoryInput struct {
+	Code            *string      `json:"code"`
+	Name            *string      `json:"name"`
+	LimitPerClaim   *money.Money `json:"limit_per_claim"`
+	LimitPerMonth   *money.Money `json:"limit_per_month"`
+	ReceiptRequired *bool        `json:"receipt_required"`
+	Active          *bool        `json:"active"`
+}
+
+// apply validates the input and copies it onto the category
+func (in reimbursementCategoryInput) apply(cat *models.ReimbursementCategory) error {
+	if in.Code != nil {
+		code := strings.ToLower(strings.TrimSpace(*in.Code))
+		if code == "" || len(code) > 50 {
+			return fiber.NewError(fiber.StatusBadRequest, "code should be 1 to 50 characters")
+		}
+		cat.Code = code
+	}
+	if in.Name != nil {
+		if strings.TrimSpace(*in.Name) == "" {
+			return fiber.NewError(fiber.StatusBadRequest, "name is required")
+		}
+		cat.Name = strings.TrimSpace(*in.Name)
+	}
+	if in.LimitPerClaim != nil {
+		if in.LimitPerClaim.IsNegative() {
+			return fiber.NewError(fiber.StatusBadRequest, "limit_per_claim cannot be negative")
+		}
+		cat.LimitPerClaim = *in.LimitPerClaim
+	}
+	if in.LimitPerMonth != nil {
+		if in.LimitPerMonth.IsNegative() {
+			return fiber.NewError(fiber.StatusBadRequest, "limit_per_month cannot be negative")
+		}
+		cat.LimitPerMonth = *in.LimitPerMonth
+	}
+	if in.ReceiptRequired != nil {
+		cat.ReceiptRequired = *in.ReceiptRequired
+	}
+	if in.Active != nil {
+		cat.Active = *in.Active
+	}
+	return nil
+}
+
+// ListReimbursementCategories lists all reimbursement categories
+func ListReimbursementCategories(c *fiber.Ctx) error {
+	var categories []models.ReimbursementCategory
+	if err := config.DB.Order("id").Find(&categories).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch reimbursement categories")
+	}
+	return c.JSON(fiber.Map{"reimbursement_categories": categories})
+}
+
+// CreateReimbursementCategory defines a new expense category
+func CreateReimbursementCategory(c *fiber.Ctx) error {
+	var input reimbursementCategoryInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid input",
+			"instruction": "code and name are required; limit_per_claim, limit_per_month and receipt_required are optional",
+		})
+	}
+	if input.Code == nil || input.Name == nil {
+		return fiber.NewError(fiber.StatusBadRequest, "code and name are required")
+	}
+
+	admin, err := GetUserProfile(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnauthorized, "Unauthorized")
+	}
+	category := models.ReimbursementCategory{ReceiptRequired: true, Active: true, CreatedBy: admin.ID, UpdatedBy: admin.ID}
+	if err := input.apply(&category); err != nil {
+		return err
+	}
+	var count int64
+	config.DB.Model(&models.ReimbursementCategory{}).Where("code = ?", category.Code).Count(&count)
+	if count > 0 {
+		return fiber.NewError(fiber.StatusConflict, "Reimbursement category code already exists")
+	}
+	if err := config.DB.Create(&category).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to create reimbursement category")
+	}
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"message": "Reimbursement category created", "reimbursement_category": category})
+}
+
+// UpdateReimbursementCategory changes a category. New limits apply to claims submitted from now on.
+func UpdateReimbursementCategory(c *fiber.Ctx) error {
+	var input reimbursementCategoryInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid input",
+			"instruction": "Send any of code, name, limit_per_claim, limit_per_month, receipt_required and active",
+		})
+	}
+
+	admin, err := GetUserProfile(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnauthorized, "Unauthorized")
+	}
+	var category models.ReimbursementCategory
+	if err := config.DB.First(&category, c.Params("id")).Error; err != nil {
+		return fiber.NewError(fiber.StatusNotFound, "Reimbursement category not found")
+	}
+	if err := input.apply(&category); err != nil {
+		return err
+	}
+	var count int64
+	config.DB.Model(&models.ReimbursementCategory{}).Where("code = ? AND id <> ?", category.Code, category.ID).Count(&count)
+	if count > 0 {
+		return fiber.NewError(fiber.StatusConflict, "Reimbursement category code already exists")
+	}
+
+	category.UpdatedBy = admin.ID
+	if err := config.DB.Select("code", "name", "limit_per_claim", "limit_per_month", "receipt_required", "active", "updated_by").
+		Updates(&category).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to update reimbursement category")
+	}
+	return c.JSON(fiber.Map{"message": "Reimbursement category updated", "reimbursement_category": category})
+}
+
+// ListReimbursements lists reimbursement claims, optionally filtered by status, employee, category and attendance period.
+// On the manager routes only the claims of the manager's team are listed and can be reviewed.
+func ListReimbursements(c *fiber.Ctx) error {
+	q := config.DB.Scopes(teamScope(c)).Order("date DESC")
+	if status := c.Query("status"); status != "" {
+		q = q.Where("status = ?", status)
+	}
+	if employeeID := c.QueryInt("employee_id"); employeeID > 0 {
+		q = q.Where("user_id = ?", employeeID)
+	}
+	if categoryID := c.QueryInt("category_id"); categoryID > 0 {
+		q = q.Where("category_id = ?", categoryID)
+	}
+	if periodID := c.QueryInt("attendance_period_id"); periodID > 0 {
+		var period models.AttendancePeriod
+		if err := config.DB.First(&period, periodID).Error; err != nil {
+			return fiber.NewError(fiber.StatusNotFound, "Attendance period not found")
+		}
+		q = q.Where("date BETWEEN ? AND ?", period.StartDate, period.EndDate)
+	}
+	var claims []models.Reimbursement
+	if err := q.Find(&claims).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch reimbursements")
+	}
+	return c.JSON(fiber.Map{"reimbursements": claims})
+}
+
+// GetReimbursementReceipt downloads the receipt of any claim, or of a team member's claim on the manager routes
+func GetReimbursementReceipt(c *fiber.Ctx) error {
+	var claim models.Reimbursement
+	if err := config.DB.Scopes(teamScope(c)).First(&claim, c.Params("id")).Error; err != nil {
+		return fiber.NewError(fiber.StatusNotFound, "Reimbursement not found")
+	}
+	return sendReceipt(c, claim)
+}
+
+// reviewReimbursement approves or rejects a pending claim. A claim in a category that requires a receipt
+// is only approved with one; claims in a paid period can no longer be reviewed.
+func reviewReimbursement(c *fiber.Ctx, status string) error {
+	type Input struct {
+		Comment string `json:"comment"`
+	}
+	var input Input
+	if err := parseOptionalBody(c, &input); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid input",
+			"instruction": "Send the optional comment as JSON",
+		})
+	}
+
+	reviewer, err := GetUserProfile(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnauthorized, "Unauthorized")
+	}
+
+	var claim models.Reimbursement
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Scopes(teamScope(c)).Clauses(clause.Locking{Strength: "UPDATE"}).First(&claim, c.Params("id")).Error; err != nil {
+			return fiber.NewError(fiber.StatusNotFound, "Reimbursement not found")
+		}
+		if claim.Status != models.ReimbursementStatusPending {
+			return fiber.NewError(fiber.StatusBadRequest, "Reimbursement is already "+claim.Status)
+		}
+		period, err := findPeriod(tx, claim.Date)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Could not check attendance period")
+		}
+		if period != nil && period.Status == models.PeriodStatusPaid {
+			return fiber.NewError(fiber.StatusBadRequest, "Attendance period for this date is "+period.Status)
+		}
+		if status == models.ReimbursementStatusApproved && claim.CategoryID != 0 {
+			var category models.ReimbursementCategory
+			if err := tx.First(&category, claim.CategoryID).Error; err != nil {
+				return fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch reimbursement category")
+			}
+			if category.ReceiptRequired && claim.ReceiptKey == "" {
+				return fiber.NewError(fiber.StatusBadRequest, category.Name+" claims need a receipt before they can be approved")
+			}
+		}
+
+		now := time.Now()
+		claim.Status = status
+		claim.ReviewedBy = reviewer.ID
+		claim.ReviewedAt = &now
+		claim.ReviewComment = input.Comment
+		claim.UpdatedBy = reviewer.ID
+		return tx.Select("status", "reviewed_by", "reviewed_at", "review_comment", "updated_by").Updates(&claim).Error
+	})
+	if err != nil {
+		return err
+	}
+	return c.JSON(fiber.Map{"message": "Reimbursement " + status, "reimbursement": claim})
+}
+
+// ApproveReimbursement approves a pending claim so the next payroll run pays it
+func ApproveReimbursement(c *fiber.Ctx) error {
+	return reviewReimbursement(c, models.ReimbursementStatusApproved)
+}
+
+// RejectReimbursement rejects a pending claim
+func RejectReimbursement(c *fiber.Ctx) error {
+	return reviewReimbursement(c, models.ReimbursementStatusRejected)
+}
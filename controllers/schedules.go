@@ -0,0 +1,224 @@
+// controllers/schedules.go
+package controllers
+
+import (
+	"errors"
+	"go-payroll/config"
+	"go-payroll/models"
+	"go-payroll/payroll"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// loadWorkSchedule fetches the work schedule of a user, the default schedule when none is assigned.
+// It returns nil when there is no schedule at all, payroll then uses Monday to Friday.
+func loadWorkSchedule(db *gorm.DB, userID uint) (*models.WorkSchedule, error) {
+	var user models.User
+	if err := db.Select("id", "work_schedule_id").First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+	var schedule models.WorkSchedule
+	q := db.Where("is_default = ?", true)
+	if user.WorkScheduleID != nil {
+		q = db.Where("id = ?", *user.WorkScheduleID)
+	}
+	err := q.First(&schedule).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &schedule, nil
+}
+
+// workScheduleInput is the payload to create or update a work schedule. Nil fields are left unchanged on update.
+type workScheduleInput struct {
+	Code        *string  `json:"code"`
+	Name        *string  `json:"name"`
+	Weekdays    *string  `json:"weekdays"`
+	HoursPerDay *float64 `json:"hours_per_day"`
+	ShiftStart  *string  `json:"shift_start"`
+	ShiftEnd    *string  `json:"shift_end"`
+	Timezone    *string  `json:"timezone"`
+	IsDefault   *bool    `json:"is_default"`
+}
+
+// apply validates the input and copies it onto the work schedule
+func (in workScheduleInput) apply(s *models.WorkSchedule) error {
+	if in.Code != nil {
+		code := strings.ToLower(strings.TrimSpace(*in.Code))
+		if code == "" || len(code) > 50 {
+			return fiber.NewError(fiber.StatusBadRequest, "code should be 1 to 50 characters")
+		}
+		s.Code = code
+	}
+	if in.Name != nil {
+		if strings.TrimSpace(*in.Name) == "" {
+			return fiber.NewError(fiber.StatusBadRequest, "name is required")
+		}
+		s.Name = strings.TrimSpace(*in.Name)
+	}
+	if in.Weekdays != nil {
+		weekdays, err := payroll.ParseWeekdays(*in.Weekdays)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "weekdays should list days like mon,tue,wed: "+err.Error())
+		}
+		s.Weekdays = payroll.FormatWeekdays(weekdays)
+	}
+	if in.HoursPerDay != nil {
+		if *in.HoursPerDay <= 0 || *in.HoursPerDay > 24 {
+			return fiber.NewError(fiber.StatusBadRequest, "hours_per_day should be more than 0 and at most 24")
+		}
+		s.HoursPerDay = *in.HoursPerDay
+	}
+	for _, shift := range []struct {
+		value *string
+		field *string
+		name  string
+	}{{in.ShiftStart, &s.ShiftStart, "shift_start"}, {in.ShiftEnd, &s.ShiftEnd, "shift_end"}} {
+		if shift.value == nil {
+			continue
+		}
+		value := strings.TrimSpace(*shift.value)
+		if value != "" {
+			if _, err := time.Parse("15:04", value); err != nil {
+				return fiber.NewError(fiber.StatusBadRequest, shift.name+" should be HH:MM")
+			}
+		}
+		*shift.field = value
+	}
+	if (s.ShiftStart == "") != (s.ShiftEnd == "") {
+		return fiber.NewError(fiber.StatusBadRequest, "shift_start and shift_end are set together")
+	}
+	if s.ShiftStart != "" && s.ShiftStart == s.ShiftEnd {
+		return fiber.NewError(fiber.StatusBadRequest, "shift_end cannot equal shift_start")
+	}
+	if in.Timezone != nil {
+		timezone := strings.TrimSpace(*in.Timezone)
+		if _, err := time.LoadLocation(timezone); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "timezone should be an IANA time zone such as Asia/Jakarta")
+		}
+		s.Timezone = timezone
+	}
+	if in.IsDefault != nil {
+		s.IsDefault = *in.IsDefault
+	}
+	return nil
+}
+
+// saveWorkSchedule creates or updates a schedule; a new default schedule replaces the previous default
+func saveWorkSchedule(s *models.WorkSchedule) error {
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		if s.IsDefault {
+			if err := tx.Model(&models.WorkSchedule{}).Where("is_default = ? AND id <> ?", true, s.ID).
+				Update("is_default", false).Error; err != nil {
+				return err
+			}
+		}
+		if s.ID == 0 {
+			return tx.Create(s).Error
+		}
+		return tx.Select("code", "name", "weekdays", "hours_per_day", "shift_start", "shift_end", "timezone", "is_default", "updated_by").
+			Updates(s).Error
+	})
+}
+
+// ListWorkSchedules lists the work schedules
+func ListWorkSchedules(c *fiber.Ctx) error {
+	var schedules []models.WorkSchedule
+	if err := config.DB.Order("id").Find(&schedules).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch work schedules")
+	}
+	return c.JSON(fiber.Map{"work_schedules": schedules})
+}
+
+// CreateWorkSchedule defines a new work schedule
+func CreateWorkSchedule(c *fiber.Ctx) error {
+	var input workScheduleInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error":       "Invalid input",
+			"instruction": "code, name, weekdays (e.g. mon,tue,wed,thu,fri) and hours_per_day are required; shift_start, shift_end (HH:MM), timezone and is_default are optional",
+		})
+	}
+	if input.Code == nil || input.Name == nil || input.Weekdays == nil || input.HoursPerDay == nil {
+		return fiber.NewError(fiber.StatusBadRequest, "code, name, weekdays and hours_per_day are required")
+	}
+
+	admin, err := GetUserProfile(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnauthorized, "Unauthorized")
+	}
+	schedule := models.WorkSchedule{CreatedBy: admin.ID, UpdatedBy: admin.ID}
+	if err := input.apply(&schedule); err != nil {
+		return err
+	}
+	var count int64
+	config.DB.Model(&models.WorkSchedule{}).Where("code = ?", schedule.Code).Count(&count)
+	if count > 0 {
+		return fiber.NewError(fiber.StatusConflict, "Work schedule code already exists")
+	}
+	if err := saveWorkSchedule(&schedule); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to create work schedule")
+	}
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"message": "Work schedule created", "work_schedule": schedule})
+}
+
+// UpdateWorkSchedule changes a work schedule. Changed weekdays apply to payroll runs from now on,
+// leave that was already approved keeps its days.
+func UpdateWorkSchedule(c *fiber.Ctx) error {
+	var input workScheduleInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error":       "Invalid input",
+			"instruction": "Send any of code, name, weekdays, hours_per_day, shift_start, shift_end, timezone and is_default",
+		})
+	}
+
+	admin, err := GetUserProfile(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnauthorized, "Unauthorized")
+	}
+	var schedule models.WorkSchedule
+	if err := config.DB.First(&schedule, c.Params("id")).Error; err != nil {
+		return fiber.NewError(fiber.StatusNotFound, "Work schedule not found")
+	}
+	wasDefault := schedule.IsDefault
+	if err := input.apply(&schedule); err != nil {
+		return err
+	}
+	if wasDefault && !schedule.IsDefault {
+		return fiber.NewError(fiber.StatusBadRequest, "Make another schedule the default instead")
+	}
+	var count int64
+	config.DB.Model(&models.WorkSchedule{}).Where("code = ? AND id <> ?", schedule.Code, schedule.ID).Count(&count)
+	if count > 0 {
+		return fiber.NewError(fiber.StatusConflict, "Work schedule code already exists")
+	}
+
+	schedule.UpdatedBy = admin.ID
+	if err := saveWorkSchedule(&schedule); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to update work schedule")
+	}
+	return c.JSON(fiber.Map{"message": "Work schedule updated", "work_schedule": schedule})
+}
+
+// GetMySchedule shows the work schedule of the logged in employee
+func GetMySchedule(c *fiber.Ctx) error {
+	user, err := GetUserProfile(c)
+	if err != nil {
+		return err
+	}
+	schedule, err := loadWorkSchedule(config.DB, user.ID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch work schedule")
+	}
+	if schedule == nil {
+		return c.JSON(fiber.Map{"work_schedule": nil, "weekdays": payroll.FormatWeekdays(payroll.DefaultWeekdays)})
+	}
+	return c.JSON(fiber.Map{"work_schedule": schedule, "weekdays": schedule.Weekdays})
+}
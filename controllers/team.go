@@ -0,0 +1,70 @@
+// controllers/team.go
+package controllers
+
+import (
+	"go-payroll/config"
+	"go-payroll/models"
+	"slices"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// reportIDs lists the direct and indirect reports of a manager
+func reportIDs(db *gorm.DB, managerID uint) ([]uint, error) {
+	ids := []uint{}
+	// UNION drops rows already seen, so a cycle in the hierarchy cannot recurse forever
+	err := db.Raw(`WITH RECURSIVE team AS (
+			SELECT id FROM users WHERE manager_id = ?
+			UNION
+			SELECT u.id FROM users u JOIN team t ON u.manager_id = t.id
+		)
+		SELECT id FROM team WHERE id <> ? ORDER BY id`, managerID, managerID).Scan(&ids).Error
+	return ids, err
+}
+
+// RequireManager remembers the team of the logged in user, which the handlers behind it are limited to.
+// Who may call them at all is up to the route guards.
+func RequireManager(c *fiber.Ctx) error {
+	user, err := GetUserProfile(c)
+	if err != nil {
+		return err
+	}
+	team, err := reportIDs(config.DB, user.ID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load team")
+	}
+	c.Locals("team", team)
+	return c.Next()
+}
+
+// teamScope limits a query on a table with a user_id column to the manager's team on the manager routes.
+// Admin routes have no team and see everyone.
+func teamScope(c *fiber.Ctx) func(*gorm.DB) *gorm.DB {
+	return func(q *gorm.DB) *gorm.DB {
+		if team, ok := c.Locals("team").([]uint); ok {
+			return q.Where("user_id IN ?", team)
+		}
+		return q
+	}
+}
+
+// inTeam reports whether a user is visible on the current route: anyone on admin routes, the team on manager routes
+func inTeam(c *fiber.Ctx, userID uint) bool {
+	team, ok := c.Locals("team").([]uint)
+	return !ok || slices.Contains(team, userID)
+}
+
+// ListTeam lists the direct and indirect reports of the logged in manager
+func ListTeam(c *fiber.Ctx) error {
+	team, _ := c.Locals("team").([]uint)
+	var users []models.User
+	if err := config.DB.Preload("Roles").Where("id IN ?", team).Order("id").Find(&users).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch team")
+	}
+	employees := []fiber.Map{}
+	for _, u := range users {
+		employees = append(employees, employeeResponse(u))
+	}
+	return c.JSON(fiber.Map{"team": employees})
+}
@@ -0,0 +1,210 @@
+// export/payslip.go
+package export
+
+import (
+	"fmt"
+	"go-payroll/money"
+	"go-payroll/payroll"
+	"strconv"
+	"strings"
+)
+
+// PayslipDocument is everything printed on a payslip
+type PayslipDocument struct {
+	CompanyName    string
+	EmployeeName   string
+	Period         string // e.g. "2025-06-01 to 2025-06-30"
+	Status         string // optional, e.g. "voided"
+	Breakdown      payroll.Breakdown
+	Reimbursements []ReimbursementItem // optional itemisation of the reimbursement total
+}
+
+// ReimbursementItem is one reimbursement line on a payslip
+type ReimbursementItem struct {
+	Date   string
+	Desc   string
+	Amount money.Money
+}
+
+// RenderPayslipPDF renders a payslip as a single page PDF
+func RenderPayslipPDF(doc PayslipDocument) []byte {
+	const left, right = 50.0, PageWidth - 50
+	b := doc.Breakdown
+	p := NewPDF()
+
+	// Header
+	p.Text(left, 60, 18, true, doc.CompanyName)
+	p.TextRight(right, 60, 14, true, "PAYSLIP")
+	p.Line(left, 72, right, 72)
+
+	y := 95.0
+	for _, row := range [][2]string{
+		{"Employee", fmt.Sprintf("%s (ID %d)", doc.EmployeeName, b.UserID)},
+		{"Period", doc.Period},
+		{"Monthly salary", b.SalaryRate.CurrencyCode() + " " + FormatAmount(b.SalaryRate)},
+	} {
+		p.Text(left, y, 10, true, row[0])
+		p.Text(left+110, y, 10, false, row[1])
+		y += 16
+	}
+	if doc.Status != "" {
+		p.Text(left, y, 10, true, "Status")
+		p.Text(left+110, y, 10, false, strings.ToUpper(doc.Status))
+		y += 16
+	}
+
+	// Earnings
+	y += 14
+	p.Text(left, y, 12, true, "Earnings")
+	y += 6
+	p.Line(left, y, right, y)
+	y += 16
+	p.Text(left, y, 10, true, "Description")
+	p.TextRight(right-170, y, 10, true, "Quantity")
+	p.TextRight(right-90, y, 10, true, "Rate")
+	p.TextRight(right, y, 10, true, "Amount")
+	y += 16
+	baseLabel := "Base salary (days)"
+	if b.PaidLeaveDays > 0 {
+		baseLabel = fmt.Sprintf("Base salary (days, incl. %d paid leave)", b.PaidLeaveDays)
+	}
+	earnings := [][4]string{
+		{baseLabel, strconv.Itoa(b.AttendanceDays + b.PaidLeaveDays), FormatAmount(b.DailyRate), FormatAmount(b.BaseSalary)},
+	}
+	// A salary change inside the period gets a line per salary
+	if len(b.SalarySegments) > 1 {
+		earnings = nil
+		for _, seg := range b.SalarySegments {
+			from := seg.Start
+			if from.IsZero() {
+				from = seg.EffectiveFrom
+			}
+			earnings = append(earnings, [4]string{
+				"Base salary from " + from.Format("2006-01-02") + " (days)",
+				strconv.Itoa(seg.Days), FormatAmount(seg.DailyRate), FormatAmount(seg.Amount),
+			})
+		}
+	}
+	overtimeLabel := "Overtime (hours)"
+	if b.HolidayOvertimeHours > 0 {
+		overtimeLabel = "Overtime (hours, incl. " + strconv.FormatFloat(b.HolidayOvertimeHours, 'f', -1, 64) + " on holidays)"
+	}
+	earnings = append(earnings, [4]string{overtimeLabel, strconv.FormatFloat(b.OvertimeHours, 'f', -1, 64), "", FormatAmount(b.OvertimePay)})
+	for _, l := range b.Components {
+		if l.Kind == payroll.KindEarning {
+			earnings = append(earnings, [4]string{l.Name, "", "", FormatAmount(l.Amount)})
+		}
+	}
+	for _, row := range earnings {
+		p.Text(left, y, 10, false, row[0])
+		p.TextRight(right-170, y, 10, false, row[1])
+		p.TextRight(right-90, y, 10, false, row[2])
+		p.TextRight(right, y, 10, false, row[3])
+		y += 16
+	}
+	p.Text(left, y, 10, true, "Gross pay")
+	p.TextRight(right, y, 10, true, FormatAmount(b.GrossPay))
+	y += 16
+
+	// Deductions
+	y += 14
+	p.Text(left, y, 12, true, "Deductions")
+	y += 6
+	p.Line(left, y, right, y)
+	y += 16
+	deductions := [][2]string{}
+	for _, l := range b.Contributions {
+		if !l.EmployeeAmount.IsZero() {
+			deductions = append(deductions, [2]string{l.Name, FormatAmount(l.EmployeeAmount)})
+		}
+	}
+	if b.TaxMethod != "" || !b.TaxWithheld.IsZero() {
+		deductions = append(deductions, [2]string{"Income tax " + b.TaxMethod, FormatAmount(b.TaxWithheld)})
+	}
+	for _, l := range b.Components {
+		if l.Kind == payroll.KindDeduction {
+			deductions = append(deductions, [2]string{l.Name, FormatAmount(l.Amount)})
+		}
+	}
+	for _, row := range deductions {
+		p.Text(left, y, 10, false, row[0])
+		p.TextRight(right, y, 10, false, row[1])
+		y += 16
+	}
+	if len(deductions) == 0 {
+		p.Text(left, y, 10, false, "None")
+		y += 16
+	}
+
+	// Employer contributions are not deducted, they are shown as the cost on top of pay
+	if !b.EmployerContributions.IsZero() {
+		y += 14
+		p.Text(left, y, 12, true, "Employer contributions")
+		y += 6
+		p.Line(left, y, right, y)
+		y += 16
+		for _, l := range b.Contributions {
+			if l.EmployerAmount.IsZero() {
+				continue
+			}
+			p.Text(left, y, 10, false, l.Name)
+			p.TextRight(right, y, 10, false, FormatAmount(l.EmployerAmount))
+			y += 16
+		}
+		p.Text(left, y, 10, true, "Total employer contributions")
+		p.TextRight(right, y, 10, true, FormatAmount(b.EmployerContributions))
+		y += 16
+	}
+
+	// Reimbursements
+	y += 14
+	p.Text(left, y, 12, true, "Reimbursements")
+	y += 6
+	p.Line(left, y, right, y)
+	y += 16
+	for _, item := range doc.Reimbursements {
+		p.Text(left, y, 10, false, item.Date)
+		p.Text(left+80, y, 10, false, item.Desc)
+		p.TextRight(right, y, 10, false, FormatAmount(item.Amount))
+		y += 16
+		// Keep the totals on the page, the rest is already summed in the total
+		if y > PageHeight-160 {
+			p.Text(left, y, 10, false, "...")
+			y += 16
+			break
+		}
+	}
+	p.Text(left, y, 10, true, "Total reimbursements")
+	p.TextRight(right, y, 10, true, FormatAmount(b.ReimbursementTotal))
+	y += 16
+
+	// Take home
+	y += 14
+	p.Line(left, y, right, y)
+	y += 20
+	p.Text(left, y, 13, true, "Take home pay ("+b.TakeHomePay.CurrencyCode()+")")
+	p.TextRight(right, y, 13, true, FormatAmount(b.TakeHomePay))
+
+	return p.Bytes()
+}
+
+// FormatAmount formats an amount with thousand separators, e.g. 1,234,567.89
+func FormatAmount(m money.Money) string {
+	s := m.String()
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	whole, frac := s, ""
+	if i := strings.Index(s, "."); i >= 0 {
+		whole, frac = s[:i], s[i:]
+	}
+	var out []byte
+	for i := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			out = append(out, ',')
+		}
+		out = append(out, whole[i])
+	}
+	return sign + string(out) + frac
+}
@@ -0,0 +1,54 @@
+// export/table.go
+package export
+
+import (
+	"encoding/csv"
+	"go-payroll/money"
+	"io"
+	"strconv"
+)
+
+// Table is a sheet of rows; cells are strings, ints, float64s or money so spreadsheets keep numbers numeric
+type Table struct {
+	Header []string
+	Rows   [][]interface{}
+}
+
+// WriteCSV writes the table as CSV with a header row
+func WriteCSV(w io.Writer, t Table) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(t.Header); err != nil {
+		return err
+	}
+	for _, row := range t.Rows {
+		record := make([]string, len(row))
+		for i, cell := range row {
+			record[i] = cellString(cell)
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func cellString(cell interface{}) string {
+	switch v := cell.(type) {
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case uint:
+		return strconv.FormatUint(uint64(v), 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case money.Money:
+		return v.String()
+	case nil:
+		return ""
+	}
+	return ""
+}
@@ -0,0 +1,83 @@
+package ical
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func calendar(events ...string) string {
+	return "BEGIN:VCALENDAR\r\nVERSION:2.0\r\n" + strings.Join(events, "") + "END:VCALENDAR\r\n"
+}
+
+func date(s string) time.Time {
+	d, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func TestParse(t *testing.T) {
+	ics := calendar(
+		"BEGIN:VEVENT\r\nUID:1\r\nSUMMARY:New Year\\, Day\r\nDTSTART;VALUE=DATE:20250101\r\nDTEND;VALUE=DATE:20250102\r\nEND:VEVENT\r\n",
+		// folded summary and a two day event
+		"BEGIN:VEVENT\r\nUID:2\r\nSUMMARY:Eid al-\r\n Fitr\r\nDTSTART;VALUE=DATE:20250331\r\nDTEND;VALUE=DATE:20250402\r\nEND:VEVENT\r\n",
+		// no DTEND is a single day
+		"BEGIN:VEVENT\r\nUID:3\r\nSUMMARY:Labour Day\r\nDTSTART:20250501T000000Z\r\nEND:VEVENT\r\n",
+		// 23:00 in Jakarta is still the 17th there, though the 17th ends at 16:00 UTC
+		"BEGIN:VEVENT\r\nUID:4\r\nSUMMARY:Independence Day\r\nDTSTART;TZID=Asia/Jakarta:20250817T230000\r\nEND:VEVENT\r\n",
+	)
+	events, err := Parse(strings.NewReader(ics))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	want := []struct {
+		summary string
+		days    []string
+	}{
+		{"New Year, Day", []string{"2025-01-01"}},
+		{"Eid al-Fitr", []string{"2025-03-31", "2025-04-01"}},
+		{"Labour Day", []string{"2025-05-01"}},
+		{"Independence Day", []string{"2025-08-17"}},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("Parse = %d events, want %d", len(events), len(want))
+	}
+	for i, w := range want {
+		e := events[i]
+		var days []string
+		for _, d := range e.Days() {
+			days = append(days, d.Format("2006-01-02"))
+		}
+		if e.Summary != w.summary || strings.Join(days, ",") != strings.Join(w.days, ",") {
+			t.Errorf("event %d = %q on %v, want %q on %v", i, e.Summary, days, w.summary, w.days)
+		}
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	for name, event := range map[string]string{
+		"no DTSTART":   "BEGIN:VEVENT\r\nSUMMARY:x\r\nEND:VEVENT\r\n",
+		"bad date":     "BEGIN:VEVENT\r\nDTSTART;VALUE=DATE:2025-01-01\r\nEND:VEVENT\r\n",
+		"unknown TZID": "BEGIN:VEVENT\r\nDTSTART;TZID=Mars/Olympus:20250101T090000\r\nEND:VEVENT\r\n",
+		"a year long":  "BEGIN:VEVENT\r\nDTSTART;VALUE=DATE:20250101\r\nDTEND;VALUE=DATE:20260101\r\nEND:VEVENT\r\n",
+		"END unopened": "END:VEVENT\r\n",
+	} {
+		if _, err := Parse(strings.NewReader(calendar(event))); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
+
+func TestParseAllowsTheLongestSpan(t *testing.T) {
+	end := date("2025-01-01").AddDate(0, 0, MaxEventDays).Format("20060102")
+	events, err := Parse(strings.NewReader(calendar("BEGIN:VEVENT\r\nDTSTART;VALUE=DATE:20250101\r\nDTEND;VALUE=DATE:" + end + "\r\nEND:VEVENT\r\n")))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if got := len(events[0].Days()); got != MaxEventDays {
+		t.Errorf("Days = %d, want %d", got, MaxEventDays)
+	}
+}
@@ -3,6 +3,7 @@ package main
 
 import (
 	"go-payroll/config"
+	"go-payroll/controllers"
 	"go-payroll/routes"
 	"os"
 	"time"
@@ -14,8 +15,11 @@ import (
 
 func main() {
     godotenv.Load()
+    config.LoadPayrollSettings()
+    config.LoadStorage()
+    config.LoadAuthSettings()
     config.ConnectDB(os.Getenv("DB_DSN"))
-    app := fiber.New()
+    app := fiber.New(fiber.Config{BodyLimit: controllers.MaxBodySize})
 		// Fiber logger middleware
 		app.Use(logger.New(logger.Config{
 				TimeFormat: time.RFC3339,
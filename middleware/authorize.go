@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"go-payroll/config"
+	"go-payroll/models"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Authorize lets the request through when the user holds the permission the route guard of the path
+// requires. Runs after JWTProtected. Routes without a guard are refused.
+func Authorize() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID, ok := c.Locals("user_id").(float64)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Invalid user ID in token",
+			})
+		}
+
+		method := c.Method()
+		if method == fiber.MethodHead {
+			method = fiber.MethodGet
+		}
+		var guards []models.RouteGuard
+		if err := config.DB.Where("method = ?", method).Find(&guards).Error; err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to load route guards")
+		}
+		guard := matchGuard(guards, c.Path())
+		if guard == nil {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Access forbidden: route has no guard",
+			})
+		}
+
+		allowed, err := HasPermission(config.DB, uint(userID), guard.Permission)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to check permissions")
+		}
+		if !allowed {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Access forbidden: requires " + guard.Permission,
+			})
+		}
+		return c.Next()
+	}
+}
+
+// HasPermission reports whether an active user holds the permission through one of their roles
+func HasPermission(db *gorm.DB, userID uint, permission string) (bool, error) {
+	var count int64
+	err := db.Table("user_roles").
+		Joins("JOIN users ON users.id = user_roles.user_id").
+		Joins("JOIN role_permissions ON role_permissions.role_id = user_roles.role_id").
+		Joins("JOIN permissions ON permissions.id = role_permissions.permission_id").
+		Where("user_roles.user_id = ? AND users.status = ? AND permissions.code = ?", userID, models.UserStatusActive, permission).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// matchGuard finds the guard whose path pattern matches the path. A literal segment wins over a :param
+// in the same place, so /holidays/import is not taken for /holidays/:id.
+func matchGuard(guards []models.RouteGuard, path string) *models.RouteGuard {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	var best *models.RouteGuard
+	bestParams := -1
+	for i := range guards {
+		pattern := strings.Split(strings.Trim(guards[i].Path, "/"), "/")
+		if len(pattern) != len(segments) {
+			continue
+		}
+		params := 0
+		for j, part := range pattern {
+			if strings.HasPrefix(part, ":") && segments[j] != "" {
+				params++
+			} else if !strings.EqualFold(part, segments[j]) {
+				params = -1
+				break
+			}
+		}
+		if params >= 0 && (best == nil || params < bestParams) {
+			best, bestParams = &guards[i], params
+		}
+	}
+	return best
+}
@@ -1,14 +1,34 @@
 package models
 
-import "time"
+import (
+	"go-payroll/money"
+	"time"
+)
 
 // User represents an employee or admin in the system
 type User struct {
 	ID        uint      `gorm:"primaryKey"`
 	Username  string    `gorm:"unique;not null"`
 	Password  string    `gorm:"not null"` // hashed
-	Role      string    `gorm:"not null"` // "employee" or "admin"
-	Salary    float64   `gorm:"default:0"`
+	Role      string    `gorm:"not null"` // primary role, kept for older clients; access comes from Roles
+	Salary    money.Money `gorm:"type:numeric(20,2);default:0"`
+	Department string     `gorm:"index"`
+	HireDate   *time.Time
+	Status     string     `gorm:"not null;default:active;index"` // "active" or "inactive"
+	//tax status
+	Married    bool `gorm:"default:false"`
+	Dependents int  `gorm:"default:0"`
+	//work schedule, nil for the default schedule
+	WorkScheduleID *uint `gorm:"index"`
+	//reporting line
+	ManagerID *uint `gorm:"index"` // reports to this user
+	//access
+	Roles []Role `gorm:"many2many:user_roles"`
+	//payout details
+	PayoutMethod      string          `gorm:"default:bank_transfer"` // "bank_transfer" or "cash"
+	BankName          string
+	BankAccountNumber EncryptedString // encrypted at rest, mask before returning it
+	BankAccountName   string
 	//info
 	CreatedAt time.Time `gorm:"autoCreateTime"`
 	UpdatedAt time.Time
@@ -16,25 +36,301 @@ type User struct {
 	UpdatedBy uint
 }
 
+// User roles seeded on start, admins may add more
+const (
+	RoleEmployee = "employee"
+	RoleAdmin    = "admin"
+	RoleManager  = "manager" // reviews the requests of their direct and indirect reports
+	RoleAuditor  = "auditor" // read-only access to employees, payroll and configuration
+)
+
+// Permissions, granted to users through their roles and required by route guards
+const (
+	PermEmployeeRead    = "employee:read"
+	PermEmployeeWrite   = "employee:write"
+	PermPeriodManage    = "period:manage"
+	PermPayrollView     = "payroll:view"
+	PermPayrollRun      = "payroll:run"
+	PermPayrollExport   = "payroll:export"
+	PermConfigRead      = "config:read"
+	PermConfigWrite     = "config:write"
+	PermApprovalsView   = "approvals:view"
+	PermApprovalsReview = "approvals:review"
+	PermTeamReview      = "team:review"
+	PermSelfService     = "self:service"
+	PermRBACManage      = "rbac:manage"
+)
+
+// Permission is a named capability. The set is fixed by the code and seeded on start.
+type Permission struct {
+	ID          uint   `gorm:"primaryKey"`
+	Code        string `gorm:"unique;not null"`
+	Description string
+}
+
+// Role is a named set of permissions users can hold several of
+type Role struct {
+	ID          uint         `gorm:"primaryKey"`
+	Code        string       `gorm:"unique;not null"`
+	Name        string       `gorm:"not null"`
+	Permissions []Permission `gorm:"many2many:role_permissions"`
+	//info
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+	UpdatedAt time.Time
+	CreatedBy uint
+	UpdatedBy uint
+}
+
+// RouteGuard is the permission a route requires. Path is the route pattern with :params, as registered.
+type RouteGuard struct {
+	ID         uint   `gorm:"primaryKey"`
+	Method     string `gorm:"not null;uniqueIndex:idx_route_guard"`
+	Path       string `gorm:"not null;uniqueIndex:idx_route_guard"`
+	Permission string `gorm:"not null"`
+	//info
+	UpdatedAt time.Time
+	UpdatedBy uint
+}
+
+// User status
+const (
+	UserStatusActive   = "active"
+	UserStatusInactive = "inactive"
+)
+
+// SalaryHistory records a salary and the date it takes effect. The entry in effect on a date is
+// the one with the latest EffectiveFrom not after it; User.Salary mirrors the entry in effect when last changed.
+type SalaryHistory struct {
+	ID            uint      `gorm:"primaryKey"`
+	UserID        uint      `gorm:"not null;uniqueIndex:idx_salary_history_user_date"`
+	Salary        money.Money `gorm:"type:numeric(20,2);not null"`
+	EffectiveFrom time.Time `gorm:"not null;uniqueIndex:idx_salary_history_user_date"`
+	Note          string
+	//info
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+	CreatedBy uint
+}
+
+// Payout methods
+const (
+	PayoutBankTransfer = "bank_transfer"
+	PayoutCash         = "cash"
+)
+
+// Pay component types
+const (
+	ComponentFixedAllowance = "fixed_allowance" // earning of a fixed amount every period
+	ComponentPercentOfBase  = "percent_of_base" // earning of a percentage of the period's base salary
+	ComponentBonus          = "bonus"           // earning paid once, in the first run on or after its start date
+	ComponentLoanRepayment  = "loan_repayment"  // deduction of an installment every period until the principal is repaid
+	ComponentDeduction      = "deduction"       // deduction of a fixed amount every period
+)
+
+// PayComponent is an earning or deduction admins define once and assign to employees
+type PayComponent struct {
+	ID      uint   `gorm:"primaryKey"`
+	Code    string `gorm:"unique;not null"`
+	Name    string `gorm:"not null"`
+	Type    string `gorm:"not null"`
+	Taxable bool   `gorm:"not null"` // earnings only, non taxable earnings are left out of taxable income
+	Active  bool   `gorm:"not null"` // inactive components cannot be assigned anymore
+	//info
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+	UpdatedAt time.Time
+	CreatedBy uint
+	UpdatedBy uint
+}
+
+// EmployeePayComponent assigns a pay component to an employee between two dates
+type EmployeePayComponent struct {
+	ID             uint         `gorm:"primaryKey"`
+	UserID         uint         `gorm:"not null;index"`
+	PayComponentID uint         `gorm:"not null;index"`
+	PayComponent   PayComponent
+	Amount         money.Money `gorm:"type:numeric(20,2);default:0"` // per period, the bonus itself or the loan installment
+	Rate           string      // percentage of base salary, e.g. "12.5"
+	Principal      money.Money `gorm:"type:numeric(20,2);default:0"` // loan amount, repayments stop once it is repaid
+	StartDate      time.Time   `gorm:"not null"`
+	EndDate        *time.Time  // inclusive, nil for open ended
+	Note           string
+	//info
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+	UpdatedAt time.Time
+	CreatedBy uint
+	UpdatedBy uint
+}
+
+// PayrollComponentLine is the amount a payroll run paid or deducted for a pay component assignment,
+// used to know when a bonus was paid, how much of a loan is left and what deductions are in arrears
+type PayrollComponentLine struct {
+	ID                     uint        `gorm:"primaryKey"`
+	PayrollProcessedID     uint        `gorm:"not null;index"`
+	UserID                 uint        `gorm:"not null;index"`
+	EmployeePayComponentID uint        `gorm:"not null;index"`
+	Amount                 money.Money `gorm:"type:numeric(20,2)"`
+	Shortfall              money.Money `gorm:"type:numeric(20,2)"` // what the net pay could not cover, still owed for deductions
+	CreatedAt              time.Time   `gorm:"autoCreateTime"`
+}
+
 // Attendance represents a daily attendance record for an employee
 type Attendance struct {
 	ID         uint      `gorm:"primaryKey"`
-	UserID     uint      `gorm:"not null"`
-	Date       time.Time `gorm:"not null;index"` // Must be unique per user+date
+	UserID     uint      `gorm:"not null;uniqueIndex:idx_attendance_user_date"`
+	Date       time.Time `gorm:"not null;index;uniqueIndex:idx_attendance_user_date"` // one attendance per user and date
 	//info
 	CreatedAt  time.Time `gorm:"autoCreateTime"`
 	UpdatedAt  time.Time
 	CreatedBy  uint
 	IPAddress  string
+	Holiday    bool `gorm:"default:false"` // submitted on a public holiday, see HOLIDAY_ATTENDANCE
+	//time tracking, empty for attendance submitted by date only
+	ClockIn     *time.Time
+	ClockOut    *time.Time
+	WorkedHours float64
+	Late        bool `gorm:"default:false"` // clocked in after the scheduled shift start
+	LeftEarly   bool `gorm:"default:false"` // clocked out before the scheduled shift end
 	PayrollProcessedID uint // Reference to all the attendence records for a period
 }
 
+// Attendance correction status
+const (
+	CorrectionStatusPending  = "pending"
+	CorrectionStatusApproved = "approved"
+	CorrectionStatusRejected = "rejected"
+)
+
+// AttendanceCorrection asks to add missing attendance or fix the clock times of a day, applied when approved
+type AttendanceCorrection struct {
+	ID           uint       `gorm:"primaryKey"`
+	UserID       uint       `gorm:"not null;index"`
+	Date         time.Time  `gorm:"not null"`
+	ClockIn      *time.Time // nil to record attendance for the date without times
+	ClockOut     *time.Time
+	Reason       string     `gorm:"not null"`
+	Status       string     `gorm:"not null;default:pending;index"`
+	AttendanceID uint       // attendance created or changed on approval
+	//review
+	ReviewedBy    uint
+	ReviewedAt    *time.Time
+	ReviewComment string
+	//info
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+	UpdatedAt time.Time
+	CreatedBy uint
+	IPAddress string
+}
+
+// Holiday is a public holiday, a day that is not a working day
+type Holiday struct {
+	ID     uint      `gorm:"primaryKey"`
+	Date   time.Time `gorm:"not null;unique"`
+	Name   string    `gorm:"not null"`
+	Source string    // "manual" or the name of the imported .ics file
+	//info
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+	UpdatedAt time.Time
+	CreatedBy uint
+}
+
+// WorkSchedule defines the working weekdays, daily hours and shift times of the employees assigned to it
+type WorkSchedule struct {
+	ID          uint    `gorm:"primaryKey"`
+	Code        string  `gorm:"unique;not null"`
+	Name        string  `gorm:"not null"`
+	Weekdays    string  `gorm:"not null"` // working weekdays, e.g. "mon,tue,wed,thu,fri"
+	HoursPerDay float64 `gorm:"not null"`
+	ShiftStart  string  // HH:MM, empty for flexible hours
+	ShiftEnd    string  // HH:MM, before ShiftStart for a shift ending the next day
+	Timezone    string  // IANA time zone of the shift times, e.g. Asia/Jakarta; UTC when empty
+	IsDefault   bool    `gorm:"not null"` // applies to employees without a schedule of their own
+	//info
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+	UpdatedAt time.Time
+	CreatedBy uint
+	UpdatedBy uint
+}
+
+// LeaveType is a kind of leave employees can request, e.g. annual, sick or unpaid
+type LeaveType struct {
+	ID                  uint    `gorm:"primaryKey"`
+	Code                string  `gorm:"unique;not null"`
+	Name                string  `gorm:"not null"`
+	Paid                bool    `gorm:"not null"`  // paid leave days count as paid days in payroll
+	AccrualDaysPerMonth float64 `gorm:"default:0"` // days earned per month of service in a calendar year, 0 for no balance limit
+	MaxDaysPerYear      float64 `gorm:"default:0"` // cap on the days earned in a calendar year, 0 for no cap
+	Active              bool    `gorm:"not null"`
+	//info
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+	UpdatedAt time.Time
+	CreatedBy uint
+	UpdatedBy uint
+}
+
+// Leave request status
+const (
+	LeaveStatusPending   = "pending"
+	LeaveStatusApproved  = "approved"
+	LeaveStatusRejected  = "rejected"
+	LeaveStatusCancelled = "cancelled"
+)
+
+// LeaveRequest is an employee's request for leave between two dates, both inclusive
+type LeaveRequest struct {
+	ID            uint      `gorm:"primaryKey"`
+	UserID        uint      `gorm:"not null;index"`
+	LeaveTypeID   uint      `gorm:"not null;index"`
+	LeaveType     LeaveType
+	StartDate     time.Time `gorm:"not null"`
+	EndDate       time.Time `gorm:"not null"`
+	Days          int       // working days in the range
+	Reason        string
+	Status        string    `gorm:"not null;default:pending;index"`
+	ReviewedBy    uint
+	ReviewedAt    *time.Time
+	ReviewComment string
+	//info
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+	UpdatedAt time.Time
+	CreatedBy uint
+	IPAddress string
+}
+
+// LeaveDay is one working day of an approved leave request, paid through payroll like an attendance day
+type LeaveDay struct {
+	ID                 uint      `gorm:"primaryKey"`
+	UserID             uint      `gorm:"not null;uniqueIndex:idx_leave_day_user_date"`
+	Date               time.Time `gorm:"not null;uniqueIndex:idx_leave_day_user_date"`
+	LeaveRequestID     uint      `gorm:"not null;index"`
+	Paid               bool
+	PayrollProcessedID uint // Reference to the payroll run that paid the day
+	CreatedAt          time.Time `gorm:"autoCreateTime"`
+}
+
+// Overtime source
+const (
+	OvertimeSourceManual = "manual" // submitted by the employee
+	OvertimeSourceClock  = "clock"  // derived from a clock-out past the shift end
+)
+
+// Overtime status, only approved overtime is paid
+const (
+	OvertimeStatusPending  = "pending"
+	OvertimeStatusApproved = "approved"
+	OvertimeStatusRejected = "rejected"
+)
+
 // Overtime represents additional hours worked by an employee
 type Overtime struct {
 	ID        uint      `gorm:"primaryKey"`
 	UserID    uint      `gorm:"index"`
 	Date      time.Time `gorm:"index;not null"`
 	Hours     float64   `gorm:"not null"`
+	Source    string    `gorm:"default:manual"` // OvertimeSourceManual or OvertimeSourceClock
+	Status    string    `gorm:"not null;default:approved;index"` // overtime from before approvals counts as approved
+	//review
+	ReviewedBy    uint
+	ReviewedAt    *time.Time
+	ReviewComment string
 	//info
 	CreatedAt time.Time `gorm:"autoCreateTime"`
 	UpdatedAt time.Time
@@ -44,12 +340,46 @@ type Overtime struct {
 	PayrollProcessedID uint // Reference to all the overtime attendence records for a period
 }
 
+// ReimbursementCategory is a kind of expense employees can claim, with optional limits
+type ReimbursementCategory struct {
+	ID              uint        `gorm:"primaryKey"`
+	Code            string      `gorm:"unique;not null"`
+	Name            string      `gorm:"not null"`
+	LimitPerClaim   money.Money `gorm:"type:numeric(20,2);default:0"` // 0 for no limit
+	LimitPerMonth   money.Money `gorm:"type:numeric(20,2);default:0"` // on the pending and approved claims of an employee per calendar month, 0 for no limit
+	ReceiptRequired bool        `gorm:"not null"`
+	Active          bool        `gorm:"not null"`
+	//info
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+	UpdatedAt time.Time
+	CreatedBy uint
+	UpdatedBy uint
+}
+
+// Reimbursement claim status, only approved claims are paid
+const (
+	ReimbursementStatusPending  = "pending"
+	ReimbursementStatusApproved = "approved"
+	ReimbursementStatusRejected = "rejected"
+)
+
 // Reimbursement represents an expense claim by an employee
 type Reimbursement struct {
 	ID        uint      `gorm:"primaryKey"`
 	UserID    uint      `gorm:"index"`
-	Amount    float64   `gorm:"not null"`
+	Amount    money.Money `gorm:"type:numeric(20,2);not null"`
 	Desc      string
+	Date      time.Time `gorm:"index"` // Date of the expense
+	CategoryID uint     `gorm:"index"` // 0 for claims from before categories
+	Status     string   `gorm:"not null;default:approved;index"` // claims from before approvals count as approved
+	//receipt
+	ReceiptKey         string `json:"-"` // storage key of the uploaded file
+	ReceiptName        string
+	ReceiptContentType string
+	//review
+	ReviewedBy    uint
+	ReviewedAt    *time.Time
+	ReviewComment string
 	//info
 	CreatedAt time.Time `gorm:"autoCreateTime"`
 	UpdatedAt time.Time
@@ -59,6 +389,39 @@ type Reimbursement struct {
 	PayrollProcessedID uint // Reference to all the reimbursement records for a period
 }
 
+// Session is a login. Its refresh tokens rotate on every use and revoking it rejects
+// the access tokens issued in it.
+type Session struct {
+	ID              string `gorm:"type:uuid;primaryKey"` // the sid claim of its access tokens
+	UserID          uint   `gorm:"not null;index"`
+	IPAddress       string
+	UserAgent       string
+	LastRefreshedAt *time.Time
+	RevokedAt       *time.Time `gorm:"index"`
+	RevokedReason   string
+	//info
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+// Reasons a session was revoked
+const (
+	SessionRevokedLogout          = "logout"
+	SessionRevokedTokenReuse      = "refresh_token_reuse" // a refresh token was used twice, it may have been stolen
+	SessionRevokedDeactivated     = "deactivated"
+	SessionRevokedPasswordChanged = "password_changed"
+)
+
+// RefreshToken is a single use refresh token of a session, stored hashed
+type RefreshToken struct {
+	ID        uint       `gorm:"primaryKey"`
+	SessionID string     `gorm:"type:uuid;not null;index"`
+	TokenHash string     `gorm:"not null;unique"` // SHA-256 of the token
+	ExpiresAt time.Time  `gorm:"not null"`
+	UsedAt    *time.Time // set once exchanged for new tokens
+	//info
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
 //logging all the requests to the API
 type AuditLog struct {
 	RequestID string `gorm:"type:uuid"`
@@ -69,30 +432,95 @@ type AuditLog struct {
 	CreatedAt  time.Time `gorm:"autoCreateTime"`
 }
 
-//run this function every day to log the daily payroll using cron job (not implemented here)
+// DailyPayroll is the immutable per-employee payroll line written by each payroll run.
+// Salary figures are snapshotted so payslips for closed periods can be reproduced
+// even after the user's Salary changes.
 type DailyPayroll struct {
-	ID                uint      `gorm:"primaryKey"`
-	UserID            uint      `gorm:"index"`
-	PayrollProcessedID uint     `gorm:"index"`
-	TotalAttendance   int
-	BaseSalary        float64
-	TotalOvertime     float64
-	OvertimePay       float64
-	ReimbursementTotal float64
-	TakeHomePay       float64
+	ID                    uint        `gorm:"primaryKey"`
+	UserID                uint        `gorm:"index;uniqueIndex:idx_daily_payroll_user_run"`
+	PayrollProcessedID    uint        `gorm:"index;uniqueIndex:idx_daily_payroll_user_run"`
+	SalaryRate            money.Money `gorm:"type:numeric(20,2)"` // monthly salary at the time of the run
+	DailyRate             money.Money `gorm:"type:numeric(20,2)"`
+	WorkingDays           int         // daily rate divisor
+	TotalAttendance       int
+	TotalPaidLeave        int
+	TotalUnpaidLeave      int
+	BaseSalary            money.Money `gorm:"type:numeric(20,2)"` // (attendance + paid leave days) × daily rate
+	SalarySegments        string      `gorm:"type:text"`          // JSON of the salary segments the base salary was prorated over
+	TotalOvertime         float64
+	TotalHolidayOvertime  float64
+	OvertimePay           money.Money `gorm:"type:numeric(20,2)"`
+	Components            string      `gorm:"type:text"` // JSON of the pay component lines
+	ComponentEarnings     money.Money `gorm:"type:numeric(20,2)"`
+	ComponentDeductions   money.Money `gorm:"type:numeric(20,2)"`
+	GrossPay              money.Money `gorm:"type:numeric(20,2)"`
+	Contributions         string      `gorm:"type:text"` // JSON of the statutory contribution lines
+	EmployeeContributions money.Money `gorm:"type:numeric(20,2)"`
+	EmployerContributions money.Money `gorm:"type:numeric(20,2)"`
+	TaxableIncome         money.Money `gorm:"type:numeric(20,2)"` // gross pay + taxable employer premiums
+	TaxDeductible         money.Money `gorm:"type:numeric(20,2)"` // employee contributions that reduce taxable income
+	TaxWithheld           money.Money `gorm:"type:numeric(20,2)"`
+	TaxMethod             string
+	ReimbursementTotal    money.Money `gorm:"type:numeric(20,2)"`
+	TakeHomePay           money.Money `gorm:"type:numeric(20,2)"`
+	Currency              string      `gorm:"size:3"` // currency of the amounts, empty before it was recorded
+	Reversed              bool        `gorm:"default:false"` // set when the run is voided
+	ReversedAt            *time.Time
 	//info
-	CreatedAt         time.Time
-	UpdatedAt         time.Time
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+	UpdatedAt time.Time
+	CreatedBy uint
 }
 
+// Attendance period lifecycle: draft -> open -> closed -> paid
+const (
+	PeriodStatusDraft  = "draft"
+	PeriodStatusOpen   = "open"
+	PeriodStatusClosed = "closed"
+	PeriodStatusPaid   = "paid"
+)
+
 // AttendancePeriod represents a period for which attendance and payroll are processed
+type AttendancePeriod struct {
+	ID        uint      `gorm:"primaryKey"`
+	StartDate time.Time `gorm:"not null;index"`
+	EndDate   time.Time `gorm:"not null;index"` // inclusive
+	Status    string    `gorm:"not null;default:draft"` // "draft", "open", "closed" or "paid"
+	//info
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+	UpdatedAt time.Time
+	CreatedBy uint
+	UpdatedBy uint
+	IPAddress string
+}
+
+// Contains reports whether the date falls inside the period
+func (p AttendancePeriod) Contains(date time.Time) bool {
+	return !date.Before(p.StartDate) && !date.After(p.EndDate)
+}
+
+// Payroll run status
+const (
+	PayrollStatusCompleted = "completed"
+	PayrollStatusVoided    = "voided"
+)
+
+// PayrollProcessed is a payroll run for an attendance period
 type PayrollProcessed struct {
-	ID                uint      `gorm:"primaryKey"`
-	Date							time.Time `gorm:"not null;index"` // e.g. "2023-10-01 to 2023-10-15"
-	//info
-	CreatedAt         time.Time `gorm:"autoCreateTime"`
-	UpdatedAt         time.Time
-	CreatedBy         uint
-	UpdatedBy         uint
-	IPAddress         string
-}
\ No newline at end of file
+	ID                 uint      `gorm:"primaryKey"`
+	AttendancePeriodID uint      `gorm:"index"`
+	Date               time.Time `gorm:"not null;index"` // date the payroll was run
+	IdempotencyKey     *string   `gorm:"uniqueIndex"`    // Idempotency-Key header of the request that created the run
+	Status             string    `gorm:"not null;default:completed"` // "completed" or "voided"
+	VoidedAt           *time.Time
+	VoidedBy           uint
+	VoidReason         string
+	BankFileExportedAt *time.Time // last export of the bank file, its transfers may have been sent
+	BankFileExportedBy uint
+	//info
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+	UpdatedAt time.Time
+	CreatedBy uint
+	UpdatedBy uint
+	IPAddress string
+}
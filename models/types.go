@@ -0,0 +1,40 @@
+package models
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"go-payroll/utils"
+)
+
+// EncryptedString is a string column encrypted at rest with utils.EncryptString
+type EncryptedString string
+
+// Value encrypts the string before it is written
+func (s EncryptedString) Value() (driver.Value, error) {
+	if s == "" {
+		return "", nil
+	}
+	return utils.EncryptString(string(s))
+}
+
+// Scan decrypts the stored value
+func (s *EncryptedString) Scan(value interface{}) error {
+	var stored string
+	switch v := value.(type) {
+	case nil:
+		*s = ""
+		return nil
+	case string:
+		stored = v
+	case []byte:
+		stored = string(v)
+	default:
+		return fmt.Errorf("cannot scan %T into EncryptedString", value)
+	}
+	plain, err := utils.DecryptString(stored)
+	if err != nil {
+		return err
+	}
+	*s = EncryptedString(plain)
+	return nil
+}
@@ -0,0 +1,211 @@
+// money/money.go
+package money
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// DefaultCurrency is the ISO 4217 code of amounts read from the database or JSON without one
+var DefaultCurrency = "IDR"
+
+// minorUnits is the number of decimals per currency, 2 unless listed
+var minorUnits = map[string]int{
+	"JPY": 0,
+	"KRW": 0,
+	"VND": 0,
+	"BHD": 3,
+	"KWD": 3,
+}
+
+// StoredScale is the number of decimals the numeric(20,2) amount columns keep. Only currencies
+// with that many minor unit decimals can be stored without losing or inventing precision.
+const StoredScale = 2
+
+// Scale returns the number of minor unit decimals of a currency
+func Scale(currency string) int {
+	if scale, ok := minorUnits[currency]; ok {
+		return scale
+	}
+	return 2
+}
+
+// Money is an exact amount in minor units (e.g. cents) of a currency.
+// Amounts that are added together must share a currency; payroll runs in a single currency.
+type Money struct {
+	Minor    int64
+	Currency string
+}
+
+// New creates an amount from minor units
+func New(minor int64, currency string) Money {
+	return Money{Minor: minor, Currency: currency}
+}
+
+// FromMajor creates an amount in the default currency from whole units, e.g. FromMajor(5000000) is 5,000,000.00
+func FromMajor(major int64) Money {
+	return Money{Minor: major * pow10(Scale(DefaultCurrency)), Currency: DefaultCurrency}
+}
+
+// Parse reads a decimal amount in the default currency, e.g. "1234.56". More decimals than
+// the currency has are rejected rather than silently rounded.
+func Parse(s string) (Money, error) {
+	currency := DefaultCurrency
+	r, ok := new(big.Rat).SetString(strings.TrimSpace(s))
+	if !ok {
+		return Money{}, fmt.Errorf("invalid amount %q", s)
+	}
+	minor := new(big.Rat).Mul(r, new(big.Rat).SetInt64(pow10(Scale(currency))))
+	if !minor.IsInt() {
+		return Money{}, fmt.Errorf("amount %q has more than %d decimals", s, Scale(currency))
+	}
+	if !minor.Num().IsInt64() {
+		return Money{}, fmt.Errorf("amount %q is too large", s)
+	}
+	return Money{Minor: minor.Num().Int64(), Currency: currency}, nil
+}
+
+// FromRat rounds an exact value in major units to the currency's minor units
+func FromRat(r *big.Rat, currency string, mode RoundingMode) Money {
+	minor := new(big.Rat).Mul(r, new(big.Rat).SetInt64(pow10(Scale(currency))))
+	return Money{Minor: roundRat(minor, mode).Int64(), Currency: currency}
+}
+
+// Rat returns the exact value in major units
+func (m Money) Rat() *big.Rat {
+	return new(big.Rat).SetFrac(big.NewInt(m.Minor), big.NewInt(pow10(Scale(m.currency()))))
+}
+
+// Add returns the sum of two amounts. An amount without a currency takes the other's, adding
+// amounts in different currencies panics.
+func (m Money) Add(o Money) Money {
+	return Money{Minor: m.Minor + o.Minor, Currency: commonCurrency(m, o)}
+}
+
+// commonCurrency returns the currency two amounts share, panicking when they do not
+func commonCurrency(a, b Money) string {
+	switch {
+	case a.Currency == "":
+		return b.currency()
+	case b.Currency == "" || a.Currency == b.Currency:
+		return a.Currency
+	}
+	panic(fmt.Sprintf("money: mixing %s and %s amounts", a.Currency, b.Currency))
+}
+
+// Sub returns the difference of two amounts
+func (m Money) Sub(o Money) Money {
+	return m.Add(Money{Minor: -o.Minor, Currency: o.Currency})
+}
+
+// Neg returns the amount with its sign flipped
+func (m Money) Neg() Money {
+	return Money{Minor: -m.Minor, Currency: m.Currency}
+}
+
+// Min returns the smaller of two amounts, which must share a currency
+func Min(a, b Money) Money {
+	commonCurrency(a, b)
+	if b.Minor < a.Minor {
+		return b
+	}
+	return a
+}
+
+func (m Money) IsZero() bool     { return m.Minor == 0 }
+func (m Money) IsNegative() bool { return m.Minor < 0 }
+func (m Money) IsPositive() bool { return m.Minor > 0 }
+
+// CurrencyCode returns the currency, the default one when unset
+func (m Money) CurrencyCode() string {
+	return m.currency()
+}
+
+func (m Money) currency() string {
+	if m.Currency == "" {
+		return DefaultCurrency
+	}
+	return m.Currency
+}
+
+// String formats the amount as a plain decimal, e.g. "-1234.50"
+func (m Money) String() string {
+	scale := Scale(m.currency())
+	minor := m.Minor
+	sign := ""
+	if minor < 0 {
+		sign, minor = "-", -minor
+	}
+	s := strconv.FormatInt(minor, 10)
+	if scale == 0 {
+		return sign + s
+	}
+	if len(s) <= scale {
+		s = strings.Repeat("0", scale-len(s)+1) + s
+	}
+	return sign + s[:len(s)-scale] + "." + s[len(s)-scale:]
+}
+
+// MarshalJSON writes the amount as an exact JSON number, e.g. 1234.50
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON accepts a JSON number or a decimal string
+func (m *Money) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	if s == "null" || s == "" {
+		*m = Money{}
+		return nil
+	}
+	parsed, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// Value stores the amount in a numeric column
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
+
+// Scan reads a numeric column in the default currency
+func (m *Money) Scan(value interface{}) error {
+	var s string
+	switch v := value.(type) {
+	case nil:
+		*m = Money{Currency: DefaultCurrency}
+		return nil
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	case int64:
+		*m = Money{Minor: v * pow10(Scale(DefaultCurrency)), Currency: DefaultCurrency}
+		return nil
+	case float64:
+		// Columns not yet migrated to numeric
+		s = strconv.FormatFloat(v, 'f', Scale(DefaultCurrency), 64)
+	default:
+		return fmt.Errorf("cannot scan %T into Money", value)
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return fmt.Errorf("invalid amount %q", s)
+	}
+	*m = FromRat(r, DefaultCurrency, HalfEven)
+	return nil
+}
+
+func pow10(n int) int64 {
+	p := int64(1)
+	for i := 0; i < n; i++ {
+		p *= 10
+	}
+	return p
+}
@@ -0,0 +1,147 @@
+package money
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{in: "1234.56", want: 123456},
+		{in: " 1234.5 ", want: 123450},
+		{in: "-0.01", want: -1},
+		{in: "1000000", want: 100000000},
+		{in: "1/4", want: 25},
+		{in: "0.001", wantErr: true},
+		{in: "12,50", wantErr: true},
+		{in: "", wantErr: true},
+		{in: "92233720368547758.08", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("Parse(%q) = %v, want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.in, err)
+			continue
+		}
+		if got.Minor != tt.want || got.Currency != DefaultCurrency {
+			t.Errorf("Parse(%q) = %d %s, want %d %s", tt.in, got.Minor, got.Currency, tt.want, DefaultCurrency)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		m    Money
+		want string
+	}{
+		{New(123456, "IDR"), "1234.56"},
+		{New(-5, "IDR"), "-0.05"},
+		{New(0, "IDR"), "0.00"},
+		{New(1234, "JPY"), "1234"},
+		{New(-1234, "KWD"), "-1.234"},
+		{Money{Minor: 7}, "0.07"},
+	}
+	for _, tt := range tests {
+		if got := tt.m.String(); got != tt.want {
+			t.Errorf("%#v.String() = %q, want %q", tt.m, got, tt.want)
+		}
+	}
+}
+
+func TestFromRat(t *testing.T) {
+	tests := []struct {
+		value    string
+		currency string
+		mode     RoundingMode
+		want     string
+	}{
+		{"0.125", "IDR", HalfEven, "0.12"},
+		{"0.135", "IDR", HalfEven, "0.14"},
+		{"0.125", "IDR", HalfUp, "0.13"},
+		{"0.1249", "IDR", HalfUp, "0.12"},
+		{"0.129", "IDR", Down, "0.12"},
+		{"-0.125", "IDR", HalfEven, "-0.12"},
+		{"-0.125", "IDR", HalfUp, "-0.13"},
+		{"-0.129", "IDR", Down, "-0.12"},
+		{"1000000/21", "IDR", HalfEven, "47619.05"},
+		{"2.5", "JPY", HalfEven, "2"},
+		{"3.5", "JPY", HalfEven, "4"},
+		{"1.0005", "KWD", HalfUp, "1.001"},
+	}
+	for _, tt := range tests {
+		r, ok := new(big.Rat).SetString(tt.value)
+		if !ok {
+			t.Fatalf("bad test value %q", tt.value)
+		}
+		if got := FromRat(r, tt.currency, tt.mode).String(); got != tt.want {
+			t.Errorf("FromRat(%s %s, %d) = %s, want %s", tt.value, tt.currency, tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestArithmetic(t *testing.T) {
+	a, b := New(1050, "IDR"), New(300, "IDR")
+	if got := a.Add(b); got != New(1350, "IDR") {
+		t.Errorf("Add = %v", got)
+	}
+	if got := a.Sub(b); got != New(750, "IDR") {
+		t.Errorf("Sub = %v", got)
+	}
+	if got := Min(a, b); got != b {
+		t.Errorf("Min = %v", got)
+	}
+	if got := (Money{}).Add(New(5, "JPY")); got != New(5, "JPY") {
+		t.Errorf("an amount without a currency should take the other's, got %#v", got)
+	}
+}
+
+func TestMixedCurrenciesPanic(t *testing.T) {
+	idr, usd := New(100, "IDR"), New(100, "USD")
+	for name, f := range map[string]func(){
+		"Add": func() { idr.Add(usd) },
+		"Sub": func() { usd.Sub(idr) },
+		"Min": func() { Min(idr, usd) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s of IDR and USD did not panic", name)
+				}
+			}()
+			f()
+		}()
+	}
+}
+
+func TestScan(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		want  int64
+	}{
+		{"1234.56", 123456},
+		{[]byte("0.10"), 10},
+		{int64(3), 300},
+		{0.1 + 0.2, 30},
+		{nil, 0},
+	}
+	for _, tt := range tests {
+		var m Money
+		if err := m.Scan(tt.value); err != nil {
+			t.Errorf("Scan(%v): %v", tt.value, err)
+			continue
+		}
+		if m.Minor != tt.want || m.Currency != DefaultCurrency {
+			t.Errorf("Scan(%v) = %#v, want %d %s", tt.value, m, tt.want, DefaultCurrency)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+// money/rounding.go
+package money
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// RoundingMode decides how a value between two minor units is rounded
+type RoundingMode int
+
+const (
+	HalfEven RoundingMode = iota // ties go to the even neighbour, the default (banker's rounding)
+	HalfUp                       // ties go away from zero
+	Down                         // truncate towards zero
+)
+
+// RoundingScope decides at which point amounts are rounded
+type RoundingScope int
+
+const (
+	PerLine  RoundingScope = iota // round every payslip line, the total is the sum of the rounded lines
+	PerTotal                      // keep lines exact and round only the total
+)
+
+// Rounding is the rounding policy of a payroll calculation
+type Rounding struct {
+	Mode  RoundingMode
+	Scope RoundingScope
+}
+
+// ParseRoundingMode reads "half_even", "half_up" or "down"
+func ParseRoundingMode(s string) (RoundingMode, error) {
+	switch s {
+	case "", "half_even":
+		return HalfEven, nil
+	case "half_up":
+		return HalfUp, nil
+	case "down":
+		return Down, nil
+	}
+	return HalfEven, fmt.Errorf("unknown rounding mode %q", s)
+}
+
+// ParseRoundingScope reads "line" or "total"
+func ParseRoundingScope(s string) (RoundingScope, error) {
+	switch s {
+	case "", "line":
+		return PerLine, nil
+	case "total":
+		return PerTotal, nil
+	}
+	return PerLine, fmt.Errorf("unknown rounding scope %q", s)
+}
+
+// roundRat rounds an exact value to an integer
+func roundRat(r *big.Rat, mode RoundingMode) *big.Int {
+	num, den := r.Num(), r.Denom()
+	quo, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+	if rem.Sign() == 0 || mode == Down {
+		return quo
+	}
+
+	// Compare twice the remainder with the denominator to find which side of the half we are on
+	twice := new(big.Int).Abs(rem)
+	twice.Lsh(twice, 1)
+	cmp := twice.Cmp(den)
+	away := cmp > 0 || (cmp == 0 && (mode == HalfUp || quo.Bit(0) == 1))
+	if away {
+		if r.Sign() < 0 {
+			quo.Sub(quo, big.NewInt(1))
+		} else {
+			quo.Add(quo, big.NewInt(1))
+		}
+	}
+	return quo
+}
@@ -0,0 +1,93 @@
+// payroll/calendar.go
+package payroll
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// DefaultWeekdays are the working weekdays of a calendar without a work schedule
+var DefaultWeekdays = []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}
+
+// Calendar decides which days are working days: the scheduled weekdays that are not public holidays
+type Calendar struct {
+	Holidays    map[string]string // YYYY-MM-DD to holiday name
+	Weekdays    []time.Weekday    // working weekdays of the employee's schedule, DefaultWeekdays when empty
+	HoursPerDay float64           // scheduled hours of a working day, Rules.HoursPerDay when 0
+}
+
+// IsHoliday reports whether a date is a public holiday. A nil calendar has no holidays.
+func (c *Calendar) IsHoliday(date time.Time) bool {
+	if c == nil {
+		return false
+	}
+	_, ok := c.Holidays[date.Format("2006-01-02")]
+	return ok
+}
+
+// IsScheduled reports whether the weekday of a date is a working weekday, holidays aside
+func (c *Calendar) IsScheduled(date time.Time) bool {
+	weekdays := DefaultWeekdays
+	if c != nil && len(c.Weekdays) > 0 {
+		weekdays = c.Weekdays
+	}
+	return slices.Contains(weekdays, date.Weekday())
+}
+
+// IsWorkingDay reports whether a date is a scheduled weekday that is not a holiday
+func (c *Calendar) IsWorkingDay(date time.Time) bool {
+	return c.IsScheduled(date) && !c.IsHoliday(date)
+}
+
+// WorkingDays lists the working days between two dates, both inclusive
+func (c *Calendar) WorkingDays(start, end time.Time) []time.Time {
+	var days []time.Time
+	for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
+		if c.IsWorkingDay(d) {
+			days = append(days, d)
+		}
+	}
+	return days
+}
+
+// WorkingDaysInMonth counts the working days of the calendar month of a date
+func (c *Calendar) WorkingDaysInMonth(date time.Time) int {
+	first := time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, date.Location())
+	return len(c.WorkingDays(first, first.AddDate(0, 1, -1)))
+}
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// ParseWeekdays reads a comma separated list of weekdays such as "mon,tue,wed", in the order of the week
+func ParseWeekdays(s string) ([]time.Weekday, error) {
+	var weekdays []time.Weekday
+	for _, name := range strings.Split(s, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if len(name) > 3 {
+			name = name[:3]
+		}
+		day, ok := weekdayNames[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown weekday %q", name)
+		}
+		if !slices.Contains(weekdays, day) {
+			weekdays = append(weekdays, day)
+		}
+	}
+	slices.Sort(weekdays)
+	return weekdays, nil
+}
+
+// FormatWeekdays writes weekdays the way ParseWeekdays reads them
+func FormatWeekdays(weekdays []time.Weekday) string {
+	names := make([]string, len(weekdays))
+	for i, day := range weekdays {
+		names[i] = strings.ToLower(day.String()[:3])
+	}
+	return strings.Join(names, ",")
+}
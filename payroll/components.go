@@ -0,0 +1,104 @@
+// payroll/components.go
+package payroll
+
+import (
+	"fmt"
+	"go-payroll/models"
+	"go-payroll/money"
+	"math/big"
+	"sort"
+)
+
+// Component line kinds
+const (
+	KindEarning   = "earning"
+	KindDeduction = "deduction"
+)
+
+// ComponentLine is what one pay component assignment adds to or takes from a payslip
+type ComponentLine struct {
+	AssignmentID uint        `json:"assignment_id"`
+	Code         string      `json:"code"`
+	Name         string      `json:"name"`
+	Type         string      `json:"type"`
+	Kind         string      `json:"kind"` // earning or deduction
+	Taxable      bool        `json:"taxable"`
+	Amount       money.Money `json:"amount"`
+	Shortfall    money.Money `json:"shortfall"` // part of a deduction the net pay could not cover
+}
+
+// ComponentKind tells whether a pay component type is an earning or a deduction, empty for unknown types
+func ComponentKind(componentType string) string {
+	switch componentType {
+	case models.ComponentFixedAllowance, models.ComponentPercentOfBase, models.ComponentBonus:
+		return KindEarning
+	case models.ComponentLoanRepayment, models.ComponentDeduction:
+		return KindDeduction
+	}
+	return ""
+}
+
+// componentLines returns a line for every assignment in effect during the pay period.
+// An assignment is in effect when it starts on or before the pay date and does not end before the period starts.
+// Deductions also take their arrears, ended ones only their arrears.
+func componentLines(in Input, baseSalary money.Money, round func(*big.Rat) money.Money) ([]ComponentLine, error) {
+	periodStart := in.PeriodStart
+	if periodStart.IsZero() {
+		periodStart = in.PayDate
+	}
+	assignments := append([]models.EmployeePayComponent(nil), in.Components...)
+	sort.Slice(assignments, func(i, j int) bool { return assignments[i].ID < assignments[j].ID })
+
+	var lines []ComponentLine
+	for _, a := range assignments {
+		inEffect := !a.StartDate.After(in.PayDate) && (a.EndDate == nil || !a.EndDate.Before(periodStart))
+		component := a.PayComponent
+		if !inEffect && component.Type != models.ComponentDeduction {
+			continue
+		}
+		paid := in.ComponentsPaid[a.ID]
+
+		var amount money.Money
+		switch component.Type {
+		case models.ComponentFixedAllowance:
+			amount = a.Amount
+		case models.ComponentDeduction:
+			amount = money.New(0, a.Amount.CurrencyCode()).Add(in.ComponentsArrears[a.ID])
+			if inEffect {
+				amount = amount.Add(a.Amount)
+			}
+		case models.ComponentPercentOfBase:
+			rate, ok := new(big.Rat).SetString(a.Rate)
+			if !ok {
+				return nil, fmt.Errorf("pay component %s: invalid rate %q", component.Code, a.Rate)
+			}
+			rate.Quo(rate, big.NewRat(100, 1))
+			amount = round(rate.Mul(rate, baseSalary.Rat()))
+		case models.ComponentBonus:
+			if !paid.IsZero() {
+				continue
+			}
+			amount = a.Amount
+		case models.ComponentLoanRepayment:
+			amount = money.Min(a.Amount, a.Principal.Sub(paid))
+		default:
+			return nil, fmt.Errorf("pay component %s: unknown type %q", component.Code, component.Type)
+		}
+		if !amount.IsPositive() {
+			continue
+		}
+
+		kind := ComponentKind(component.Type)
+		lines = append(lines, ComponentLine{
+			AssignmentID: a.ID,
+			Code:         component.Code,
+			Name:         component.Name,
+			Type:         component.Type,
+			Kind:         kind,
+			Taxable:      kind == KindEarning && component.Taxable,
+			Amount:       amount,
+			Shortfall:    money.New(0, amount.CurrencyCode()),
+		})
+	}
+	return lines, nil
+}
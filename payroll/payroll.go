@@ -0,0 +1,378 @@
+// payroll/payroll.go
+package payroll
+
+import (
+	"go-payroll/contributions"
+	"go-payroll/models"
+	"go-payroll/money"
+	"go-payroll/tax"
+	"math/big"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Rules holds the constants used to turn attendance into pay
+type Rules struct {
+	WorkingDaysPerMonth       int64                 // Daily rate = Salary / WorkingDaysPerMonth when the input has no calendar
+	HoursPerDay               int64                 // Hourly rate = Daily rate / HoursPerDay, unless the calendar has scheduled hours
+	OvertimeMultiplier        int64                 // Overtime pay = multiplier × hourly rate × hours
+	HolidayOvertimeMultiplier int64                 // multiplier for overtime on public holidays
+	Rounding                  money.Rounding        // how and when amounts are rounded to minor units
+	Tax                       tax.Jurisdiction      // income tax withheld from gross pay, nil for none
+	Contributions             *contributions.Scheme // statutory contributions, nil for none
+}
+
+// Input is everything a payroll calculation for one employee looks at
+type Input struct {
+	User           models.User
+	Salaries       []models.SalaryHistory
+	Attendances    []models.Attendance
+	LeaveDays      []models.LeaveDay // approved leave, paid days count like attendance
+	Overtimes      []models.Overtime
+	Reimbursements []models.Reimbursement
+	Calendar       *Calendar                     // working days and holidays of the months worked, nil for the WorkingDaysPerMonth fallback
+	PayDate        time.Time                     // end of the pay period, decides the tax year
+	PeriodStart    time.Time                     // start of the pay period, PayDate when unknown
+	FinalPeriod    bool                          // last period of the tax year for the employee, which reconciles the annual tax
+	YearToDate     YearToDate                    // earlier pay in the same tax year
+	Components     []models.EmployeePayComponent // pay component assignments with their PayComponent loaded
+	ComponentsPaid map[uint]money.Money          // per assignment, what earlier completed runs paid or deducted
+	// per deduction assignment, what earlier completed runs could not deduct and is still owed
+	ComponentsArrears map[uint]money.Money
+}
+
+// YearToDate sums the payroll lines of earlier runs in the same tax year
+type YearToDate struct {
+	TaxableIncome money.Money
+	TaxDeductible money.Money
+	TaxWithheld   money.Money
+}
+
+// DefaultRules are the company payroll rules
+var DefaultRules = Rules{
+	WorkingDaysPerMonth:       20,
+	HoursPerDay:               8,
+	OvertimeMultiplier:        2,
+	HolidayOvertimeMultiplier: 3,
+	Rounding:                  money.Rounding{Mode: money.HalfEven, Scope: money.PerLine},
+}
+
+// Breakdown is the result of a payroll calculation for one employee
+type Breakdown struct {
+	UserID                uint                 `json:"employee_id"`
+	SalaryRate            money.Money          `json:"base_salary_rate"` // salary in effect at the end of the calculation
+	DailyRate             money.Money          `json:"daily_rate"`
+	WorkingDays           int                  `json:"working_days"` // daily rate divisor for the month of DailyRate
+	AttendanceDays        int                  `json:"attendance_days"`
+	PaidLeaveDays         int                  `json:"paid_leave_days"`
+	UnpaidLeaveDays       int                  `json:"unpaid_leave_days"`
+	BaseSalary            money.Money          `json:"base_salary_total"`
+	SalarySegments        []SalarySegment      `json:"salary_segments,omitempty"` // one per salary in effect, oldest first
+	OvertimeHours         float64              `json:"overtime_hours"`
+	HolidayOvertimeHours  float64              `json:"holiday_overtime_hours"` // part of OvertimeHours paid at the holiday multiplier
+	OvertimePay           money.Money          `json:"overtime_pay"`
+	Components            []ComponentLine      `json:"components,omitempty"`
+	ComponentEarnings     money.Money          `json:"component_earnings"`
+	ComponentDeductions   money.Money          `json:"component_deductions"`
+	GrossPay              money.Money          `json:"gross_pay"` // base salary + overtime + component earnings
+	Contributions         []contributions.Line `json:"contributions,omitempty"`
+	EmployeeContributions money.Money          `json:"employee_contributions"` // deducted from pay
+	EmployerContributions money.Money          `json:"employer_contributions"` // employer cost on top of pay
+	TaxableIncome         money.Money          `json:"taxable_income"`         // gross pay + taxable employer premiums
+	TaxDeductible         money.Money          `json:"tax_deductible"`         // employee contributions that reduce taxable income
+	TaxWithheld           money.Money          `json:"tax_withheld"`
+	TaxMethod             string               `json:"tax_method,omitempty"`
+	ReimbursementTotal    money.Money          `json:"reimbursement_total"`
+	TakeHomePay           money.Money          `json:"take_home_pay"`
+	Currency              string               `json:"currency"`
+}
+
+// SalarySegment is the base pay for the days, attendance and paid leave, paid at one daily rate:
+// one salary within one month, as the working days of the month divide the salary
+type SalarySegment struct {
+	EffectiveFrom time.Time   `json:"effective_from"`
+	Start         time.Time   `json:"start"` // first day the daily rate applies, the later of EffectiveFrom and the month start
+	WorkingDays   int         `json:"working_days"`
+	Salary        money.Money `json:"salary"`
+	DailyRate     money.Money `json:"daily_rate"`
+	Days          int         `json:"days"`
+	Amount        money.Money `json:"amount"`
+}
+
+// salaryTimeline answers which salary was in effect on a date
+type salaryTimeline struct {
+	fallback money.Money
+	history  []models.SalaryHistory // sorted by EffectiveFrom
+}
+
+func newSalaryTimeline(user models.User, history []models.SalaryHistory) salaryTimeline {
+	sorted := append([]models.SalaryHistory(nil), history...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].EffectiveFrom.Before(sorted[j].EffectiveFrom) })
+	return salaryTimeline{fallback: user.Salary, history: sorted}
+}
+
+// on returns the entry in effect on a date. Dates before the first entry use the earliest known salary.
+func (t salaryTimeline) on(date time.Time) (time.Time, money.Money) {
+	if len(t.history) == 0 {
+		return time.Time{}, t.fallback
+	}
+	entry := t.history[0]
+	for _, h := range t.history {
+		if h.EffectiveFrom.After(date) {
+			break
+		}
+		entry = h
+	}
+	return entry.EffectiveFrom, entry.Salary
+}
+
+// hoursRat converts hours to an exact value using their shortest decimal form, so 0.1 is exactly 1/10
+func hoursRat(hours float64) *big.Rat {
+	r, _ := new(big.Rat).SetString(strconv.FormatFloat(hours, 'f', -1, 64))
+	return r
+}
+
+/*
+Calculate computes the pay for a user from their salary history, attendance, leave, overtime and reimbursement
+records and the pay components assigned to them.
+Statutory contributions under rules.Contributions are deducted and reported as employer cost, income tax is
+withheld under rules.Tax; reimbursements are not taxed.
+Each attendance day, paid leave day and overtime record is paid at the salary in effect on its date, so a raise
+in the middle of a period only applies from its effective date. Without salary history user.Salary is used.
+Intermediate values are exact; rules.Rounding decides whether each line or only the take home pay is rounded.
+
+	RULES:
+	- Daily rate = Base Salary / working days (scheduled weekdays that are not holidays) of the month of the day
+	- Base Salary = (Attendance Days + Paid Leave Days) * Daily Rate, summed per salary segment
+	- Overtime Pay = OvertimeMultiplier * (Daily Rate / scheduled hours per day) * Overtime Hours, HolidayOvertimeMultiplier on holidays
+	- Component Earnings = SUM of allowances, percentages of Base Salary and bonuses in effect
+	- Component Deductions = SUM of loan repayments and deductions in effect plus deduction arrears, taken in assignment
+	  order while Gross Pay - Employee Contributions - Tax Withheld lasts; the rest is the line's shortfall, owed again
+	  next run for deductions and left on the balance for loans
+	- Gross Pay = Base Salary + Overtime Pay + Component Earnings
+	- Contributions = program rate * program basis (base salary or gross pay), reduced by the share of the monthly wage over the program wage cap
+	- Taxable Income = Gross Pay - non taxable earnings + employer contributions that are taxable benefits
+	- Tax Withheld = rules.Tax withholding on Taxable Income
+	- Reimbursement Total = SUM of reimbursements
+	- Take Home Pay = Gross Pay - Employee Contributions - Tax Withheld - Component Deductions + Reimbursement Total
+*/
+func Calculate(in Input, rules Rules) (Breakdown, error) {
+	user, salaries, attendances, overtimes, reimbursements := in.User, in.Salaries, in.Attendances, in.Overtimes, in.Reimbursements
+	currency := user.Salary.CurrencyCode()
+	round := func(r *big.Rat) money.Money { return money.FromRat(r, currency, rules.Rounding.Mode) }
+	timeline := newSalaryTimeline(user, salaries)
+	workingDays := func(date time.Time) int64 {
+		if in.Calendar != nil {
+			return int64(in.Calendar.WorkingDaysInMonth(date))
+		}
+		return rules.WorkingDaysPerMonth
+	}
+	dailyRate := func(salary money.Money, date time.Time) *big.Rat {
+		days := workingDays(date)
+		if days <= 0 {
+			return new(big.Rat)
+		}
+		return new(big.Rat).Quo(salary.Rat(), big.NewRat(days, 1))
+	}
+	hoursPerDay := big.NewRat(rules.HoursPerDay, 1)
+	if in.Calendar != nil && in.Calendar.HoursPerDay > 0 {
+		hoursPerDay = new(big.Rat).SetFloat64(in.Calendar.HoursPerDay)
+	}
+	hourlyRate := func(salary money.Money, date time.Time) *big.Rat {
+		if hoursPerDay.Sign() <= 0 {
+			return new(big.Rat)
+		}
+		return new(big.Rat).Quo(dailyRate(salary, date), hoursPerDay)
+	}
+
+	// Group paid days, attendance and paid leave, by the salary in effect
+	var days []time.Time
+	for _, a := range attendances {
+		days = append(days, a.Date)
+	}
+	paidLeave, unpaidLeave := 0, 0
+	for _, l := range in.LeaveDays {
+		if !l.Paid {
+			unpaidLeave++
+			continue
+		}
+		days = append(days, l.Date)
+		paidLeave++
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Before(days[j]) })
+	var segments []SalarySegment
+	for _, day := range days {
+		from, salary := timeline.on(day)
+		start := time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, day.Location())
+		if from.After(start) {
+			start = from
+		}
+		if n := len(segments); n == 0 || !segments[n-1].Start.Equal(start) {
+			segments = append(segments, SalarySegment{
+				EffectiveFrom: from,
+				Start:         start,
+				WorkingDays:   int(workingDays(day)),
+				Salary:        salary,
+				DailyRate:     round(dailyRate(salary, day)),
+			})
+		}
+		segments[len(segments)-1].Days++
+	}
+	baseExact := new(big.Rat)
+	baseRounded := money.New(0, currency)
+	for i := range segments {
+		exact := new(big.Rat).Mul(dailyRate(segments[i].Salary, segments[i].Start), big.NewRat(int64(segments[i].Days), 1))
+		segments[i].Amount = round(exact)
+		baseExact.Add(baseExact, exact)
+		baseRounded = baseRounded.Add(segments[i].Amount)
+	}
+
+	overtimeHours := new(big.Rat)
+	holidayHours := new(big.Rat)
+	overtimeExact := new(big.Rat)
+	latest := time.Time{}
+	for _, o := range overtimes {
+		_, salary := timeline.on(o.Date)
+		hours := hoursRat(o.Hours)
+		overtimeHours.Add(overtimeHours, hours)
+		multiplier := rules.OvertimeMultiplier
+		if in.Calendar.IsHoliday(o.Date) && rules.HolidayOvertimeMultiplier > 0 {
+			multiplier = rules.HolidayOvertimeMultiplier
+			holidayHours.Add(holidayHours, hours)
+		}
+		pay := new(big.Rat).Mul(hourlyRate(salary, o.Date), hours)
+		pay.Mul(pay, big.NewRat(multiplier, 1))
+		overtimeExact.Add(overtimeExact, pay)
+		if o.Date.After(latest) {
+			latest = o.Date
+		}
+	}
+	reimbursementTotal := money.New(0, currency)
+	for _, r := range reimbursements {
+		reimbursementTotal = reimbursementTotal.Add(r.Amount)
+	}
+
+	// The headline rate is the one in effect on the latest record
+	if len(days) > 0 && days[len(days)-1].After(latest) {
+		latest = days[len(days)-1]
+	}
+	salary := user.Salary
+	if !latest.IsZero() {
+		_, salary = timeline.on(latest)
+	} else {
+		latest = in.PayDate
+	}
+	hours, _ := overtimeHours.Float64()
+	holidayOvertime, _ := holidayHours.Float64()
+
+	b := Breakdown{
+		UserID:               user.ID,
+		SalaryRate:           salary,
+		DailyRate:            round(dailyRate(salary, latest)),
+		WorkingDays:          int(workingDays(latest)),
+		AttendanceDays:       len(attendances),
+		PaidLeaveDays:        paidLeave,
+		UnpaidLeaveDays:      unpaidLeave,
+		BaseSalary:           baseRounded,
+		SalarySegments:       segments,
+		OvertimeHours:        hours,
+		HolidayOvertimeHours: holidayOvertime,
+		OvertimePay:          round(overtimeExact),
+		ReimbursementTotal:   reimbursementTotal,
+		Currency:             currency,
+	}
+	if rules.Rounding.Scope == money.PerTotal {
+		// Lines are shown rounded but the totals are rounded once from the exact amounts
+		b.BaseSalary = round(baseExact)
+		b.GrossPay = round(new(big.Rat).Add(baseExact, overtimeExact))
+	} else {
+		// Totals are sums of the rounded lines so they always match what is shown
+		b.GrossPay = b.BaseSalary.Add(b.OvertimePay)
+	}
+
+	lines, err := componentLines(in, b.BaseSalary, round)
+	if err != nil {
+		return b, err
+	}
+	b.Components = lines
+	b.ComponentEarnings = money.New(0, currency)
+	b.ComponentDeductions = money.New(0, currency)
+	nonTaxable := money.New(0, currency)
+	for _, l := range lines {
+		if l.Kind == KindDeduction {
+			continue
+		}
+		b.ComponentEarnings = b.ComponentEarnings.Add(l.Amount)
+		if !l.Taxable {
+			nonTaxable = nonTaxable.Add(l.Amount)
+		}
+	}
+	b.GrossPay = b.GrossPay.Add(b.ComponentEarnings)
+
+	b.EmployeeContributions = money.New(0, currency)
+	b.EmployerContributions = money.New(0, currency)
+	b.TaxableIncome = b.GrossPay.Sub(nonTaxable)
+	b.TaxDeductible = money.New(0, currency)
+	if rules.Contributions != nil {
+		lines, err := rules.Contributions.Compute(contributions.Wages{
+			BaseSalary:    b.BaseSalary,
+			GrossPay:      b.GrossPay,
+			MonthlySalary: b.SalaryRate,
+		}, in.PayDate, rules.Rounding.Mode)
+		if err != nil {
+			return b, err
+		}
+		b.Contributions = lines
+		for _, l := range lines {
+			b.EmployeeContributions = b.EmployeeContributions.Add(l.EmployeeAmount)
+			b.EmployerContributions = b.EmployerContributions.Add(l.EmployerAmount)
+			if l.EmployerShareTaxable {
+				b.TaxableIncome = b.TaxableIncome.Add(l.EmployerAmount)
+			}
+			if l.EmployeeShareDeductible {
+				b.TaxDeductible = b.TaxDeductible.Add(l.EmployeeAmount)
+			}
+		}
+	}
+
+	b.TaxWithheld = money.New(0, currency)
+	if rules.Tax != nil {
+		result, err := rules.Tax.Withhold(tax.Input{
+			Gross:         b.TaxableIncome,
+			YTDGross:      in.YearToDate.TaxableIncome,
+			YTDWithheld:   in.YearToDate.TaxWithheld,
+			Deductions:    b.TaxDeductible,
+			YTDDeductions: in.YearToDate.TaxDeductible,
+			Status:        tax.Status{Married: user.Married, Dependents: user.Dependents},
+			PayDate:       in.PayDate,
+			PeriodStart:   in.PeriodStart,
+			FinalPeriod:   in.FinalPeriod,
+		})
+		if err != nil {
+			return b, err
+		}
+		b.TaxWithheld = result.Withholding
+		b.TaxMethod = result.Method
+	}
+
+	// Deductions never take more than the net pay, so take home pay is at least the reimbursements
+	available := b.GrossPay.Sub(b.EmployeeContributions).Sub(b.TaxWithheld)
+	if available.IsNegative() {
+		available = money.New(0, currency)
+	}
+	for i := range b.Components {
+		l := &b.Components[i]
+		if l.Kind != KindDeduction {
+			continue
+		}
+		taken := money.Min(l.Amount, available)
+		l.Shortfall = l.Amount.Sub(taken)
+		l.Amount = taken
+		available = available.Sub(taken)
+		b.ComponentDeductions = b.ComponentDeductions.Add(taken)
+	}
+
+	b.TakeHomePay = b.GrossPay.Sub(b.EmployeeContributions).Sub(b.TaxWithheld).Sub(b.ComponentDeductions).Add(b.ReimbursementTotal)
+	return b, nil
+}
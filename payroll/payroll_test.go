@@ -0,0 +1,319 @@
+package payroll
+
+import (
+	"go-payroll/contributions"
+	"go-payroll/models"
+	"go-payroll/money"
+	"go-payroll/tax"
+	"testing"
+	"time"
+)
+
+func date(s string) time.Time {
+	d, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func amount(s string) money.Money {
+	m, err := money.Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+func attendances(dates ...string) []models.Attendance {
+	var out []models.Attendance
+	for _, d := range dates {
+		out = append(out, models.Attendance{Date: date(d)})
+	}
+	return out
+}
+
+// workdays returns attendance on the first n weekdays from a date
+func workdays(from string, n int) []models.Attendance {
+	var out []models.Attendance
+	for d := date(from); len(out) < n; d = d.AddDate(0, 0, 1) {
+		if d.Weekday() != time.Saturday && d.Weekday() != time.Sunday {
+			out = append(out, models.Attendance{Date: d})
+		}
+	}
+	return out
+}
+
+// assignment assigns a pay component of the given type from the start of 2025
+func assignment(id uint, componentType, perPeriod string) models.EmployeePayComponent {
+	return models.EmployeePayComponent{
+		ID:           id,
+		PayComponent: models.PayComponent{Code: componentType, Type: componentType},
+		Amount:       amount(perPeriod),
+		Principal:    amount("10000000"),
+		StartDate:    date("2025-01-01"),
+	}
+}
+
+// want lists the expected amounts of a breakdown; empty fields are not checked
+type want struct {
+	dailyRate, baseSalary, overtimePay, componentEarnings, componentDeductions string
+	grossPay, reimbursementTotal, takeHomePay, shortfall                       string
+	workingDays                                                                int
+}
+
+func (w want) check(t *testing.T, b Breakdown) {
+	t.Helper()
+	shortfall := money.New(0, b.Currency)
+	for _, l := range b.Components {
+		shortfall = shortfall.Add(l.Shortfall)
+	}
+	for _, c := range []struct {
+		name string
+		want string
+		got  money.Money
+	}{
+		{"DailyRate", w.dailyRate, b.DailyRate},
+		{"BaseSalary", w.baseSalary, b.BaseSalary},
+		{"OvertimePay", w.overtimePay, b.OvertimePay},
+		{"ComponentEarnings", w.componentEarnings, b.ComponentEarnings},
+		{"ComponentDeductions", w.componentDeductions, b.ComponentDeductions},
+		{"GrossPay", w.grossPay, b.GrossPay},
+		{"ReimbursementTotal", w.reimbursementTotal, b.ReimbursementTotal},
+		{"TakeHomePay", w.takeHomePay, b.TakeHomePay},
+		{"Shortfall", w.shortfall, shortfall},
+	} {
+		if c.want != "" && c.got.String() != c.want {
+			t.Errorf("%s = %s, want %s", c.name, c.got, c.want)
+		}
+	}
+	if w.workingDays != 0 && b.WorkingDays != w.workingDays {
+		t.Errorf("WorkingDays = %d, want %d", b.WorkingDays, w.workingDays)
+	}
+}
+
+func pph21(t *testing.T) tax.Jurisdiction {
+	t.Helper()
+	j, err := tax.Load("id-pph21")
+	if err != nil {
+		t.Fatalf("load id-pph21: %v", err)
+	}
+	return j
+}
+
+func bpjs(t *testing.T) *contributions.Scheme {
+	t.Helper()
+	s, err := contributions.Load("id-bpjs")
+	if err != nil {
+		t.Fatalf("load id-bpjs: %v", err)
+	}
+	return s
+}
+
+func TestCalculate(t *testing.T) {
+	rules := DefaultRules
+	user := models.User{ID: 1, Salary: amount("2000000")}
+
+	tests := []struct {
+		name  string
+		in    Input
+		rules func(*Rules)
+		want  want
+	}{
+		{
+			name: "daily rate divides the salary by the working days per month",
+			in:   Input{User: user, Attendances: attendances("2025-01-06", "2025-01-07", "2025-01-08"), PayDate: date("2025-01-31")},
+			want: want{dailyRate: "100000.00", baseSalary: "300000.00", grossPay: "300000.00", takeHomePay: "300000.00", workingDays: 20},
+		},
+		{
+			name:  "daily rate divisor follows the rules",
+			in:    Input{User: user, Attendances: attendances("2025-01-06"), PayDate: date("2025-01-31")},
+			rules: func(r *Rules) { r.WorkingDaysPerMonth = 25 },
+			want:  want{dailyRate: "80000.00", baseSalary: "80000.00", workingDays: 25},
+		},
+		{
+			name: "daily rate rounds half to even",
+			in:   Input{User: models.User{Salary: amount("1000000")}, Attendances: attendances("2025-01-06", "2025-01-07", "2025-01-08"), PayDate: date("2025-01-31")},
+			// 1,000,000 / 21 = 47619.047..., three days are 142857.142... rounded once per segment
+			rules: func(r *Rules) { r.WorkingDaysPerMonth = 21 },
+			want:  want{dailyRate: "47619.05", baseSalary: "142857.14"},
+		},
+		{
+			name: "overtime is paid at the multiplier times the hourly rate",
+			in: Input{User: user, PayDate: date("2025-01-31"), Overtimes: []models.Overtime{
+				{Date: date("2025-01-06"), Hours: 3},
+			}},
+			// 100,000 / 8 hours = 12,500 an hour, × 2 × 3 hours
+			want: want{overtimePay: "75000.00", grossPay: "75000.00", takeHomePay: "75000.00"},
+		},
+		{
+			name: "overtime multiplier follows the rules and fractional hours are exact",
+			in: Input{User: user, PayDate: date("2025-01-31"), Overtimes: []models.Overtime{
+				{Date: date("2025-01-06"), Hours: 1.5},
+				{Date: date("2025-01-07"), Hours: 0.1},
+			}},
+			rules: func(r *Rules) { r.OvertimeMultiplier = 3 },
+			// 12,500 × 3 × 1.6 hours
+			want: want{overtimePay: "60000.00"},
+		},
+		{
+			name: "a raise applies from its effective date",
+			in: Input{
+				User: user,
+				Salaries: []models.SalaryHistory{
+					{Salary: amount("2000000"), EffectiveFrom: date("2024-01-01")},
+					{Salary: amount("3000000"), EffectiveFrom: date("2025-01-16")},
+				},
+				Attendances: attendances("2025-01-10", "2025-01-15", "2025-01-16", "2025-01-20"),
+				Overtimes:   []models.Overtime{{Date: date("2025-01-10"), Hours: 1}, {Date: date("2025-01-20"), Hours: 1}},
+				PayDate:     date("2025-01-31"),
+			},
+			// 2 days at 100,000 and 2 days at 150,000; overtime 25,000 + 37,500
+			want: want{dailyRate: "150000.00", baseSalary: "500000.00", overtimePay: "62500.00", grossPay: "562500.00"},
+		},
+		{
+			name: "days before the first salary history entry use the earliest salary",
+			in: Input{
+				User:        user,
+				Salaries:    []models.SalaryHistory{{Salary: amount("4000000"), EffectiveFrom: date("2025-02-01")}},
+				Attendances: attendances("2025-01-31"),
+				PayDate:     date("2025-01-31"),
+			},
+			want: want{baseSalary: "200000.00"},
+		},
+		{
+			name: "paid leave counts like attendance, unpaid leave does not",
+			in: Input{
+				User:        user,
+				Attendances: attendances("2025-01-06"),
+				LeaveDays: []models.LeaveDay{
+					{Date: date("2025-01-07"), Paid: true},
+					{Date: date("2025-01-08"), Paid: false},
+				},
+				PayDate: date("2025-01-31"),
+			},
+			want: want{baseSalary: "200000.00"},
+		},
+		{
+			name: "reimbursements are added to take home pay but not gross pay",
+			in: Input{
+				User:        user,
+				Attendances: attendances("2025-01-06"),
+				Reimbursements: []models.Reimbursement{
+					{Amount: amount("50000.50")},
+					{Amount: amount("25000")},
+				},
+				PayDate: date("2025-01-31"),
+			},
+			want: want{grossPay: "100000.00", reimbursementTotal: "75000.50", takeHomePay: "175000.50"},
+		},
+		{
+			name: "deductions stop at the net pay and leave take home pay at the reimbursements",
+			in: Input{
+				User:           user,
+				Attendances:    attendances("2025-01-06"),
+				Reimbursements: []models.Reimbursement{{Amount: amount("20000")}},
+				Components:     []models.EmployeePayComponent{assignment(1, models.ComponentDeduction, "150000")},
+				PayDate:        date("2025-01-31"),
+			},
+			want: want{grossPay: "100000.00", componentDeductions: "100000.00", shortfall: "50000.00", takeHomePay: "20000.00"},
+		},
+		{
+			name: "deductions are taken in assignment order",
+			in: Input{
+				User:        user,
+				Attendances: attendances("2025-01-06"),
+				Components: []models.EmployeePayComponent{
+					assignment(2, models.ComponentDeduction, "50000"),
+					assignment(1, models.ComponentLoanRepayment, "80000"),
+				},
+				PayDate: date("2025-01-31"),
+			},
+			// the loan takes 80,000, the deduction the 20,000 left
+			want: want{componentDeductions: "100000.00", shortfall: "30000.00", takeHomePay: "0.00"},
+		},
+		{
+			name: "deduction arrears are taken with the deduction",
+			in: Input{
+				User:              user,
+				Attendances:       attendances("2025-01-06", "2025-01-07", "2025-01-08"),
+				Components:        []models.EmployeePayComponent{assignment(1, models.ComponentDeduction, "50000")},
+				ComponentsArrears: map[uint]money.Money{1: amount("30000")},
+				PayDate:           date("2025-01-31"),
+			},
+			want: want{componentDeductions: "80000.00", shortfall: "0.00", takeHomePay: "220000.00"},
+		},
+		{
+			name: "an ended deduction only takes its arrears",
+			in: Input{
+				User:        user,
+				Attendances: attendances("2025-02-03"),
+				Components: []models.EmployeePayComponent{func() models.EmployeePayComponent {
+					a := assignment(1, models.ComponentDeduction, "50000")
+					end := date("2025-01-31")
+					a.EndDate = &end
+					return a
+				}()},
+				ComponentsArrears: map[uint]money.Money{1: amount("30000")},
+				PeriodStart:       date("2025-02-01"),
+				PayDate:           date("2025-02-28"),
+			},
+			want: want{componentDeductions: "30000.00", takeHomePay: "70000.00"},
+		},
+		{
+			name: "income tax is withheld from take home pay",
+			in: Input{
+				User:        models.User{Salary: amount("10000000")},
+				Attendances: workdays("2024-01-01", 20),
+				PeriodStart: date("2024-01-01"),
+				PayDate:     date("2024-01-31"),
+			},
+			rules: func(r *Rules) { r.Tax = pph21(t) },
+			// TER A 2% of 10,000,000
+			want: want{grossPay: "10000000.00", takeHomePay: "9800000.00"},
+		},
+		{
+			name: "income tax of a short period is looked up on its monthly equivalent",
+			in: Input{
+				User:        models.User{Salary: amount("10000000")},
+				Attendances: workdays("2024-01-01", 10),
+				PeriodStart: date("2024-01-01"),
+				PayDate:     date("2024-01-15"),
+			},
+			rules: func(r *Rules) { r.Tax = pph21(t) },
+			// 5,000,000 over 15 of 31 days is 10,333,333 a month, TER A 2.25%
+			want: want{grossPay: "5000000.00", takeHomePay: "4887500.00"},
+		},
+		{
+			name: "contribution wage caps are on the monthly salary",
+			in: Input{
+				User:        models.User{Salary: amount("20000000")},
+				Attendances: workdays("2025-03-03", 10),
+				PeriodStart: date("2025-03-01"),
+				PayDate:     date("2025-03-31"),
+			},
+			rules: func(r *Rules) { r.Contributions = bpjs(t) },
+			// half the month: 1% of half the 12,000,000 health cap, 2% JHT, 1% of half the 10,547,400 JP cap
+			want: want{grossPay: "10000000.00", takeHomePay: "9687263.00"},
+		},
+		{
+			name: "nothing recorded pays nothing",
+			in:   Input{User: user, PayDate: date("2025-01-31")},
+			want: want{dailyRate: "100000.00", baseSalary: "0.00", overtimePay: "0.00", grossPay: "0.00", takeHomePay: "0.00"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := rules
+			if tt.rules != nil {
+				tt.rules(&r)
+			}
+			b, err := Calculate(tt.in, r)
+			if err != nil {
+				t.Fatalf("Calculate: %v", err)
+			}
+			tt.want.check(t, b)
+		})
+	}
+}
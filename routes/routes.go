@@ -2,6 +2,7 @@
 package routes
 
 import (
+	"fmt"
 	"go-payroll/controllers"
 	"go-payroll/middleware"
 	"time"
@@ -14,11 +15,17 @@ import (
 func Setup(app *fiber.App) {
     // Grouping API
     api := app.Group("/api")
-		// Admin Routes
-		admin := api.Group("/admin",middleware.JWTProtected("admin"))
-		employee := api.Group("/employee",middleware.JWTProtected("employee"))
+		// Each route requires the permission its route guard names, users get permissions through their roles
+		admin := api.Group("/admin",middleware.JWTProtected(), middleware.Authorize())
+		employee := api.Group("/employee",middleware.JWTProtected(), middleware.Authorize())
+		// Manager routes are limited to the user's direct and indirect reports
+		manager := api.Group("/manager", middleware.JWTProtected(), middleware.Authorize(), controllers.RequireManager)
 		cache:=cache.New(cache.Config{
 			Expiration: 5 * time.Minute,
+			// Cache per user and per requested format, not just per path
+			KeyGenerator: func(c *fiber.Ctx) string {
+				return fmt.Sprintf("%s|%v|%s|%s", c.Path(), c.Locals("user_id"), c.Query("format"), c.Get(fiber.HeaderAccept))
+			},
 		})
     // Health check route (optional)
     api.Get("/", func(c *fiber.Ctx) error {
@@ -27,22 +34,132 @@ func Setup(app *fiber.App) {
 
 		// Authentication Routes
 		api.Post("/login", controllers.Login)
+		api.Post("/token/refresh", controllers.RefreshToken)
+		api.Post("/logout", middleware.JWTProtected(), controllers.Logout)
+		api.Get("/me/permissions", middleware.JWTProtected(), controllers.GetMyPermissions)
+		api.Post("/me/password", middleware.JWTProtected(), controllers.ChangePassword)
 
     // Attendance Routes
     employee.Post("/attendance", controllers.SubmitAttendance)
+		employee.Post("/clock-in", controllers.ClockIn)
+		employee.Post("/clock-out", controllers.ClockOut)
+		employee.Post("/attendance-corrections", controllers.RequestAttendanceCorrection)
+		employee.Get("/attendance-corrections", controllers.ListMyAttendanceCorrections)
     // Overtime Routes
     employee.Post("/overtime", controllers.SubmitOvertime)
+		employee.Get("/overtime", controllers.ListMyOvertime)
     // Reimbursement Routes
     employee.Post("/reimbursement", controllers.SubmitReimbursement)
+		employee.Get("/reimbursements", controllers.ListMyReimbursements)
+		employee.Post("/reimbursements/:id/receipt", controllers.UploadReceipt)
+		employee.Get("/reimbursements/:id/receipt", controllers.GetMyReceipt)
+		employee.Get("/reimbursement-categories", controllers.ListReimbursementCategoriesForEmployee)
 		// Generate payslip for an employee
 		employee.Get("/payslip", cache, controllers.GeneratePayslip)
+		// Payslips of past payroll runs
+		employee.Get("/payslips", controllers.ListPayslips)
+		employee.Get("/payslips/:id", controllers.GetPayslip)
+		// Payout details, account number masked
+		employee.Get("/bank-account", controllers.GetBankAccount)
+		// Leave requests and balances
+		employee.Post("/leave", controllers.RequestLeave)
+		employee.Get("/leave", controllers.ListMyLeave)
+		employee.Get("/leave/balances", controllers.GetLeaveBalances)
+		employee.Post("/leave/:id/cancel", controllers.CancelLeave)
+		// Work schedule of the employee
+		employee.Get("/schedule", controllers.GetMySchedule)
 
 
     // Attendance Period Routes
 		admin.Post("/attendance-period", controllers.CreateAttendancePeriod)
+		admin.Get("/attendance-periods", controllers.ListAttendancePeriods)
+		admin.Patch("/attendance-period/:id/status", controllers.UpdateAttendancePeriodStatus)
 		//Generate payslip summary for all employees
 		admin.Get("/payslip-summary", controllers.PayslipSummary)
 		// Process payroll
-		admin.Post("/run-payroll",  cache, controllers.RunPayroll)
+		admin.Post("/run-payroll", controllers.RunPayroll)
+		// Employee management
+		admin.Get("/employees", controllers.ListEmployees)
+		admin.Post("/employees", controllers.CreateEmployee)
+		admin.Get("/employees/:id", controllers.GetEmployee)
+		admin.Put("/employees/:id", controllers.UpdateEmployee)
+		admin.Post("/employees/:id/deactivate", controllers.DeactivateEmployee)
+		// Salary history and scheduled raises
+		admin.Get("/employees/:id/salary-history", controllers.ListSalaryHistory)
+		admin.Post("/employees/:id/salary-history", controllers.ScheduleSalaryChange)
+		// Employee payout details
+		admin.Get("/employees/:id/bank-account", controllers.GetEmployeeBankAccount)
+		admin.Put("/employees/:id/bank-account", controllers.UpdateBankAccount)
+		// Pay components and their assignment to employees
+		admin.Get("/pay-components", controllers.ListPayComponents)
+		admin.Post("/pay-components", controllers.CreatePayComponent)
+		admin.Put("/pay-components/:id", controllers.UpdatePayComponent)
+		admin.Get("/employees/:id/pay-components", controllers.ListEmployeePayComponents)
+		admin.Post("/employees/:id/pay-components", controllers.AssignPayComponent)
+		admin.Put("/employees/:id/pay-components/:assignmentId", controllers.UpdateEmployeePayComponent)
+		// Work schedules, assigned to employees through work_schedule_id
+		admin.Get("/work-schedules", controllers.ListWorkSchedules)
+		admin.Post("/work-schedules", controllers.CreateWorkSchedule)
+		admin.Put("/work-schedules/:id", controllers.UpdateWorkSchedule)
+		// Public holiday calendar
+		admin.Get("/holidays", controllers.ListHolidays)
+		admin.Post("/holidays", controllers.CreateHoliday)
+		admin.Post("/holidays/import", controllers.ImportHolidays)
+		admin.Delete("/holidays/:id", controllers.DeleteHoliday)
+		// Attendance corrections
+		admin.Get("/attendance-corrections", controllers.ListAttendanceCorrections)
+		admin.Post("/attendance-corrections/:id/approve", controllers.ApproveAttendanceCorrection)
+		admin.Post("/attendance-corrections/:id/reject", controllers.RejectAttendanceCorrection)
+		// Overtime approval
+		admin.Get("/overtime", controllers.ListOvertime)
+		admin.Post("/overtime/:id/approve", controllers.ApproveOvertime)
+		admin.Post("/overtime/:id/reject", controllers.RejectOvertime)
+		// Reimbursement categories and claim approval
+		admin.Get("/reimbursement-categories", controllers.ListReimbursementCategories)
+		admin.Post("/reimbursement-categories", controllers.CreateReimbursementCategory)
+		admin.Put("/reimbursement-categories/:id", controllers.UpdateReimbursementCategory)
+		admin.Get("/reimbursements", controllers.ListReimbursements)
+		admin.Get("/reimbursements/:id/receipt", controllers.GetReimbursementReceipt)
+		admin.Post("/reimbursements/:id/approve", controllers.ApproveReimbursement)
+		admin.Post("/reimbursements/:id/reject", controllers.RejectReimbursement)
+		// Leave types and leave approval
+		admin.Get("/leave-types", controllers.ListLeaveTypes)
+		admin.Post("/leave-types", controllers.CreateLeaveType)
+		admin.Put("/leave-types/:id", controllers.UpdateLeaveType)
+		admin.Get("/leave-requests", controllers.ListLeaveRequests)
+		admin.Post("/leave-requests/:id/approve", controllers.ApproveLeave)
+		admin.Post("/leave-requests/:id/reject", controllers.RejectLeave)
+		admin.Get("/employees/:id/leave-balances", controllers.GetEmployeeLeaveBalances)
+		admin.Get("/payroll-runs", controllers.ListPayrollRuns)
+		admin.Get("/payroll-runs/:id/summary", controllers.PayrollRunSummary)
+		// Void a payroll run so the period can be run again
+		admin.Post("/payroll-runs/:id/void", controllers.VoidPayroll)
+		// Zip of every employee's PDF payslip for a run
+		admin.Get("/payroll-runs/:id/payslips", controllers.ExportPayrollRunPayslips)
+		// Bank disbursement file for a run
+		admin.Get("/payroll-runs/:id/bank-file", controllers.ExportBankFile)
 
-}
\ No newline at end of file
+		admin.Get("/permissions", controllers.ListPermissions)
+		admin.Get("/roles", controllers.ListRoles)
+		admin.Post("/roles", controllers.CreateRole)
+		admin.Put("/roles/:id", controllers.UpdateRole)
+		admin.Get("/route-guards", controllers.ListRouteGuards)
+		admin.Put("/route-guards/:id", controllers.UpdateRouteGuard)
+
+		// Team approvals for managers
+		manager.Get("/team", controllers.ListTeam)
+		manager.Get("/team/:id/leave-balances", controllers.GetEmployeeLeaveBalances)
+		manager.Get("/attendance-corrections", controllers.ListAttendanceCorrections)
+		manager.Post("/attendance-corrections/:id/approve", controllers.ApproveAttendanceCorrection)
+		manager.Post("/attendance-corrections/:id/reject", controllers.RejectAttendanceCorrection)
+		manager.Get("/overtime", controllers.ListOvertime)
+		manager.Post("/overtime/:id/approve", controllers.ApproveOvertime)
+		manager.Post("/overtime/:id/reject", controllers.RejectOvertime)
+		manager.Get("/leave-requests", controllers.ListLeaveRequests)
+		manager.Post("/leave-requests/:id/approve", controllers.ApproveLeave)
+		manager.Post("/leave-requests/:id/reject", controllers.RejectLeave)
+		manager.Get("/reimbursements", controllers.ListReimbursements)
+		manager.Get("/reimbursements/:id/receipt", controllers.GetReimbursementReceipt)
+		manager.Post("/reimbursements/:id/approve", controllers.ApproveReimbursement)
+		manager.Post("/reimbursements/:id/reject", controllers.RejectReimbursement)
+}
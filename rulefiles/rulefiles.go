@@ -0,0 +1,74 @@
+// rulefiles/rulefiles.go
+package rulefiles
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// File is one decoded rule file, in effect from its effective_from date
+type File[T any] struct {
+	Path          string
+	EffectiveFrom time.Time
+	Rules         T
+}
+
+// Load decodes every rule file named <name>-<version>.json, from the directory in the dirEnv environment
+// variable when set, otherwise from the rules directory of embedded, oldest effective_from first.
+// Finding no file is not an error, callers say what was missing.
+func Load[T any](embedded fs.FS, dirEnv, name string) ([]File[T], error) {
+	fsys, dir := embedded, "rules"
+	if custom := os.Getenv(dirEnv); custom != "" {
+		fsys, dir = os.DirFS(custom), "."
+	}
+	paths, err := fs.Glob(fsys, dir+"/*.json")
+	if err != nil {
+		return nil, err
+	}
+
+	var files []File[T]
+	for _, path := range paths {
+		if !strings.HasPrefix(strings.ToLower(path[strings.LastIndex(path, "/")+1:]), strings.ToLower(name)+"-") {
+			continue
+		}
+		data, err := fs.ReadFile(fsys, path)
+		if err != nil {
+			return nil, err
+		}
+		var header struct {
+			EffectiveFrom string `json:"effective_from"` // YYYY-MM-DD
+		}
+		if err := json.Unmarshal(data, &header); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		file := File[T]{Path: path}
+		if file.EffectiveFrom, err = time.Parse("2006-01-02", header.EffectiveFrom); err != nil {
+			return nil, fmt.Errorf("%s: invalid effective_from: %w", path, err)
+		}
+		if err := json.Unmarshal(data, &file.Rules); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		files = append(files, file)
+	}
+	sort.SliceStable(files, func(i, j int) bool { return files[i].EffectiveFrom.Before(files[j].EffectiveFrom) })
+	return files, nil
+}
+
+// On picks the latest file in effect on a date, false when none is
+func On[T any](files []File[T], date time.Time) (File[T], bool) {
+	var found *File[T]
+	for i := range files {
+		if !files[i].EffectiveFrom.After(date) {
+			found = &files[i]
+		}
+	}
+	if found == nil {
+		return File[T]{}, false
+	}
+	return *found, true
+}
@@ -0,0 +1,62 @@
+package rulefiles
+
+import (
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+type rules struct {
+	Version string `json:"version"`
+}
+
+func date(s string) time.Time {
+	d, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"rules/demo-2025.1.json":  {Data: []byte(`{"version": "2025.1", "effective_from": "2025-03-01"}`)},
+		"rules/demo-2024.1.json":  {Data: []byte(`{"version": "2024.1", "effective_from": "2024-01-01"}`)},
+		"rules/demo2-2026.1.json": {Data: []byte(`{"version": "other", "effective_from": "2026-01-01"}`)},
+		"rules/other-2024.1.json": {Data: []byte(`{"version": "other", "effective_from": "2024-01-01"}`)},
+	}
+	files, err := Load[rules](fsys, "RULEFILES_TEST_DIR", "demo")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(files) != 2 || files[0].Rules.Version != "2024.1" || files[1].Rules.Version != "2025.1" {
+		t.Fatalf("Load = %+v, want demo 2024.1 then 2025.1", files)
+	}
+
+	for _, tt := range []struct {
+		date string
+		want string
+	}{
+		{"2023-12-31", ""},
+		{"2024-01-01", "2024.1"},
+		{"2025-02-28", "2024.1"},
+		{"2025-03-01", "2025.1"},
+	} {
+		file, ok := On(files, date(tt.date))
+		if got := file.Rules.Version; got != tt.want || ok != (tt.want != "") {
+			t.Errorf("On(%s) = %q %v, want %q", tt.date, got, ok, tt.want)
+		}
+	}
+}
+
+func TestLoadRejectsBadFiles(t *testing.T) {
+	for name, data := range map[string]string{
+		"no effective date": `{"version": "1"}`,
+		"bad json":          `{"version": `,
+	} {
+		fsys := fstest.MapFS{"rules/demo-1.json": {Data: []byte(data)}}
+		if _, err := Load[rules](fsys, "RULEFILES_TEST_DIR", "demo"); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package seed
+
+import (
+	"fmt"
+	"go-payroll/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// permissions are all the permissions the code knows about
+var permissions = []models.Permission{
+	{Code: models.PermEmployeeRead, Description: "View employees, their salary history, pay components, bank details and leave balances"},
+	{Code: models.PermEmployeeWrite, Description: "Create, update and deactivate employees and change their salary, pay components and bank details"},
+	{Code: models.PermPeriodManage, Description: "Create attendance periods and change their status"},
+	{Code: models.PermPayrollView, Description: "View attendance periods, payslip summaries and payroll runs"},
+	{Code: models.PermPayrollRun, Description: "Run and void payroll"},
+	{Code: models.PermPayrollExport, Description: "Download payslip archives and bank files of payroll runs"},
+	{Code: models.PermConfigRead, Description: "View pay components, work schedules, holidays, leave types and reimbursement categories"},
+	{Code: models.PermConfigWrite, Description: "Change pay components, work schedules, holidays, leave types and reimbursement categories"},
+	{Code: models.PermApprovalsView, Description: "View everyone's attendance corrections, overtime, leave requests and reimbursement claims"},
+	{Code: models.PermApprovalsReview, Description: "Approve or reject anyone's attendance corrections, overtime, leave requests and reimbursement claims"},
+	{Code: models.PermTeamReview, Description: "View and review the requests of one's direct and indirect reports"},
+	{Code: models.PermSelfService, Description: "Record one's own attendance, overtime, leave and claims and view one's payslips"},
+	{Code: models.PermRBACManage, Description: "Manage roles and the permissions routes require"},
+}
+
+// defaultRoles are the roles created when missing, with the permissions they start with
+var defaultRoles = map[string]struct {
+	name        string
+	permissions []string
+}{
+	models.RoleEmployee: {"Employee", []string{models.PermSelfService}},
+	models.RoleManager:  {"Manager", []string{models.PermTeamReview}},
+	models.RoleAuditor: {"Auditor", []string{
+		models.PermEmployeeRead, models.PermPayrollView, models.PermConfigRead, models.PermApprovalsView,
+	}},
+	models.RoleAdmin: {"Administrator", []string{
+		models.PermEmployeeRead, models.PermEmployeeWrite, models.PermPeriodManage,
+		models.PermPayrollView, models.PermPayrollRun, models.PermPayrollExport,
+		models.PermConfigRead, models.PermConfigWrite, models.PermApprovalsView, models.PermApprovalsReview,
+		models.PermRBACManage,
+	}},
+}
+
+// guard is shorthand for a route guard
+func guard(method, path, permission string) models.RouteGuard {
+	return models.RouteGuard{Method: method, Path: path, Permission: permission}
+}
+
+// defaultGuards are the permissions the routes behind Authorize require until an admin changes them
+var defaultGuards = []models.RouteGuard{
+	// Employee self-service
+	guard("POST", "/api/employee/attendance", models.PermSelfService),
+	guard("POST", "/api/employee/clock-in", models.PermSelfService),
+	guard("POST", "/api/employee/clock-out", models.PermSelfService),
+	guard("POST", "/api/employee/attendance-corrections", models.PermSelfService),
+	guard("GET", "/api/employee/attendance-corrections", models.PermSelfService),
+	guard("POST", "/api/employee/overtime", models.PermSelfService),
+	guard("GET", "/api/employee/overtime", models.PermSelfService),
+	guard("POST", "/api/employee/reimbursement", models.PermSelfService),
+	guard("GET", "/api/employee/reimbursements", models.PermSelfService),
+	guard("POST", "/api/employee/reimbursements/:id/receipt", models.PermSelfService),
+	guard("GET", "/api/employee/reimbursements/:id/receipt", models.PermSelfService),
+	guard("GET", "/api/employee/reimbursement-categories", models.PermSelfService),
+	guard("GET", "/api/employee/payslip", models.PermSelfService),
+	guard("GET", "/api/employee/payslips", models.PermSelfService),
+	guard("GET", "/api/employee/payslips/:id", models.PermSelfService),
+	guard("GET", "/api/employee/bank-account", models.PermSelfService),
+	guard("POST", "/api/employee/leave", models.PermSelfService),
+	guard("GET", "/api/employee/leave", models.PermSelfService),
+	guard("GET", "/api/employee/leave/balances", models.PermSelfService),
+	guard("POST", "/api/employee/leave/:id/cancel", models.PermSelfService),
+	guard("GET", "/api/employee/schedule", models.PermSelfService),
+
+	// Attendance periods and payroll
+	guard("POST", "/api/admin/attendance-period", models.PermPeriodManage),
+	guard("GET", "/api/admin/attendance-periods", models.PermPayrollView),
+	guard("PATCH", "/api/admin/attendance-period/:id/status", models.PermPeriodManage),
+	guard("GET", "/api/admin/payslip-summary", models.PermPayrollView),
+	guard("POST", "/api/admin/run-payroll", models.PermPayrollRun),
+	guard("GET", "/api/admin/payroll-runs", models.PermPayrollView),
+	guard("GET", "/api/admin/payroll-runs/:id/summary", models.PermPayrollView),
+	guard("POST", "/api/admin/payroll-runs/:id/void", models.PermPayrollRun),
+	guard("GET", "/api/admin/payroll-runs/:id/payslips", models.PermPayrollExport),
+	guard("GET", "/api/admin/payroll-runs/:id/bank-file", models.PermPayrollExport),
+
+	// Employees
+	guard("GET", "/api/admin/employees", models.PermEmployeeRead),
+	guard("POST", "/api/admin/employees", models.PermEmployeeWrite),
+	guard("GET", "/api/admin/employees/:id", models.PermEmployeeRead),
+	guard("PUT", "/api/admin/employees/:id", models.PermEmployeeWrite),
+	guard("POST", "/api/admin/employees/:id/deactivate", models.PermEmployeeWrite),
+	guard("GET", "/api/admin/employees/:id/salary-history", models.PermEmployeeRead),
+	guard("POST", "/api/admin/employees/:id/salary-history", models.PermEmployeeWrite),
+	guard("GET", "/api/admin/employees/:id/bank-account", models.PermEmployeeRead),
+	guard("PUT", "/api/admin/employees/:id/bank-account", models.PermEmployeeWrite),
+	guard("GET", "/api/admin/employees/:id/pay-components", models.PermEmployeeRead),
+	guard("POST", "/api/admin/employees/:id/pay-components", models.PermEmployeeWrite),
+	guard("PUT", "/api/admin/employees/:id/pay-components/:assignmentId", models.PermEmployeeWrite),
+	guard("GET", "/api/admin/employees/:id/leave-balances", models.PermEmployeeRead),
+
+	// Configuration
+	guard("GET", "/api/admin/pay-components", models.PermConfigRead),
+	guard("POST", "/api/admin/pay-components", models.PermConfigWrite),
+	guard("PUT", "/api/admin/pay-components/:id", models.PermConfigWrite),
+	guard("GET", "/api/admin/work-schedules", models.PermConfigRead),
+	guard("POST", "/api/admin/work-schedules", models.PermConfigWrite),
+	guard("PUT", "/api/admin/work-schedules/:id", models.PermConfigWrite),
+	guard("GET", "/api/admin/holidays", models.PermConfigRead),
+	guard("POST", "/api/admin/holidays", models.PermConfigWrite),
+	guard("POST", "/api/admin/holidays/import", models.PermConfigWrite),
+	guard("DELETE", "/api/admin/holidays/:id", models.PermConfigWrite),
+	guard("GET", "/api/admin/reimbursement-categories", models.PermConfigRead),
+	guard("POST", "/api/admin/reimbursement-categories", models.PermConfigWrite),
+	guard("PUT", "/api/admin/reimbursement-categories/:id", models.PermConfigWrite),
+	guard("GET", "/api/admin/leave-types", models.PermConfigRead),
+	guard("POST", "/api/admin/leave-types", models.PermConfigWrite),
+	guard("PUT", "/api/admin/leave-types/:id", models.PermConfigWrite),
+
+	// Approvals
+	guard("GET", "/api/admin/attendance-corrections", models.PermApprovalsView),
+	guard("POST", "/api/admin/attendance-corrections/:id/approve", models.PermApprovalsReview),
+	guard("POST", "/api/admin/attendance-corrections/:id/reject", models.PermApprovalsReview),
+	guard("GET", "/api/admin/overtime", models.PermApprovalsView),
+	guard("POST", "/api/admin/overtime/:id/approve", models.PermApprovalsReview),
+	guard("POST", "/api/admin/overtime/:id/reject", models.PermApprovalsReview),
+	guard("GET", "/api/admin/reimbursements", models.PermApprovalsView),
+	guard("GET", "/api/admin/reimbursements/:id/receipt", models.PermApprovalsView),
+	guard("POST", "/api/admin/reimbursements/:id/approve", models.PermApprovalsReview),
+	guard("POST", "/api/admin/reimbursements/:id/reject", models.PermApprovalsReview),
+	guard("GET", "/api/admin/leave-requests", models.PermApprovalsView),
+	guard("POST", "/api/admin/leave-requests/:id/approve", models.PermApprovalsReview),
+	guard("POST", "/api/admin/leave-requests/:id/reject", models.PermApprovalsReview),
+
+	// Access control
+	guard("GET", "/api/admin/permissions", models.PermRBACManage),
+	guard("GET", "/api/admin/roles", models.PermRBACManage),
+	guard("POST", "/api/admin/roles", models.PermRBACManage),
+	guard("PUT", "/api/admin/roles/:id", models.PermRBACManage),
+	guard("GET", "/api/admin/route-guards", models.PermRBACManage),
+	guard("PUT", "/api/admin/route-guards/:id", models.PermRBACManage),
+
+	// Managers, limited to their team
+	guard("GET", "/api/manager/team", models.PermTeamReview),
+	guard("GET", "/api/manager/team/:id/leave-balances", models.PermTeamReview),
+	guard("GET", "/api/manager/attendance-corrections", models.PermTeamReview),
+	guard("POST", "/api/manager/attendance-corrections/:id/approve", models.PermTeamReview),
+	guard("POST", "/api/manager/attendance-corrections/:id/reject", models.PermTeamReview),
+	guard("GET", "/api/manager/overtime", models.PermTeamReview),
+	guard("POST", "/api/manager/overtime/:id/approve", models.PermTeamReview),
+	guard("POST", "/api/manager/overtime/:id/reject", models.PermTeamReview),
+	guard("GET", "/api/manager/leave-requests", models.PermTeamReview),
+	guard("POST", "/api/manager/leave-requests/:id/approve", models.PermTeamReview),
+	guard("POST", "/api/manager/leave-requests/:id/reject", models.PermTeamReview),
+	guard("GET", "/api/manager/reimbursements", models.PermTeamReview),
+	guard("GET", "/api/manager/reimbursements/:id/receipt", models.PermTeamReview),
+	guard("POST", "/api/manager/reimbursements/:id/approve", models.PermTeamReview),
+	guard("POST", "/api/manager/reimbursements/:id/reject", models.PermTeamReview),
+}
+
+// SeedAccessControl runs on every start. It adds missing permissions, roles and route guards without
+// touching the ones admins changed, and gives users without a role the one in their legacy role column,
+// plus the employee role for admins.
+func SeedAccessControl(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "code"}},
+			DoUpdates: clause.AssignmentColumns([]string{"description"}),
+		}).Create(&permissions).Error; err != nil {
+			return err
+		}
+
+		for code, def := range defaultRoles {
+			var count int64
+			tx.Model(&models.Role{}).Where("code = ?", code).Count(&count)
+			if count > 0 {
+				continue
+			}
+			fmt.Println("Seeding role " + code + "...")
+			role := models.Role{Code: code, Name: def.name}
+			if err := tx.Where("code IN ?", def.permissions).Find(&role.Permissions).Error; err != nil {
+				return err
+			}
+			if err := tx.Create(&role).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&defaultGuards).Error; err != nil {
+			return err
+		}
+
+		// Admins were employees too, paid like everyone else, so they keep the employee endpoints
+		if err := tx.Exec(`INSERT INTO user_roles (user_id, role_id)
+			SELECT u.id, r.id FROM users u JOIN roles r ON r.code = u.role OR (u.role = ? AND r.code = ?)
+			WHERE NOT EXISTS (SELECT 1 FROM user_roles ur WHERE ur.user_id = u.id)`, models.RoleAdmin, models.RoleEmployee).Error; err != nil {
+			return err
+		}
+
+		// Managers used to be flagged on the user, they now hold the manager role
+		if tx.Migrator().HasColumn(&models.User{}, "is_manager") {
+			if err := tx.Exec(`INSERT INTO user_roles (user_id, role_id)
+				SELECT u.id, r.id FROM users u JOIN roles r ON r.code = ?
+				WHERE u.is_manager ON CONFLICT DO NOTHING`, models.RoleManager).Error; err != nil {
+				return err
+			}
+			return tx.Migrator().DropColumn(&models.User{}, "is_manager")
+		}
+		return nil
+	})
+}
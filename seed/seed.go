@@ -3,6 +3,7 @@ package seed
 import (
 	"fmt"
 	"go-payroll/models"
+	"go-payroll/money"
 	"go-payroll/utils"
 	"math/rand"
 	"time"
@@ -26,7 +27,7 @@ func SeedUsers(db *gorm.DB) error {
 	for i := 1; i <= 100; i++ {
 		username := fmt.Sprintf("employee%03d", i)
 		password := "password123"
-		salary := float64(rand.Intn(4_000_000) + 3_000_000) // 3m - 7m
+		salary := money.FromMajor(int64(rand.Intn(4_000_000) + 3_000_000)) // 3m - 7m
 
 		hashedPassword, _ := utils.HashPassword(password)
 
@@ -50,7 +51,7 @@ func SeedUsers(db *gorm.DB) error {
 		Username:  "admin",
 		Password:  hashedPassword, // preset
 		Role:      "admin",
-		Salary:    0,
+		Salary:    money.FromMajor(0),
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}
@@ -63,3 +64,58 @@ func SeedUsers(db *gorm.DB) error {
 	return nil
 }
 
+
+// SeedLeaveTypes creates the default leave types: annual leave earning 12 days a year, sick leave and unpaid leave
+func SeedLeaveTypes(db *gorm.DB) error {
+	var count int64
+	db.Model(&models.LeaveType{}).Count(&count)
+	if count > 0 {
+		return nil
+	}
+
+	fmt.Println("Seeding leave types...")
+	leaveTypes := []models.LeaveType{
+		{Code: "annual", Name: "Annual leave", Paid: true, AccrualDaysPerMonth: 1, MaxDaysPerYear: 12, Active: true},
+		{Code: "sick", Name: "Sick leave", Paid: true, Active: true},
+		{Code: "unpaid", Name: "Unpaid leave", Paid: false, Active: true},
+	}
+	return db.Create(&leaveTypes).Error
+}
+
+// SeedWorkSchedules creates the default work schedule: Monday to Friday, 8 hours from 09:00 to 17:00
+func SeedWorkSchedules(db *gorm.DB) error {
+	var count int64
+	db.Model(&models.WorkSchedule{}).Count(&count)
+	if count > 0 {
+		return nil
+	}
+
+	fmt.Println("Seeding work schedules...")
+	return db.Create(&models.WorkSchedule{
+		Code:        "standard",
+		Name:        "Standard office hours",
+		Weekdays:    "mon,tue,wed,thu,fri",
+		HoursPerDay: 8,
+		ShiftStart:  "09:00",
+		ShiftEnd:    "17:00",
+		IsDefault:   true,
+	}).Error
+}
+
+// SeedReimbursementCategories creates the default expense categories, without limits and requiring receipts
+func SeedReimbursementCategories(db *gorm.DB) error {
+	var count int64
+	db.Model(&models.ReimbursementCategory{}).Count(&count)
+	if count > 0 {
+		return nil
+	}
+
+	fmt.Println("Seeding reimbursement categories...")
+	categories := []models.ReimbursementCategory{
+		{Code: "travel", Name: "Travel", ReceiptRequired: true, Active: true},
+		{Code: "meals", Name: "Meals", ReceiptRequired: true, Active: true},
+		{Code: "medical", Name: "Medical", ReceiptRequired: true, Active: true},
+		{Code: "other", Name: "Other expenses", ReceiptRequired: true, Active: true},
+	}
+	return db.Create(&categories).Error
+}
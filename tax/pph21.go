@@ -0,0 +1,198 @@
+// tax/pph21.go
+package tax
+
+import (
+	"encoding/json"
+	"fmt"
+	"go-payroll/money"
+	"go-payroll/rulefiles"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// PPh21 is Indonesian employee income tax (Pajak Penghasilan Pasal 21) withheld with the TER method:
+// periods use the monthly effective rate (Tarif Efektif Rata-rata) of the employee's category on gross
+// pay, looked up on the gross of a month so periods of other lengths pay the same rate per month. The
+// employee's final period of the tax year, the last one of the year or the one they leave in, recomputes
+// the annual tax with the progressive brackets and withholds the difference with what was already
+// withheld, never less than nothing; an overpayment is settled in the annual return. Employee pension contributions (JHT and JP) are only deducted in the annual
+// calculation, TER applies to gross.
+type PPh21 struct {
+	sets []rulefiles.File[RuleSet]
+}
+
+// pph21Params is the "params" section of an id-pph21 rule file
+type pph21Params struct {
+	PTKP struct {
+		Base          int64 `json:"base"`
+		Married       int64 `json:"married"`
+		PerDependent  int64 `json:"per_dependent"`
+		MaxDependents int   `json:"max_dependents"`
+	} `json:"ptkp"`
+	OccupationalCost struct {
+		Rate      string `json:"rate"`
+		AnnualCap int64  `json:"annual_cap"`
+	} `json:"occupational_cost"`
+	TaxableIncomeRounding int64               `json:"taxable_income_rounding"`
+	AnnualBrackets        Brackets            `json:"annual_brackets"`
+	TERCategories         map[string][]string `json:"ter_categories"`
+	TER                   map[string]Brackets `json:"ter"`
+}
+
+// NewPPh21 loads the id-pph21 rule files
+func NewPPh21() (*PPh21, error) {
+	sets, err := loadRuleSets("id-pph21")
+	if err != nil {
+		return nil, err
+	}
+	return &PPh21{sets: sets}, nil
+}
+
+func (p *PPh21) Code() string { return "id-pph21" }
+
+// statusCode is the PTKP status, e.g. "TK/0" for single without dependents or "K/2"
+func (p *PPh21) statusCode(s Status, maxDependents int) string {
+	dependents := s.Dependents
+	if dependents > maxDependents {
+		dependents = maxDependents
+	}
+	if dependents < 0 {
+		dependents = 0
+	}
+	if s.Married {
+		return fmt.Sprintf("K/%d", dependents)
+	}
+	return fmt.Sprintf("TK/%d", dependents)
+}
+
+func (p *PPh21) Withhold(in Input) (Result, error) {
+	set, err := ruleSetOn(p.sets, in.PayDate)
+	if err != nil {
+		return Result{}, err
+	}
+	var params pph21Params
+	if err := json.Unmarshal(set.Params, &params); err != nil {
+		return Result{}, fmt.Errorf("id-pph21 %s: %w", set.Version, err)
+	}
+	currency := in.Gross.CurrencyCode()
+	status := p.statusCode(in.Status, params.PTKP.MaxDependents)
+
+	if !in.FinalPeriod {
+		category := ""
+		for cat, statuses := range params.TERCategories {
+			for _, s := range statuses {
+				if s == status {
+					category = cat
+				}
+			}
+		}
+		if category == "" {
+			return Result{}, fmt.Errorf("id-pph21 %s: no TER category for %s", set.Version, status)
+		}
+		months := periodMonths(in.PeriodStart, in.PayDate)
+		rate, label, err := params.TER[category].Flat(new(big.Rat).Quo(in.Gross.Rat(), months))
+		if err != nil {
+			return Result{}, err
+		}
+		tax := new(big.Rat).Mul(in.Gross.Rat(), rate)
+		method := fmt.Sprintf("TER %s %s%% (%s)", category, percent(label), status)
+		if months.Cmp(big.NewRat(1, 1)) != 0 {
+			method = fmt.Sprintf("TER %s %s%% (%s, %s months)", category, percent(label), status, months.FloatString(2))
+		}
+		return Result{
+			Withholding:  wholeUnits(tax, currency),
+			Method:       method,
+			RulesVersion: set.Version,
+		}, nil
+	}
+
+	// Final period: annual tax on the year's gross minus what was withheld so far
+	annualGross := in.YTDGross.Add(in.Gross).Rat()
+	costRate, ok := new(big.Rat).SetString(params.OccupationalCost.Rate)
+	if !ok {
+		return Result{}, fmt.Errorf("id-pph21 %s: invalid occupational cost rate", set.Version)
+	}
+	cost := new(big.Rat).Mul(annualGross, costRate)
+	if limit := new(big.Rat).SetInt64(params.OccupationalCost.AnnualCap); cost.Cmp(limit) > 0 {
+		cost = limit
+	}
+
+	dependents := in.Status.Dependents
+	if dependents > params.PTKP.MaxDependents {
+		dependents = params.PTKP.MaxDependents
+	}
+	ptkp := params.PTKP.Base + int64(dependents)*params.PTKP.PerDependent
+	if in.Status.Married {
+		ptkp += params.PTKP.Married
+	}
+
+	taxable := new(big.Rat).Sub(annualGross, cost)
+	taxable.Sub(taxable, in.YTDDeductions.Add(in.Deductions).Rat())
+	taxable.Sub(taxable, new(big.Rat).SetInt64(ptkp))
+	if taxable.Sign() < 0 {
+		taxable = new(big.Rat)
+	}
+	// Taxable income is rounded down to the thousand
+	if step := params.TaxableIncomeRounding; step > 0 {
+		units := new(big.Int).Quo(taxable.Num(), taxable.Denom())
+		units.Quo(units, big.NewInt(step))
+		taxable = new(big.Rat).SetInt(units.Mul(units, big.NewInt(step)))
+	}
+
+	annualTax, err := params.AnnualBrackets.Progressive(taxable)
+	if err != nil {
+		return Result{}, err
+	}
+	withholding := wholeUnits(annualTax, currency).Sub(in.YTDWithheld)
+	method := fmt.Sprintf("annual reconciliation (%s, taxable income %s)", status, taxable.FloatString(0))
+	if withholding.IsNegative() {
+		method = fmt.Sprintf("annual reconciliation (%s, taxable income %s, %s over withheld)", status, taxable.FloatString(0), withholding.Neg())
+		withholding = money.New(0, currency)
+	}
+	return Result{
+		Withholding:  withholding,
+		Method:       method,
+		RulesVersion: set.Version,
+	}, nil
+}
+
+// periodMonths counts the calendar months from start to end inclusive, a part of a month by its share of
+// the month's days. A zero start is one month.
+func periodMonths(start, end time.Time) *big.Rat {
+	if start.IsZero() || start.After(end) {
+		return big.NewRat(1, 1)
+	}
+	months := new(big.Rat)
+	for day := start; !day.After(end); {
+		next := time.Date(day.Year(), day.Month()+1, 1, 0, 0, 0, 0, day.Location())
+		daysInMonth := next.AddDate(0, 0, -1).Day()
+		last := daysInMonth
+		if next.AddDate(0, 0, -1).After(end) {
+			last = end.Day()
+		}
+		months.Add(months, big.NewRat(int64(last-day.Day()+1), int64(daysInMonth)))
+		day = next
+	}
+	return months
+}
+
+// wholeUnits drops the fraction of a currency unit, tax is withheld in whole rupiah
+func wholeUnits(r *big.Rat, currency string) money.Money {
+	whole := new(big.Int).Quo(r.Num(), r.Denom())
+	return money.FromRat(new(big.Rat).SetInt(whole), currency, money.Down)
+}
+
+// percent turns a fraction like "0.0125" into "1.25"
+func percent(fraction string) string {
+	r, ok := new(big.Rat).SetString(fraction)
+	if !ok {
+		return fraction
+	}
+	s := r.Mul(r, big.NewRat(100, 1)).FloatString(2)
+	return strings.TrimSuffix(strings.TrimRight(s, "0"), ".")
+}
+
+func init() {
+	Register("id-pph21", func() (Jurisdiction, error) { return NewPPh21() })
+}
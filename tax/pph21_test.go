@@ -0,0 +1,193 @@
+package tax
+
+import (
+	"encoding/json"
+	"go-payroll/money"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+func date(s string) time.Time {
+	d, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func amount(s string) money.Money {
+	m, err := money.Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+func TestPPh21Withhold(t *testing.T) {
+	p, err := NewPPh21()
+	if err != nil {
+		t.Fatalf("NewPPh21: %v", err)
+	}
+	single := Status{}
+
+	tests := []struct {
+		name string
+		in   Input
+		want string
+	}{
+		{
+			// PMK 168/2023: TK/0 earning 10,000,000 a month is TER A 2%
+			name: "monthly TER of category A",
+			in:   Input{Gross: amount("10000000"), Status: single, PeriodStart: date("2024-01-01"), PayDate: date("2024-01-31")},
+			want: "200000.00",
+		},
+		{
+			name: "monthly TER of category B",
+			in:   Input{Gross: amount("10000000"), Status: Status{Married: true, Dependents: 1}, PeriodStart: date("2024-03-01"), PayDate: date("2024-03-31")},
+			want: "150000.00",
+		},
+		{
+			name: "income under the PTKP of a month pays nothing",
+			in:   Input{Gross: amount("5400000"), Status: single, PeriodStart: date("2024-01-01"), PayDate: date("2024-01-31")},
+			want: "0.00",
+		},
+		{
+			name: "a period without a start is a month",
+			in:   Input{Gross: amount("10000000"), Status: single, PayDate: date("2024-01-31")},
+			want: "200000.00",
+		},
+		{
+			// 5,000,000 over 15 of 31 days is 10,333,333 a month, TER A 2.25%
+			name: "a half month looks the rate up on the monthly equivalent",
+			in:   Input{Gross: amount("5000000"), Status: single, PeriodStart: date("2024-01-01"), PayDate: date("2024-01-15")},
+			want: "112500.00",
+		},
+		{
+			name: "a two month period pays the monthly rate on both months",
+			in:   Input{Gross: amount("20000000"), Status: single, PeriodStart: date("2024-01-01"), PayDate: date("2024-02-29")},
+			want: "400000.00",
+		},
+		{
+			name: "a December period before the year end uses TER",
+			in:   Input{Gross: amount("10000000"), Status: single, PeriodStart: date("2024-12-01"), PayDate: date("2024-12-15"), YTDGross: amount("110000000"), YTDWithheld: amount("2200000")},
+			// 10,000,000 over 15 of 31 days is 20,666,666 a month, TER A 9%
+			want: "900000.00",
+		},
+		{
+			// 120,000,000 - 6,000,000 occupational cost - 54,000,000 PTKP = 60,000,000 at 5% = 3,000,000 a year,
+			// of which 11 × 200,000 was withheld
+			name: "the final period of the year reconciles it",
+			in:   Input{Gross: amount("10000000"), Status: single, PeriodStart: date("2024-12-01"), PayDate: date("2024-12-31"), FinalPeriod: true, YTDGross: amount("110000000"), YTDWithheld: amount("2200000")},
+			want: "800000.00",
+		},
+		{
+			// 120,000,000 - 6,000,000 - 2,400,000 JHT and JP - 58,500,000 PTKP K/0 = 53,100,000 at 5%
+			name: "the reconciliation deducts pension contributions and the PTKP of the status",
+			in: Input{
+				Gross: amount("10000000"), Deductions: amount("200000"),
+				YTDGross: amount("110000000"), YTDDeductions: amount("2200000"), YTDWithheld: amount("2200000"),
+				Status: Status{Married: true}, PeriodStart: date("2024-12-01"), PayDate: date("2024-12-31"), FinalPeriod: true,
+			},
+			want: "455000.00",
+		},
+		{
+			name: "a year whose last period ends on December 25 reconciles then",
+			in:   Input{Gross: amount("10000000"), Status: single, PeriodStart: date("2024-11-26"), PayDate: date("2024-12-25"), FinalPeriod: true, YTDGross: amount("110000000"), YTDWithheld: amount("2200000")},
+			want: "800000.00",
+		},
+		{
+			// a preview on December 31 is not the final period, the run of the period is
+			name: "December 31 alone does not reconcile",
+			in:   Input{Gross: amount("10000000"), Status: single, PeriodStart: date("2024-12-01"), PayDate: date("2024-12-31"), YTDGross: amount("110000000"), YTDWithheld: amount("2200000")},
+			want: "200000.00",
+		},
+		{
+			// 60,000,000 - 3,000,000 occupational cost - 54,000,000 PTKP = 3,000,000 at 5% = 150,000 for the year
+			name: "the period an employee leaves in reconciles the pay so far",
+			in:   Input{Gross: amount("10000000"), Status: single, PeriodStart: date("2024-06-01"), PayDate: date("2024-06-30"), FinalPeriod: true, YTDGross: amount("50000000"), YTDWithheld: amount("100000")},
+			want: "50000.00",
+		},
+		{
+			name: "over withholding is not paid back through payroll",
+			in:   Input{Gross: amount("10000000"), Status: single, PeriodStart: date("2024-12-01"), PayDate: date("2024-12-31"), FinalPeriod: true, YTDGross: amount("110000000"), YTDWithheld: amount("5000000")},
+			want: "0.00",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := p.Withhold(tt.in)
+			if err != nil {
+				t.Fatalf("Withhold: %v", err)
+			}
+			if got.Withholding.String() != tt.want {
+				t.Errorf("Withholding = %s (%s), want %s", got.Withholding, got.Method, tt.want)
+			}
+		})
+	}
+}
+
+func TestProgressiveBrackets(t *testing.T) {
+	var params pph21Params
+	p, err := NewPPh21()
+	if err != nil {
+		t.Fatalf("NewPPh21: %v", err)
+	}
+	set, err := ruleSetOn(p.sets, date("2024-12-31"))
+	if err != nil {
+		t.Fatalf("ruleSetOn: %v", err)
+	}
+	if err := json.Unmarshal(set.Params, &params); err != nil {
+		t.Fatalf("params: %v", err)
+	}
+
+	// UU HPP article 17 brackets: 5% to 60m, 15% to 250m, 25% to 500m, 30% to 5b, 35% above
+	tests := []struct {
+		taxable int64
+		want    int64
+	}{
+		{0, 0},
+		{60000000, 3000000},
+		{100000000, 9000000},
+		{300000000, 44000000},
+		{6000000000, 1794000000},
+	}
+	for _, tt := range tests {
+		got, err := params.AnnualBrackets.Progressive(new(big.Rat).SetInt64(tt.taxable))
+		if err != nil {
+			t.Fatalf("Progressive: %v", err)
+		}
+		if got.Cmp(new(big.Rat).SetInt64(tt.want)) != 0 {
+			t.Errorf("tax on %d = %s, want %d", tt.taxable, got.FloatString(0), tt.want)
+		}
+	}
+}
+
+func TestPeriodMonths(t *testing.T) {
+	tests := []struct {
+		start, end string
+		want       string
+	}{
+		{"2024-01-01", "2024-01-31", "1"},
+		{"2024-02-01", "2024-02-29", "1"},
+		{"2024-01-01", "2024-01-15", "15/31"},
+		{"2024-01-16", "2024-02-15", "16/31 + 15/29"},
+		{"2024-01-01", "2024-03-31", "3"},
+		{"", "2024-01-31", "1"},
+	}
+	for _, tt := range tests {
+		var start time.Time
+		if tt.start != "" {
+			start = date(tt.start)
+		}
+		want := new(big.Rat)
+		for _, part := range strings.Split(tt.want, " + ") {
+			r, _ := new(big.Rat).SetString(part)
+			want.Add(want, r)
+		}
+		if got := periodMonths(start, date(tt.end)); got.Cmp(want) != 0 {
+			t.Errorf("periodMonths(%s, %s) = %s, want %s", tt.start, tt.end, got.RatString(), want.RatString())
+		}
+	}
+}
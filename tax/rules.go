@@ -0,0 +1,98 @@
+// tax/rules.go
+package tax
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"go-payroll/rulefiles"
+	"math/big"
+	"time"
+)
+
+// Rule files are JSON named <jurisdiction>-<version>.json. Each holds the parameters of a tax law
+// from its effective date, so a new tax year is a new file rather than a code change.
+//
+//go:embed rules/*.json
+var embeddedRules embed.FS
+
+// RuleSet is one version of the parameters of a jurisdiction
+type RuleSet struct {
+	Jurisdiction  string          `json:"jurisdiction"`
+	Version       string          `json:"version"`
+	EffectiveFrom string          `json:"effective_from"` // YYYY-MM-DD
+	Source        string          `json:"source"`
+	Params        json.RawMessage `json:"params"` // jurisdiction specific
+}
+
+// Bracket is a band of a progressive table. The last bracket has no upper bound.
+type Bracket struct {
+	UpTo *int64 `json:"up_to"` // whole currency units, inclusive
+	Rate string `json:"rate"`  // decimal fraction, e.g. "0.05"
+}
+
+// Brackets is a progressive table ordered from the lowest band
+type Brackets []Bracket
+
+// Progressive applies each band's rate to the part of the amount that falls in it
+func (bs Brackets) Progressive(amount *big.Rat) (*big.Rat, error) {
+	tax := new(big.Rat)
+	lower := new(big.Rat)
+	for _, b := range bs {
+		rate, ok := new(big.Rat).SetString(b.Rate)
+		if !ok {
+			return nil, fmt.Errorf("invalid rate %q", b.Rate)
+		}
+		upper := amount
+		if b.UpTo != nil {
+			upper = new(big.Rat).SetInt64(*b.UpTo)
+			if amount.Cmp(upper) < 0 {
+				upper = amount
+			}
+		}
+		if upper.Cmp(lower) > 0 {
+			band := new(big.Rat).Sub(upper, lower)
+			tax.Add(tax, band.Mul(band, rate))
+		}
+		if b.UpTo == nil || amount.Cmp(upper) <= 0 {
+			break
+		}
+		lower = new(big.Rat).SetInt64(*b.UpTo)
+	}
+	return tax, nil
+}
+
+// Flat returns the rate of the band the whole amount falls in, as used by effective rate tables
+func (bs Brackets) Flat(amount *big.Rat) (*big.Rat, string, error) {
+	for _, b := range bs {
+		if b.UpTo == nil || amount.Cmp(new(big.Rat).SetInt64(*b.UpTo)) <= 0 {
+			rate, ok := new(big.Rat).SetString(b.Rate)
+			if !ok {
+				return nil, "", fmt.Errorf("invalid rate %q", b.Rate)
+			}
+			return rate, b.Rate, nil
+		}
+	}
+	return nil, "", fmt.Errorf("no bracket for amount %s", amount.FloatString(2))
+}
+
+// loadRuleSets reads every rule file of a jurisdiction, from TAX_RULES_DIR when set, otherwise the built in ones
+func loadRuleSets(jurisdiction string) ([]rulefiles.File[RuleSet], error) {
+	sets, err := rulefiles.Load[RuleSet](embeddedRules, "TAX_RULES_DIR", jurisdiction)
+	if err != nil {
+		return nil, err
+	}
+	if len(sets) == 0 {
+		return nil, fmt.Errorf("no tax rules found for %s", jurisdiction)
+	}
+	return sets, nil
+}
+
+// ruleSetOn picks the latest version in effect on a date
+func ruleSetOn(sets []rulefiles.File[RuleSet], date time.Time) (RuleSet, error) {
+	set, ok := rulefiles.On(sets, date)
+	if !ok {
+		return RuleSet{}, fmt.Errorf("no tax rules in effect on %s", date.Format("2006-01-02"))
+	}
+	return set.Rules, nil
+}
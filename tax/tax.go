@@ -0,0 +1,70 @@
+// tax/tax.go
+package tax
+
+import (
+	"fmt"
+	"go-payroll/money"
+	"sort"
+	"time"
+)
+
+// Status is the filing status of an employee used for personal allowances
+type Status struct {
+	Married    bool
+	Dependents int
+}
+
+// Input is what a jurisdiction needs to compute the withholding of one pay period
+type Input struct {
+	Gross         money.Money // taxable pay of this period, including taxable employer premiums
+	YTDGross      money.Money // taxable pay earlier in the same tax year
+	YTDWithheld   money.Money // tax withheld earlier in the same tax year
+	Deductions    money.Money // employee contributions of this period that reduce taxable income, e.g. pension
+	YTDDeductions money.Money // such contributions earlier in the same tax year
+	Status        Status
+	PayDate       time.Time // end of the pay period, decides the tax year and rules version
+	PeriodStart   time.Time // start of the pay period, for rates per month; a one month period when zero
+	FinalPeriod   bool      // the employee's last period of the tax year, at the year end or when they leave
+}
+
+// Result is the withholding for a pay period
+type Result struct {
+	Withholding  money.Money `json:"withholding"`
+	Method       string      `json:"method"` // human readable, e.g. "TER A 1.25%"
+	RulesVersion string      `json:"rules_version"`
+}
+
+// Jurisdiction computes income tax withholding under one tax law
+type Jurisdiction interface {
+	Code() string
+	Withhold(in Input) (Result, error)
+}
+
+// Constructor builds a jurisdiction, typically loading its rule files
+type Constructor func() (Jurisdiction, error)
+
+var constructors = map[string]Constructor{}
+
+// Register makes a jurisdiction available under a code
+func Register(code string, c Constructor) {
+	constructors[code] = c
+}
+
+// Load builds the jurisdiction registered under a code
+func Load(code string) (Jurisdiction, error) {
+	c, ok := constructors[code]
+	if !ok {
+		return nil, fmt.Errorf("unknown tax jurisdiction %q, available: %v", code, Codes())
+	}
+	return c()
+}
+
+// Codes lists the registered jurisdictions
+func Codes() []string {
+	codes := make([]string, 0, len(constructors))
+	for code := range constructors {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
@@ -0,0 +1,133 @@
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// encryptedPrefix marks values produced by EncryptString. Values marked legacyEncryptedPrefix used the
+// plain SHA-256 of the secret as key and are still read until the startup migration rewrites them.
+const (
+	encryptedPrefix       = "enc:v2:"
+	legacyEncryptedPrefix = "enc:v1:"
+)
+
+// minEncryptionKeyLength is the shortest DATA_ENCRYPTION_KEY accepted, e.g. the output of openssl rand -base64 32
+const minEncryptionKeyLength = 32
+
+// CheckEncryptionKey rejects a missing, short or example DATA_ENCRYPTION_KEY
+func CheckEncryptionKey() error {
+	secret := os.Getenv("DATA_ENCRYPTION_KEY")
+	switch {
+	case secret == "":
+		return errors.New("DATA_ENCRYPTION_KEY is not set")
+	case secret == "change-me":
+		return errors.New("DATA_ENCRYPTION_KEY is still the example value")
+	case len(secret) < minEncryptionKeyLength:
+		return fmt.Errorf("DATA_ENCRYPTION_KEY must be at least %d characters", minEncryptionKeyLength)
+	}
+	return nil
+}
+
+// encryptionKey derives the AES-256 key of a value prefix from DATA_ENCRYPTION_KEY
+func encryptionKey(prefix string) ([]byte, error) {
+	secret := os.Getenv("DATA_ENCRYPTION_KEY")
+	if secret == "" {
+		return nil, errors.New("DATA_ENCRYPTION_KEY is not set")
+	}
+	if prefix == legacyEncryptedPrefix {
+		key := sha256.Sum256([]byte(secret))
+		return key[:], nil
+	}
+	return hkdf.Key(sha256.New, []byte(secret), nil, "go-payroll data encryption v2", 32)
+}
+
+// newGCM returns the AES-GCM cipher of a value prefix
+func newGCM(prefix string) (cipher.AEAD, error) {
+	key, err := encryptionKey(prefix)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// EncryptString encrypts a value with AES-GCM for storage
+func EncryptString(plain string) (string, error) {
+	gcm, err := newGCM(encryptedPrefix)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plain), nil)
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptString reverses EncryptString. Values stored before encryption was enabled are returned as is.
+func DecryptString(stored string) (string, error) {
+	prefix := encryptedPrefix
+	if strings.HasPrefix(stored, legacyEncryptedPrefix) {
+		prefix = legacyEncryptedPrefix
+	} else if !strings.HasPrefix(stored, encryptedPrefix) {
+		return stored, nil
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(stored, prefix))
+	if err != nil {
+		return "", err
+	}
+	gcm, err := newGCM(prefix)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", errors.New("encrypted value is too short")
+	}
+	plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+// IsEncrypted reports whether a stored value was written by EncryptString with the current key derivation
+func IsEncrypted(stored string) bool {
+	return strings.HasPrefix(stored, encryptedPrefix)
+}
+
+// MaskAccountNumber hides all but the last four characters, e.g. ******7890
+func MaskAccountNumber(number string) string {
+	if len(number) <= 4 {
+		return strings.Repeat("*", len(number))
+	}
+	return strings.Repeat("*", len(number)-4) + number[len(number)-4:]
+}
+
+// RandomToken returns n random bytes as a hex string, for unguessable names and tokens
+func RandomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// HashToken returns the SHA-256 of a token as hex, so tokens can be looked up without being stored
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
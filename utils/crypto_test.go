@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+const testKey = "0123456789abcdef0123456789abcdef"
+
+func TestCheckEncryptionKey(t *testing.T) {
+	for key, ok := range map[string]bool{
+		"":          false,
+		"change-me": false,
+		"short":     false,
+		testKey:     true,
+	} {
+		t.Setenv("DATA_ENCRYPTION_KEY", key)
+		if err := CheckEncryptionKey(); (err == nil) != ok {
+			t.Errorf("CheckEncryptionKey(%q) = %v, want ok %v", key, err, ok)
+		}
+	}
+}
+
+func TestEncryptString(t *testing.T) {
+	t.Setenv("DATA_ENCRYPTION_KEY", testKey)
+	stored, err := EncryptString("1234567890")
+	if err != nil {
+		t.Fatalf("EncryptString: %v", err)
+	}
+	if !IsEncrypted(stored) || strings.Contains(stored, "1234567890") {
+		t.Errorf("EncryptString = %q, want an encrypted value", stored)
+	}
+	if plain, err := DecryptString(stored); err != nil || plain != "1234567890" {
+		t.Errorf("DecryptString = %q, %v", plain, err)
+	}
+
+	t.Setenv("DATA_ENCRYPTION_KEY", testKey+"-other")
+	if _, err := DecryptString(stored); err == nil {
+		t.Error("DecryptString with another key: no error")
+	}
+}
+
+// Values written with the older key derivation and plain values from before encryption still read, but
+// are not taken as encrypted so the startup migration rewrites them
+func TestDecryptStringOlderValues(t *testing.T) {
+	t.Setenv("DATA_ENCRYPTION_KEY", testKey)
+	gcm, err := newGCM(legacyEncryptedPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		t.Fatal(err)
+	}
+	legacy := legacyEncryptedPrefix + base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte("555"), nil))
+
+	for _, stored := range []string{legacy, "555"} {
+		if plain, err := DecryptString(stored); err != nil || plain != "555" {
+			t.Errorf("DecryptString(%q) = %q, %v, want 555", stored, plain, err)
+		}
+		if IsEncrypted(stored) {
+			t.Errorf("IsEncrypted(%q) = true", stored)
+		}
+	}
+}